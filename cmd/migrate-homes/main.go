@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/db"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/activity"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/favorites"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/fulltext"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/homes"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/locks"
+)
+
+// owners collects the repeated -owner Folder=sub flags
+type owners map[string]string
+
+func (o owners) String() string {
+	pairs := make([]string, 0, len(o))
+	for name, sub := range o {
+		pairs = append(pairs, name+"="+sub)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (o owners) Set(value string) error {
+	name, sub, ok := strings.Cut(value, "=")
+	name = strings.Trim(name, "/")
+	if !ok || name == "" || sub == "" {
+		return fmt.Errorf("expected Folder=sub, got %q", value)
+	}
+	o[name] = sub
+	return nil
+}
+
+// migrate-homes moves the top-level folders and files of the bucket into the home of their owner.
+// Every -owner Folder=sub moves one entry, -owner Folder=family shares it in the family space
+// and -default moves everything else. With -dry-run the plan is only printed
+func main() {
+	plan := homes.Plan{Owners: make(owners)}
+	flag.Var(owners(plan.Owners), "owner", "top-level folder or file and the Cognito sub of its owner or family, as Folder=sub (repeatable)")
+	flag.StringVar(&plan.DefaultOwner, "default", "", "Cognito sub receiving the entries without an -owner, they are left in place when empty")
+	dryRun := flag.Bool("dry-run", false, "print what would be moved without moving anything")
+	flag.Parse()
+
+	logger := log.NewLogger().With(context.TODO(), "Version", "1.0.0")
+	database := db.NewDB(logger)
+	migrator := homes.NewMigrator(logger, aws.NewS3Driver(logger), homes.Stores{
+		Metadata:  index.NewIndex(logger, database),
+		Favorites: favorites.NewStore(logger, database),
+		Locks:     locks.NewStore(logger, database),
+		FullText:  fulltext.NewStore(logger, database),
+		Activity:  activity.NewStore(logger, database),
+	}, aws.BucketName)
+
+	report, err := migrator.Migrate(context.Background(), plan, *dryRun)
+	if report != nil {
+		encoded, _ := json.MarshalIndent(report, "", "\t")
+		fmt.Println(string(encoded))
+	}
+	if err != nil {
+		logger.Error("Error while migrating to homes: ", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/db"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+)
+
+// rebuild-index walks the whole bucket and replaces the content of the metadata index.
+// With -reconcile the index is compared with the bucket instead and the drift report is printed
+func main() {
+	reconcile := flag.Bool("reconcile", false, "fix the drift between the index and the bucket instead of rebuilding it")
+	flag.Parse()
+
+	logger := log.NewLogger().With(context.TODO(), "Version", "1.0.0")
+	metadata := index.NewIndex(logger, db.NewDB(logger))
+	s3Driver := aws.NewS3Driver(logger)
+
+	if *reconcile {
+		report, err := index.NewReconciler(logger, metadata, s3Driver, aws.BucketName).Reconcile(context.Background())
+		if err != nil {
+			logger.Error("Error while reconciling the index: ", err.Error())
+			os.Exit(1)
+		}
+		encoded, _ := json.MarshalIndent(report, "", "\t")
+		fmt.Println(string(encoded))
+		return
+	}
+
+	count, err := metadata.Rebuild(context.Background(), s3Driver, aws.BucketName)
+	if err != nil {
+		logger.Error("Error while rebuilding the index: ", err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("Indexed objects: ", count)
+}
@@ -0,0 +1,32 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// withSignedHeaders adds headers to the presigned request before it is signed
+func withSignedHeaders(headers map[string]string) func(*s3.PresignOptions) {
+	return func(o *s3.PresignOptions) {
+		if len(headers) == 0 {
+			return
+		}
+		o.ClientOptions = append(o.ClientOptions, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Build.Add(middleware.BuildMiddlewareFunc("SignedHeaders", func(
+					ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+				) (middleware.BuildOutput, middleware.Metadata, error) {
+					if req, ok := in.Request.(*smithyhttp.Request); ok {
+						for name, value := range headers {
+							req.Header.Set(name, value)
+						}
+					}
+					return next.HandleBuild(ctx, in)
+				}), middleware.After)
+			})
+		})
+	}
+}
@@ -2,20 +2,32 @@ package aws
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
 	aws_config "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// BucketName is the bucket holding the family drive
+const BucketName = "morales-storage-drive"
+
 // S3Driver is the interface for the aws driver
 type S3Driver interface {
 	ListObjects(ctx context.Context, params *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, *error.RequestError)
-	UploadObject(ctx context.Context, params *s3.PutObjectInput) (string, *error.RequestError)
+	UploadObject(ctx context.Context, params *s3.PutObjectInput, headers map[string]string) (string, *error.RequestError)
 	DownloadObject(ctx context.Context, params *s3.GetObjectInput) (string, *error.RequestError)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput) (*s3.HeadObjectOutput, *error.RequestError)
+	GetObject(ctx context.Context, params *s3.GetObjectInput) (*s3.GetObjectOutput, *error.RequestError)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput) (*s3.CopyObjectOutput, *error.RequestError)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, *error.RequestError)
+	UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, *error.RequestError)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, *error.RequestError)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput) *error.RequestError
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput) *error.RequestError
 }
 
 // NewS3Driver creates a new s3 driver
@@ -36,9 +48,11 @@ type s3Driver struct {
 	logger log.Logger
 }
 
-func (a *s3Driver) UploadObject(ctx context.Context, params *s3.PutObjectInput) (string, *error.RequestError) {
+// UploadObject presigns a put of the object. The headers are part of the signature,
+// so the client has to send them with the upload and S3 enforces them (e.g. If-None-Match)
+func (a *s3Driver) UploadObject(ctx context.Context, params *s3.PutObjectInput, headers map[string]string) (string, *error.RequestError) {
 	pc := s3.NewPresignClient(a.client)
-	presignedURL, err := pc.PresignPutObject(ctx, params, s3.WithPresignExpires(time.Minute*15))
+	presignedURL, err := pc.PresignPutObject(ctx, params, s3.WithPresignExpires(time.Minute*15), withSignedHeaders(headers))
 	if err != nil {
 		return "", error.NewRequestError(err, error.InternalServerError, "failed to upload object", a.logger)
 	}
@@ -56,12 +70,98 @@ func (a *s3Driver) DownloadObject(ctx context.Context, params *s3.GetObjectInput
 	return presignedURL.URL, nil
 }
 
+// HeadObject returns the metadata of an object, or a NotFoundError if it does not exist
+func (a *s3Driver) HeadObject(ctx context.Context, params *s3.HeadObjectInput) (*s3.HeadObjectOutput, *error.RequestError) {
+	res, err := a.client.HeadObject(ctx, params)
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, error.NewRequestError(err, error.NotFoundError, "object not found", a.logger)
+		}
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to get object", a.logger)
+	}
+
+	return res, nil
+}
+
+// GetObject reads an object through the API, the caller has to close the body.
+// Clients download through DownloadObject, this is for the API's own background work
+func (a *s3Driver) GetObject(ctx context.Context, params *s3.GetObjectInput) (*s3.GetObjectOutput, *error.RequestError) {
+	res, err := a.client.GetObject(ctx, params)
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, error.NewRequestError(err, error.NotFoundError, "object not found", a.logger)
+		}
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to get object", a.logger)
+	}
+
+	return res, nil
+}
+
+// CopyObject copies an object inside the bucket on the S3 side, the content never goes through the API
+func (a *s3Driver) CopyObject(ctx context.Context, params *s3.CopyObjectInput) (*s3.CopyObjectOutput, *error.RequestError) {
+	res, err := a.client.CopyObject(ctx, params)
+	if err != nil {
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to copy object", a.logger)
+	}
+
+	return res, nil
+}
+
+// CreateMultipartUpload starts a multipart upload, objects over 5 GB are copied part by part with UploadPartCopy
+func (a *s3Driver) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, *error.RequestError) {
+	res, err := a.client.CreateMultipartUpload(ctx, params)
+	if err != nil {
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to start multipart upload", a.logger)
+	}
+
+	return res, nil
+}
+
+// UploadPartCopy copies a byte range of an object into a part of a multipart upload on the S3 side
+func (a *s3Driver) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, *error.RequestError) {
+	res, err := a.client.UploadPartCopy(ctx, params)
+	if err != nil {
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to copy part", a.logger)
+	}
+
+	return res, nil
+}
+
+// CompleteMultipartUpload assembles the parts of a multipart upload into the object
+func (a *s3Driver) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, *error.RequestError) {
+	res, err := a.client.CompleteMultipartUpload(ctx, params)
+	if err != nil {
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to complete multipart upload", a.logger)
+	}
+
+	return res, nil
+}
+
+// AbortMultipartUpload discards a multipart upload and the parts stored for it
+func (a *s3Driver) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput) *error.RequestError {
+	if _, err := a.client.AbortMultipartUpload(ctx, params); err != nil {
+		return error.NewRequestError(err, error.InternalServerError, "failed to abort multipart upload", a.logger)
+	}
+
+	return nil
+}
+
+// DeleteObject removes an object, deleting a key that does not exist succeeds
+func (a *s3Driver) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput) *error.RequestError {
+	if _, err := a.client.DeleteObject(ctx, params); err != nil {
+		return error.NewRequestError(err, error.InternalServerError, "failed to delete object", a.logger)
+	}
+
+	return nil
+}
+
 func (a *s3Driver) ListObjects(ctx context.Context, params *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, *error.RequestError) {
 	res, err := a.client.ListObjectsV2(ctx, params)
 	if err != nil {
-		fmt.Println(err)
 		// check if error is a context error
-		if err.Error() == context.Canceled.Error() {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return nil, error.NewRequestError(err, error.BadRequestError, "request timed out", a.logger)
 		}
 		return nil, error.NewRequestError(err, error.InternalServerError, "failed to list objects", a.logger)
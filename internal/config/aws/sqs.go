@@ -0,0 +1,71 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_config "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// SQSDriver is the interface for a single sqs queue
+type SQSDriver interface {
+	Receive(ctx context.Context) ([]types.QueueMessage, *error.RequestError)
+	Delete(ctx context.Context, receiptHandle string) *error.RequestError
+}
+
+// NewSQSDriver creates a new sqs driver reading from the queue at queueURL
+func NewSQSDriver(logger log.Logger, queueURL string) SQSDriver {
+	cfg, err := aws_config.LoadDefaultConfig(context.Background(), aws_config.WithRegion("us-east-1"), aws_config.WithSharedConfigProfile("default"))
+	if err != nil {
+		panic(err)
+	}
+
+	return &sqsDriver{
+		client:   sqs.NewFromConfig(cfg),
+		queueURL: queueURL,
+		logger:   logger,
+	}
+}
+
+type sqsDriver struct {
+	client   *sqs.Client
+	queueURL string
+	logger   log.Logger
+}
+
+// Receive long polls the queue for up to 20 seconds
+func (a *sqsDriver) Receive(ctx context.Context) ([]types.QueueMessage, *error.RequestError) {
+	res, err := a.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            &a.queueURL,
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+	})
+	if err != nil {
+		return nil, error.NewRequestError(err, error.InternalServerError, "failed to receive messages", a.logger)
+	}
+
+	messages := make([]types.QueueMessage, 0, len(res.Messages))
+	for _, message := range res.Messages {
+		messages = append(messages, types.QueueMessage{
+			ID:            aws.ToString(message.MessageId),
+			ReceiptHandle: aws.ToString(message.ReceiptHandle),
+			Body:          aws.ToString(message.Body),
+		})
+	}
+	return messages, nil
+}
+
+func (a *sqsDriver) Delete(ctx context.Context, receiptHandle string) *error.RequestError {
+	_, err := a.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &a.queueURL,
+		ReceiptHandle: &receiptHandle,
+	})
+	if err != nil {
+		return error.NewRequestError(err, error.InternalServerError, "failed to delete message", a.logger)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package db opens the database used to keep the API's own state.
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	_ "modernc.org/sqlite"
+)
+
+// NewDB opens the database configured by the DB_URI environment variable
+func NewDB(logger log.Logger) *sql.DB {
+	db, err := Open(config.EnvVars.Get(config.DB_URI))
+	if err != nil {
+		panic(err)
+	}
+
+	logger.Info("Connected to database")
+	return db
+}
+
+// Open opens the database at uri. SQLite is the default and only supported driver,
+// uri can be a plain file path, a file: URI, a sqlite:// URI or :memory:
+func Open(uri string) (*sql.DB, error) {
+	path := uri
+	switch {
+	case strings.HasPrefix(uri, "sqlite://"):
+		path = strings.TrimPrefix(uri, "sqlite://")
+	case strings.HasPrefix(uri, "sqlite3://"):
+		path = strings.TrimPrefix(uri, "sqlite3://")
+	case strings.Contains(uri, "://"):
+		return nil, fmt.Errorf("unsupported database uri: %s", uri)
+	}
+
+	// Wait for locks instead of failing straight away and let readers work while a write is in progress
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Set("_txlock", "immediate")
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	db, err := sql.Open("sqlite", path+separator+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -40,6 +40,44 @@ const (
 
 	// COGNITO_JWKS_URL specifies the jwks url for cognito
 	COGNITO_JWKS_URL = "COGNITO_JWKS_URL"
+
+	// RECONCILE_INTERVAL specifies how often the metadata index is compared with the bucket, e.g. 1h
+	// Optional, defaults to 6h
+	RECONCILE_INTERVAL = "RECONCILE_INTERVAL"
+
+	// EVENTS_QUEUE_URL specifies the sqs queue receiving the bucket event notifications
+	// Optional, the queue is not consumed when it is not set
+	EVENTS_QUEUE_URL = "EVENTS_QUEUE_URL"
+
+	// EVENTS_WEBHOOK_SECRET specifies the shared secret of the event notification webhook
+	// Optional, the webhook is disabled when it is not set
+	EVENTS_WEBHOOK_SECRET = "EVENTS_WEBHOOK_SECRET"
+
+	// CONTENT_INDEX_INTERVAL specifies how often text documents missing from the full-text index are indexed, e.g. 30m
+	// Optional, defaults to 1h
+	CONTENT_INDEX_INTERVAL = "CONTENT_INDEX_INTERVAL"
+
+	// ROLE_PERMISSIONS specifies the permissions of each Cognito group, e.g. parents=browse,upload;guests=browse
+	// Optional, the groups it lists replace the built-in mapping of that group
+	ROLE_PERMISSIONS = "ROLE_PERMISSIONS"
+
+	// KID_UPLOAD_MAX_SIZE specifies the largest file in bytes a child account can upload
+	// Optional, defaults to 100MB
+	KID_UPLOAD_MAX_SIZE = "KID_UPLOAD_MAX_SIZE"
+
+	// KID_UPLOAD_CATEGORIES specifies the comma separated file categories child accounts can upload, e.g. images,videos
+	// Optional, defaults to images, videos, audio and documents
+	KID_UPLOAD_CATEGORIES = "KID_UPLOAD_CATEGORIES"
+
+	// QUOTA_USER_BYTES and QUOTA_USER_OBJECTS specify the default quota of each user's space
+	// Optional, no limit when not set. Quotas need EVENTS_QUEUE_URL or EVENTS_WEBHOOK_SECRET
+	QUOTA_USER_BYTES   = "QUOTA_USER_BYTES"
+	QUOTA_USER_OBJECTS = "QUOTA_USER_OBJECTS"
+
+	// QUOTA_HOUSEHOLD_BYTES and QUOTA_HOUSEHOLD_OBJECTS specify the default quota of the whole drive
+	// Optional, no limit when not set. Quotas need EVENTS_QUEUE_URL or EVENTS_WEBHOOK_SECRET
+	QUOTA_HOUSEHOLD_BYTES   = "QUOTA_HOUSEHOLD_BYTES"
+	QUOTA_HOUSEHOLD_OBJECTS = "QUOTA_HOUSEHOLD_OBJECTS"
 )
 
 var (
@@ -125,3 +163,12 @@ func (e *EnvConfig) Get(key string) string {
 
 	return e.env[key]
 }
+
+// GetOrDefault returns the value of an optional environment variable, or def if it is not set
+func (e *EnvConfig) GetOrDefault(key string, def string) string {
+	if e.env[key] == "" {
+		return def
+	}
+
+	return e.env[key]
+}
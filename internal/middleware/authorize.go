@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// DefaultRole is the role of the members who are in none of the groups of the mapping, they can only browse
+const DefaultRole = "default"
+
+// Roles maps Cognito groups to the actions their members are allowed to perform
+type Roles map[string][]types.Action
+
+// DefaultRoles is the built-in mapping, ROLE_PERMISSIONS can replace the entry of any group
+var DefaultRoles = Roles{
+	types.GroupAdmins:  types.Actions,
+	types.GroupParents: {types.ActionBrowse, types.ActionUpload, types.ActionShare, types.ActionManageAccess},
+	types.GroupKids:    {types.ActionBrowse, types.ActionUpload},
+	types.GroupGuests:  {types.ActionBrowse},
+	DefaultRole:        {types.ActionBrowse},
+}
+
+// roles is the mapping used by RequirePermission
+var roles = mustLoadRoles()
+
+// ParseRoles parses a mapping written as group=action,action;group=action.
+// "*" stands for every action and an empty list gives the group no action at all
+func ParseRoles(value string) (Roles, error) {
+	parsed := make(Roles)
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		group, list, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("expected group=action,action, got %q", entry)
+		}
+
+		actions := make([]types.Action, 0)
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case name == "":
+				continue
+			case name == "*":
+				actions = append(actions, types.Actions...)
+			case isAction(types.Action(name)):
+				actions = append(actions, types.Action(name))
+			default:
+				return nil, fmt.Errorf("unknown action %q for group %s", name, group)
+			}
+		}
+		parsed[group] = actions
+	}
+	return parsed, nil
+}
+
+// Allows returns true if one of the groups allows the action.
+// Members of none of the mapped groups get the actions of the default role
+func (r Roles) Allows(groups []string, action types.Action) bool {
+	for _, allowed := range r.Actions(groups) {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Actions returns every action the groups allow, in the order of types.Actions
+func (r Roles) Actions(groups []string) []types.Action {
+	allowed := make(map[types.Action]bool)
+	mapped := false
+	for _, group := range groups {
+		if actions, ok := r[group]; ok && group != DefaultRole {
+			mapped = true
+			for _, action := range actions {
+				allowed[action] = true
+			}
+		}
+	}
+	if !mapped {
+		for _, action := range r[DefaultRole] {
+			allowed[action] = true
+		}
+	}
+
+	actions := make([]types.Action, 0, len(allowed))
+	for _, action := range types.Actions {
+		if allowed[action] {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// Allows returns true if the groups of the user allow the action
+func Allows(user *types.User, action types.Action) bool {
+	return user != nil && roles.Allows(user.Groups, action)
+}
+
+// ProfileFromContext returns the user of an authenticated request along with the actions they can perform
+func ProfileFromContext(r *http.Request) *types.Profile {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		return nil
+	}
+	return &types.Profile{User: *user, Permissions: roles.Actions(user.Groups)}
+}
+
+// RequirePermission only lets requests through when the groups of the user allow the action.
+// It goes after AuthMiddlware and answers with a 403 naming the missing permission otherwise
+func RequirePermission(action types.Action) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := UserFromContext(r.Context())
+			if user == nil {
+				api_error.HandleError(w, r, api_error.NewRequestError(nil, api_error.UnauthorizedError, "unauthorized", nil))
+				return
+			}
+			if !roles.Allows(user.Groups, action) {
+				msg := fmt.Sprintf("the %s permission is required and none of your groups grants it", action)
+				api_error.HandleError(w, r, api_error.NewRequestError(nil, api_error.ForbiddenError, msg, nil).WithDetails(map[string]interface{}{
+					"permission": action,
+					"groups":     user.Groups,
+				}))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mustLoadRoles applies ROLE_PERMISSIONS over the built-in mapping
+func mustLoadRoles() Roles {
+	loaded := make(Roles)
+	for group, actions := range DefaultRoles {
+		loaded[group] = actions
+	}
+	overrides, err := ParseRoles(config.EnvVars.GetOrDefault(config.ROLE_PERMISSIONS, ""))
+	if err != nil {
+		panic(fmt.Sprintf("invalid %s: %s", config.ROLE_PERMISSIONS, err))
+	}
+	for group, actions := range overrides {
+		loaded[group] = actions
+	}
+	return loaded
+}
+
+func isAction(action types.Action) bool {
+	for _, known := range types.Actions {
+		if known == action {
+			return true
+		}
+	}
+	return false
+}
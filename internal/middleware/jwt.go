@@ -9,6 +9,7 @@ import (
 
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config"
 	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
 	"github.com/MicahParks/keyfunc/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -29,6 +30,11 @@ type Token struct {
 	Roles         []string `json:"cognito:roles"`
 	ID            string   `json:"sub"`
 	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
 }
 
 // AuthMiddlware is the middleware for authenticating requests
@@ -68,6 +74,25 @@ func AuthMiddlware(handler http.Handler) http.Handler {
 	})
 }
 
+// UserFromContext returns the user of an authenticated request, or nil if the request was not authenticated
+func UserFromContext(ctx context.Context) *types.User {
+	token, ok := ctx.Value(TokenKey).(*Token)
+	if !ok || token == nil {
+		return nil
+	}
+	return &types.User{
+		ID:            token.ID,
+		Username:      token.Username,
+		Email:         token.Email,
+		EmailVerified: token.EmailVerified,
+		Name:          token.Name,
+		Picture:       token.Picture,
+		GivenName:     token.GivenName,
+		FamilyName:    token.FamilyName,
+		Groups:        token.Groups,
+	}
+}
+
 func getTokenObject(validToken *jwt.Token) (*Token, error) {
 	var tokenObj Token
 	claims, ok := validToken.Claims.(jwt.MapClaims)
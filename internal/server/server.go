@@ -1,12 +1,32 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config"
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/db"
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/acl"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/activity"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/auth"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/dropboxes"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/events"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/favorites"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/fulltext"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/locks"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/notifications"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/quotas"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/s3"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/shares"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -26,8 +46,8 @@ func Build(logger log.Logger) *chi.Mux {
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", s3.SharePasswordHeader},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -36,13 +56,133 @@ func Build(logger log.Logger) *chi.Mux {
 
 	// Handlers
 	r.Mount("/auth", auth.Routes(auth.NewController(logger)))
-	r.Mount("/s3", s3.Routes(s3.NewController(logger, aws.NewS3Driver(logger))))
+	s3Driver := aws.NewS3Driver(logger)
+	database := db.NewDB(logger)
+	metadata := buildIndex(logger, database, s3Driver)
+	textStore := fulltext.NewStore(logger, database)
+	contentIndexer := buildContentIndex(logger, textStore, metadata, s3Driver)
+	queueURL := config.EnvVars.GetOrDefault(config.EVENTS_QUEUE_URL, "")
+	secret := config.EnvVars.GetOrDefault(config.EVENTS_WEBHOOK_SECRET, "")
+	eventSource := queueURL != "" || secret != ""
+	s3Controller := s3.NewController(logger, s3.Deps{
+		S3:            s3Driver,
+		Metadata:      metadata,
+		Locks:         locks.NewStore(logger, database),
+		FullText:      textStore,
+		Activity:      activity.NewStore(logger, database),
+		Favorites:     favorites.NewStore(logger, database),
+		ACL:           acl.NewStore(logger, database),
+		Quotas:        quotas.NewStore(logger, database, quotaDefaults(eventSource)),
+		Shares:        shares.NewStore(logger, database),
+		DropBoxes:     dropboxes.NewStore(logger, database),
+		Notifications: notifications.NewStore(logger, database),
+		Kids:          kidPolicy(),
+		Events:        eventSource,
+	})
+	r.Mount("/s3", s3.Routes(s3Controller))
+	r.Mount("/share", s3.ShareRoutes(s3Controller))
+	r.Mount("/drop", s3.DropBoxRoutes(s3Controller))
+
+	// Bucket event notifications
+	consumer := events.NewConsumer(logger, aws.BucketName, events.NewIndexHandler(metadata), s3Controller, contentIndexer)
+	if queueURL != "" {
+		go consumer.Run(context.Background(), aws.NewSQSDriver(logger, queueURL))
+	}
+	if secret != "" {
+		r.Mount("/events", events.Routes(consumer, secret))
+	}
 
 	// Print routes
 	printEstablishedRoutes(r, logger)
 	return r
 }
 
+// buildIndex opens the metadata index and keeps it in line with the bucket in the background.
+// The index is built from scratch the first time the server starts
+func buildIndex(logger log.Logger, database *sql.DB, s3Driver aws.S3Driver) index.Index {
+	metadata := index.NewIndex(logger, database)
+	interval, err := time.ParseDuration(config.EnvVars.GetOrDefault(config.RECONCILE_INTERVAL, "6h"))
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		ctx := context.Background()
+		if !metadata.Ready(ctx) {
+			if _, err := metadata.Rebuild(ctx, s3Driver, aws.BucketName); err != nil {
+				logger.Error("Error while building the index: ", err.Error())
+			}
+		}
+		index.NewReconciler(logger, metadata, s3Driver, aws.BucketName).Run(ctx, interval)
+	}()
+	return metadata
+}
+
+// buildContentIndex keeps the full-text index of the text documents in the bucket up to date in the background
+func buildContentIndex(logger log.Logger, store fulltext.Store, metadata index.Index, s3Driver aws.S3Driver) *fulltext.Indexer {
+	interval, err := time.ParseDuration(config.EnvVars.GetOrDefault(config.CONTENT_INDEX_INTERVAL, "1h"))
+	if err != nil {
+		panic(err)
+	}
+
+	indexer := fulltext.NewIndexer(logger, store, metadata, s3Driver, aws.BucketName)
+	go indexer.Run(context.Background(), interval)
+	return indexer
+}
+
+// quotaDefaults reads the default storage quotas, zero is unlimited. Quotas need an event source
+func quotaDefaults(eventSource bool) quotas.Defaults {
+	defaults := quotas.Defaults{
+		User: types.Quota{
+			MaxBytes:   envInt(config.QUOTA_USER_BYTES),
+			MaxObjects: envInt(config.QUOTA_USER_OBJECTS),
+		},
+		Household: types.Quota{
+			MaxBytes:   envInt(config.QUOTA_HOUSEHOLD_BYTES),
+			MaxObjects: envInt(config.QUOTA_HOUSEHOLD_OBJECTS),
+		},
+	}
+	// Only the arrival of an upload gives back the room it held under the quotas
+	limited := defaults.User.MaxBytes > 0 || defaults.User.MaxObjects > 0 || defaults.Household.MaxBytes > 0 || defaults.Household.MaxObjects > 0
+	if limited && !eventSource {
+		panic(fmt.Sprintf("storage quotas need bucket events, set %s or %s", config.EVENTS_QUEUE_URL, config.EVENTS_WEBHOOK_SECRET))
+	}
+	return defaults
+}
+
+// envInt reads an optional non negative number, zero when it is not set
+func envInt(key string) int64 {
+	value := config.EnvVars.GetOrDefault(key, "0")
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		panic(fmt.Sprintf("%s must be a positive number", key))
+	}
+	return n
+}
+
+// kidPolicy reads the upload limits of child accounts
+func kidPolicy() s3.KidPolicy {
+	policy := s3.DefaultKidPolicy
+	if value := config.EnvVars.GetOrDefault(config.KID_UPLOAD_MAX_SIZE, ""); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			panic(fmt.Sprintf("%s must be a positive number of bytes", config.KID_UPLOAD_MAX_SIZE))
+		}
+		policy.MaxUploadSize = size
+	}
+	if value := config.EnvVars.GetOrDefault(config.KID_UPLOAD_CATEGORIES, ""); value != "" {
+		policy.Categories = nil
+		for _, name := range strings.Split(value, ",") {
+			category, ok := types.ParseCategory(strings.TrimSpace(name))
+			if !ok {
+				panic(fmt.Sprintf("unknown category in %s: %s", config.KID_UPLOAD_CATEGORIES, name))
+			}
+			policy.Categories = append(policy.Categories, category)
+		}
+	}
+	return policy
+}
+
 func rootRoute(w http.ResponseWriter, r *http.Request) {
 	message := struct {
 		Message string `json:"message"`
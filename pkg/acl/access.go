@@ -0,0 +1,63 @@
+package acl
+
+import (
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Allows returns true if the user holds perm on key, what administrators hold aside. Child accounts only
+// hold what their parents approved, otherwise the grants decide and without one the defaults of the space apply
+func (r Rules) Allows(user *types.User, key string, perm types.Permission) bool {
+	if user == nil {
+		return false
+	}
+	if user.IsKid() {
+		return r.kidAllows(user, key, perm)
+	}
+	if allowed, decided := r.Decide(user, key, perm); decided {
+		return allowed
+	}
+	return defaultAllows(user, key, perm)
+}
+
+// kidAllows returns the permissions of a child account. Kids read and write their own folder and only
+// read the folders a parent approved with a grant. Folders above an approved one can be listed so they can
+// be reached, the listing only shows the way down
+func (r Rules) kidAllows(user *types.User, key string, perm types.Permission) bool {
+	own := types.KidPrefix(user)
+	if strings.HasPrefix(key, own) {
+		return types.PermissionWrite.Includes(perm)
+	}
+	if perm != types.PermissionRead {
+		return false
+	}
+	if allowed, decided := r.Decide(user, key, perm); decided {
+		return allowed
+	}
+	if !strings.HasSuffix(key, "/") {
+		return false
+	}
+	if strings.HasPrefix(own, key) {
+		return true
+	}
+	for _, grant := range r {
+		if len(grant.Path) > len(key) && strings.HasPrefix(grant.Path, key) && !grant.Deny && grant.AppliesTo(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultAllows returns the permissions users hold without any grant: everything in their home,
+// reading and writing in the family space. Parents also manage the family space, so they can
+// approve its folders for the child accounts
+func defaultAllows(user *types.User, key string, perm types.Permission) bool {
+	switch {
+	case strings.HasPrefix(key, types.HomePrefix(user.ID)):
+		return true
+	case strings.HasPrefix(key, types.FamilyPrefix):
+		return user.IsParent() || types.PermissionWrite.Includes(perm)
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package acl
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db)
+}
+
+func TestParentApprovesFolderForKid(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	parent := &types.User{ID: "parent", Groups: []string{types.GroupParents}}
+	adult := &types.User{ID: "adult"}
+	kid := &types.User{ID: "kid", Username: "lia", Groups: []string{types.GroupKids}}
+
+	covering := func(prefix string) Rules {
+		t.Helper()
+		rules, err := store.Covering(ctx, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rules
+	}
+
+	rules := covering("family/Photos/")
+	if !rules.Allows(parent, "family/Photos/", types.PermissionManage) {
+		t.Fatal("parents should manage the folders of the family space")
+	}
+	if rules.Allows(adult, "family/Photos/", types.PermissionManage) {
+		t.Fatal("only parents should manage the family space without a grant")
+	}
+	if rules.Allows(kid, "family/Photos/", types.PermissionRead) {
+		t.Fatal("kids should not read a folder before it is approved")
+	}
+
+	if err := store.Put(ctx, types.Grant{
+		Path:          "family/Photos/",
+		PrincipalType: types.PrincipalGroup,
+		Principal:     types.GroupKids,
+		Permission:    types.PermissionRead,
+		CreatedBy:     parent.ID,
+		CreatedAt:     time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules = covering("family/")
+	tests := []struct {
+		key  string
+		perm types.Permission
+		want bool
+	}{
+		// The root of the family space only shows the way down to the approved folder
+		{key: "family/", perm: types.PermissionRead, want: true},
+		{key: "family/budget.xlsx", perm: types.PermissionRead, want: false},
+		{key: "family/Taxes/", perm: types.PermissionRead, want: false},
+		{key: "family/Photos/", perm: types.PermissionRead, want: true},
+		{key: "family/Photos/2023/", perm: types.PermissionRead, want: true},
+		{key: "family/Photos/2023/beach.jpg", perm: types.PermissionRead, want: true},
+		{key: "family/Photos/", perm: types.PermissionWrite, want: false},
+		{key: "family/Kids/lia/drawing.png", perm: types.PermissionWrite, want: true},
+	}
+	for _, test := range tests {
+		if got := rules.Allows(kid, test.key, test.perm); got != test.want {
+			t.Errorf("Allows(kid, %s, %s) = %t, want %t", test.key, test.perm, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package acl
+
+import (
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Rules are the grants covering part of the drive, loaded once and evaluated in memory
+type Rules []types.Grant
+
+// Decide returns whether the grants allow the user perm on key. Grants are inherited down the tree
+// and the grant set closest to key wins, on the same folder a deny wins over an allow.
+// decided is false when no grant covering key says anything about perm
+func (r Rules) Decide(user *types.User, key string, perm types.Permission) (allowed bool, decided bool) {
+	closest := -1
+	for _, grant := range r {
+		if !strings.HasPrefix(key, grant.Path) || !grant.AppliesTo(user) {
+			continue
+		}
+		// Denying a permission also denies everything including it, allowing one allows everything it includes
+		if grant.Deny && !perm.Includes(grant.Permission) || !grant.Deny && !grant.Permission.Includes(perm) {
+			continue
+		}
+		switch {
+		case len(grant.Path) > closest:
+			closest = len(grant.Path)
+			allowed = !grant.Deny
+		case len(grant.Path) == closest && grant.Deny:
+			allowed = false
+		}
+	}
+	return allowed, closest >= 0
+}
+
+// Above returns the grants set on the folders above path
+func (r Rules) Above(path string) []types.Grant {
+	grants := make([]types.Grant, 0)
+	for _, grant := range r {
+		if len(grant.Path) < len(path) && strings.HasPrefix(path, grant.Path) {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
@@ -0,0 +1,138 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+func grant(path string, principalType types.PrincipalType, principal string, perm types.Permission, deny bool) types.Grant {
+	return types.Grant{Path: path, PrincipalType: principalType, Principal: principal, Permission: perm, Deny: deny}
+}
+
+func TestRulesDecide(t *testing.T) {
+	user := &types.User{ID: "ana", Groups: []string{"cousins"}}
+	tests := []struct {
+		name    string
+		rules   Rules
+		key     string
+		perm    types.Permission
+		allowed bool
+		decided bool
+	}{
+		{
+			name:  "no grants",
+			rules: Rules{},
+			key:   "family/Photos/a.jpg",
+			perm:  types.PermissionRead,
+		},
+		{
+			name:  "grant of someone else",
+			rules: Rules{grant("family/Photos/", types.PrincipalUser, "ben", types.PermissionRead, true)},
+			key:   "family/Photos/a.jpg",
+			perm:  types.PermissionRead,
+		},
+		{
+			name:  "grant on another folder",
+			rules: Rules{grant("family/Taxes/", types.PrincipalUser, "ana", types.PermissionRead, true)},
+			key:   "family/Photos/a.jpg",
+			perm:  types.PermissionRead,
+		},
+		{
+			name:    "allow is inherited",
+			rules:   Rules{grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, false)},
+			key:     "family/Photos/2023/a.jpg",
+			perm:    types.PermissionRead,
+			allowed: true,
+			decided: true,
+		},
+		{
+			name:    "allowing a permission allows the ones it includes",
+			rules:   Rules{grant("family/Photos/", types.PrincipalGroup, "cousins", types.PermissionManage, false)},
+			key:     "family/Photos/a.jpg",
+			perm:    types.PermissionWrite,
+			allowed: true,
+			decided: true,
+		},
+		{
+			name:  "allowing a permission says nothing of the ones including it",
+			rules: Rules{grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, false)},
+			key:   "family/Photos/a.jpg",
+			perm:  types.PermissionWrite,
+		},
+		{
+			name:    "denying a permission denies the ones including it",
+			rules:   Rules{grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, true)},
+			key:     "family/Photos/a.jpg",
+			perm:    types.PermissionManage,
+			decided: true,
+		},
+		{
+			name:  "denying a permission says nothing of the ones it includes",
+			rules: Rules{grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionWrite, true)},
+			key:   "family/Photos/a.jpg",
+			perm:  types.PermissionRead,
+		},
+		{
+			name: "deny wins over allow on the same folder",
+			rules: Rules{
+				grant("family/Photos/", types.PrincipalGroup, "cousins", types.PermissionRead, false),
+				grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, true),
+			},
+			key:     "family/Photos/a.jpg",
+			perm:    types.PermissionRead,
+			decided: true,
+		},
+		{
+			name: "deny wins over allow whatever the order",
+			rules: Rules{
+				grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, true),
+				grant("family/Photos/", types.PrincipalGroup, "cousins", types.PermissionRead, false),
+			},
+			key:     "family/Photos/a.jpg",
+			perm:    types.PermissionRead,
+			decided: true,
+		},
+		{
+			name: "allow closer to the key wins over a deny above",
+			rules: Rules{
+				grant("family/", types.PrincipalGroup, "cousins", types.PermissionRead, true),
+				grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, false),
+			},
+			key:     "family/Photos/a.jpg",
+			perm:    types.PermissionRead,
+			allowed: true,
+			decided: true,
+		},
+		{
+			name: "deny closer to the key wins over an allow above",
+			rules: Rules{
+				grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, false),
+				grant("family/Photos/Private/", types.PrincipalGroup, "cousins", types.PermissionRead, true),
+			},
+			key:     "family/Photos/Private/a.jpg",
+			perm:    types.PermissionRead,
+			decided: true,
+		},
+		{
+			name: "a closer grant about another permission leaves the one above",
+			rules: Rules{
+				grant("family/Photos/", types.PrincipalUser, "ana", types.PermissionRead, false),
+				grant("family/Photos/Private/", types.PrincipalUser, "ana", types.PermissionWrite, true),
+			},
+			key:     "family/Photos/Private/a.jpg",
+			perm:    types.PermissionRead,
+			allowed: true,
+			decided: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, decided := test.rules.Decide(user, test.key, test.perm)
+			if allowed != test.allowed || decided != test.decided {
+				t.Errorf("Decide() = %t, %t, want %t, %t", allowed, decided, test.allowed, test.decided)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package acl keeps the grants users and Cognito groups hold on folders.
+package acl
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Store is the interface for the grant store
+type Store interface {
+	// List returns the grants set on the folder at path, sorted by principal
+	List(ctx context.Context, path string) ([]types.Grant, *api_error.RequestError)
+	// Covering returns the grants set on prefix, on the folders above it and on everything under it
+	Covering(ctx context.Context, prefix string) (Rules, *api_error.RequestError)
+	// Put sets a grant, replacing the one the principal already had on the folder
+	Put(ctx context.Context, grant types.Grant) *api_error.RequestError
+	// Delete removes the grant of a principal on a folder, it returns false if there was none
+	Delete(ctx context.Context, path string, principalType types.PrincipalType, principal string) (bool, *api_error.RequestError)
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS grants (
+	path           TEXT NOT NULL,
+	principal_type TEXT NOT NULL,
+	principal      TEXT NOT NULL,
+	permission     TEXT NOT NULL,
+	deny           INTEGER NOT NULL,
+	created_by     TEXT NOT NULL,
+	created_at     INTEGER NOT NULL,
+	PRIMARY KEY (path, principal_type, principal)
+);
+`
+
+// NewStore creates the grant table if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) List(ctx context.Context, path string) ([]types.Grant, *api_error.RequestError) {
+	return s.query(ctx, `
+		SELECT path, principal_type, principal, permission, deny, created_by, created_at FROM grants
+		WHERE path = ?
+		ORDER BY principal_type, principal`,
+		path,
+	)
+}
+
+func (s *sqlStore) Covering(ctx context.Context, prefix string) (Rules, *api_error.RequestError) {
+	return s.query(ctx, `
+		SELECT path, principal_type, principal, permission, deny, created_by, created_at FROM grants
+		WHERE substr(?, 1, length(path)) = path OR substr(path, 1, length(?)) = ?
+		ORDER BY path, principal_type, principal`,
+		prefix, prefix, prefix,
+	)
+}
+
+func (s *sqlStore) Put(ctx context.Context, grant types.Grant) *api_error.RequestError {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO grants (path, principal_type, principal, permission, deny, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (path, principal_type, principal) DO UPDATE SET
+			permission = excluded.permission,
+			deny = excluded.deny,
+			created_by = excluded.created_by,
+			created_at = excluded.created_at`,
+		grant.Path, grant.PrincipalType, grant.Principal, grant.Permission, grant.Deny, grant.CreatedBy, grant.CreatedAt.UnixNano(),
+	); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to save grant", s.logger)
+	}
+	return nil
+}
+
+func (s *sqlStore) Delete(ctx context.Context, path string, principalType types.PrincipalType, principal string) (bool, *api_error.RequestError) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM grants WHERE path = ? AND principal_type = ? AND principal = ?`, path, principalType, principal)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to delete grant", s.logger)
+	}
+	count, _ := res.RowsAffected()
+	return count > 0, nil
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...interface{}) ([]types.Grant, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list grants", s.logger)
+	}
+	defer rows.Close()
+
+	grants := make([]types.Grant, 0)
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list grants", s.logger)
+		}
+		grants = append(grants, *grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list grants", s.logger)
+	}
+	return grants, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanGrant(row scanner) (*types.Grant, error) {
+	var grant types.Grant
+	var createdAt int64
+	if err := row.Scan(&grant.Path, &grant.PrincipalType, &grant.Principal, &grant.Permission, &grant.Deny, &grant.CreatedBy, &createdAt); err != nil {
+		return nil, err
+	}
+	grant.CreatedAt = time.Unix(0, createdAt).UTC()
+	return &grant, nil
+}
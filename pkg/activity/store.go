@@ -0,0 +1,250 @@
+// Package activity records what users do with the files of the drive.
+package activity
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// retention is how long downloads and uploads are remembered
+const retention = time.Hour * 24 * 90
+
+// Download is the last time a user downloaded a file
+type Download struct {
+	Key string
+	At  time.Time
+}
+
+// Entry is an upload or a download of a user
+type Entry struct {
+	Activity types.Activity
+	Key      string
+	// Size is the size of an uploaded file, zero for downloads
+	Size int64
+	At   time.Time
+	// Kid is set when the user was a child account at the time
+	Kid bool
+}
+
+// Store is the interface for the activity store
+type Store interface {
+	// RecordDownload remembers that the user downloaded the file, every download is kept.
+	// kid is set when the user is a child account
+	RecordDownload(ctx context.Context, userID string, kid bool, key string, at time.Time) *api_error.RequestError
+	// Downloads returns up to limit files the user downloaded with the time of their latest download, sorted from the latest.
+	// Only downloads before before, or at the same time of a key sorting before beforeKey, are returned.
+	// A zero before starts from the latest
+	Downloads(ctx context.Context, userID string, before time.Time, beforeKey string, limit int) ([]Download, *api_error.RequestError)
+	// ExpectUpload remembers that the user was given an upload of the file, it counts as an upload once
+	// the file arrives. kid is set when the user is a child account
+	ExpectUpload(ctx context.Context, userID string, kid bool, key string, at time.Time) *api_error.RequestError
+	// UploadArrived records the arrival of the file the latest expected upload of key was waiting for.
+	// It returns false if no upload was waiting for key
+	UploadArrived(ctx context.Context, key string, size int64, at time.Time) (bool, *api_error.RequestError)
+	// History returns up to limit uploads and downloads of the user since since, sorted from the latest
+	History(ctx context.Context, userID string, since time.Time, limit int) ([]Entry, *api_error.RequestError)
+	// Move points the downloads and uploads of a moved file at its new key.
+	// Moving a folder moves the activity of everything under it
+	Move(ctx context.Context, from string, to string) *api_error.RequestError
+	// RecordAccount remembers whether the user is a child account as of their latest request
+	RecordAccount(ctx context.Context, userID string, kid bool) *api_error.RequestError
+	// IsKid returns true if the user was a child account at their latest request,
+	// false for any other user and for a user never seen
+	IsKid(ctx context.Context, userID string) (bool, *api_error.RequestError)
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS downloads (
+	user_id       TEXT NOT NULL,
+	kid           INTEGER NOT NULL,
+	key           TEXT NOT NULL,
+	downloaded_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS downloads_user ON downloads(user_id, downloaded_at);
+CREATE INDEX IF NOT EXISTS downloads_user_key ON downloads(user_id, key, downloaded_at);
+CREATE TABLE IF NOT EXISTS uploads (
+	user_id      TEXT NOT NULL,
+	kid          INTEGER NOT NULL,
+	key          TEXT NOT NULL,
+	size         INTEGER NOT NULL,
+	requested_at INTEGER NOT NULL,
+	uploaded_at  INTEGER
+);
+CREATE INDEX IF NOT EXISTS uploads_user ON uploads(user_id, uploaded_at);
+CREATE INDEX IF NOT EXISTS uploads_key ON uploads(key);
+CREATE TABLE IF NOT EXISTS accounts (
+	user_id TEXT PRIMARY KEY,
+	kid     INTEGER NOT NULL
+);
+`
+
+// NewStore creates the activity tables if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) RecordDownload(ctx context.Context, userID string, kid bool, key string, at time.Time) *api_error.RequestError {
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO downloads (user_id, kid, key, downloaded_at) VALUES (?, ?, ?, ?)`,
+		userID, kid, key, at.UnixNano(),
+	); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to record download", s.logger)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM downloads WHERE downloaded_at < ?`, at.Add(-retention).UnixNano()); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to record download", s.logger)
+	}
+	return nil
+}
+
+func (s *sqlStore) Downloads(ctx context.Context, userID string, before time.Time, beforeKey string, limit int) ([]Download, *api_error.RequestError) {
+	query := `SELECT key, MAX(downloaded_at) AS at FROM downloads WHERE user_id = ? GROUP BY key`
+	args := []interface{}{userID}
+	if !before.IsZero() {
+		query += ` HAVING at < ? OR (at = ? AND key < ?)`
+		args = append(args, before.UnixNano(), before.UnixNano(), beforeKey)
+	}
+	query += ` ORDER BY at DESC, key DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read downloads", s.logger)
+	}
+	defer rows.Close()
+
+	downloads := make([]Download, 0)
+	for rows.Next() {
+		var download Download
+		var at int64
+		if err := rows.Scan(&download.Key, &at); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read downloads", s.logger)
+		}
+		download.At = time.Unix(0, at).UTC()
+		downloads = append(downloads, download)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read downloads", s.logger)
+	}
+	return downloads, nil
+}
+
+func (s *sqlStore) ExpectUpload(ctx context.Context, userID string, kid bool, key string, at time.Time) *api_error.RequestError {
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO uploads (user_id, kid, key, size, requested_at, uploaded_at) VALUES (?, ?, ?, 0, ?, NULL)`,
+		userID, kid, key, at.UnixNano(),
+	); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to record upload", s.logger)
+	}
+
+	// Uploads that never arrived are forgotten along with the old ones
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM uploads WHERE requested_at < ?`, at.Add(-retention).UnixNano()); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to record upload", s.logger)
+	}
+	return nil
+}
+
+func (s *sqlStore) UploadArrived(ctx context.Context, key string, size int64, at time.Time) (bool, *api_error.RequestError) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE uploads SET size = ?, uploaded_at = ?
+		WHERE rowid = (
+			SELECT rowid FROM uploads WHERE key = ? AND uploaded_at IS NULL
+			ORDER BY requested_at DESC LIMIT 1
+		)`,
+		size, at.UnixNano(), key,
+	)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to record upload", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to record upload", s.logger)
+	}
+	return affected > 0, nil
+}
+
+func (s *sqlStore) History(ctx context.Context, userID string, since time.Time, limit int) ([]Entry, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ?, key, size, uploaded_at AS at, kid FROM uploads WHERE user_id = ? AND uploaded_at >= ?
+		UNION ALL
+		SELECT ?, key, 0, downloaded_at, kid FROM downloads WHERE user_id = ? AND downloaded_at >= ?
+		ORDER BY at DESC, key
+		LIMIT ?`,
+		types.ActivityUploaded, userID, since.UnixNano(),
+		types.ActivityDownloaded, userID, since.UnixNano(),
+		limit,
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read activity", s.logger)
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		var entry Entry
+		var at int64
+		if err := rows.Scan(&entry.Activity, &entry.Key, &entry.Size, &at, &entry.Kid); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read activity", s.logger)
+		}
+		entry.At = time.Unix(0, at).UTC()
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read activity", s.logger)
+	}
+	return entries, nil
+}
+
+func (s *sqlStore) Move(ctx context.Context, from string, to string) *api_error.RequestError {
+	set, where := `key = ?`, `key = ?`
+	args := []interface{}{to, from}
+	if strings.HasSuffix(from, "/") {
+		set, where = `key = ? || substr(key, length(?) + 1)`, `substr(key, 1, length(?)) = ?`
+		args = []interface{}{to, from, from, from}
+	}
+	for _, table := range []string{"downloads", "uploads"} {
+		if _, err := s.db.ExecContext(ctx, `UPDATE `+table+` SET `+set+` WHERE `+where, args...); err != nil {
+			return api_error.NewRequestError(err, api_error.InternalServerError, "failed to move activity", s.logger)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) RecordAccount(ctx context.Context, userID string, kid bool) *api_error.RequestError {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO accounts (user_id, kid) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET kid = excluded.kid`,
+		userID, kid,
+	); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to record account", s.logger)
+	}
+	return nil
+}
+
+func (s *sqlStore) IsKid(ctx context.Context, userID string) (bool, *api_error.RequestError) {
+	var kid bool
+	err := s.db.QueryRowContext(ctx, `SELECT kid FROM accounts WHERE user_id = ?`, userID).Scan(&kid)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read account", s.logger)
+	}
+	return kid, nil
+}
@@ -8,8 +8,11 @@ import (
 
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config"
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/middleware"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 )
 
 // Routes returns the routes for the auth package
@@ -22,6 +25,7 @@ func Routes(controller AuthController) *chi.Mux {
 	}
 
 	router.Get("/cognito/callback", h.CognitoCallback)
+	router.With(middleware.AuthMiddlware, middleware.RequirePermission(types.ActionBrowse)).Get("/me", h.Me)
 
 	return router
 }
@@ -31,6 +35,11 @@ type handler struct {
 	logger     log.Logger
 }
 
+// Me returns the authenticated user and the permissions their groups give them
+func (h *handler) Me(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, middleware.ProfileFromContext(r))
+}
+
 func (h *handler) CognitoCallback(w http.ResponseWriter, r *http.Request) {
 	clientUrl := config.EnvVars.Get(config.CLIENT_URL)
 	token, err := h.controller.CognitoCallback(r.URL.Query().Get("code"))
@@ -0,0 +1,381 @@
+// Package dropboxes keeps the upload links people without an account drop files into a folder with.
+package dropboxes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/shares"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/google/uuid"
+)
+
+// ReservationTTL is how long an upload that has not arrived holds its name and its place in the drop box.
+// It matches the lifetime of the presigned upload
+const ReservationTTL = time.Minute * 15
+
+// NumberedKey returns the key of a file named name dropped into the folder at prefix on the given attempt.
+// The first attempt keeps the name, the next ones number it before the extension: "photo (2).jpg"
+func NumberedKey(prefix string, name string, attempt int) string {
+	if attempt <= 1 {
+		return prefix + name
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s%s (%d)%s", prefix, strings.TrimSuffix(name, ext), attempt, ext)
+}
+
+// Store is the interface for the drop box store
+type Store interface {
+	// Create saves a new drop box and returns it along with its token, the only time the token is known
+	Create(ctx context.Context, box types.DropBox) (*types.DropBox, *api_error.RequestError)
+	// Open returns the drop box of a token. Unknown tokens are not found and expired drop boxes are gone
+	Open(ctx context.Context, token string) (*types.DropBox, *api_error.RequestError)
+	// Used returns the number of files that arrived in the drop box or are on their way
+	Used(ctx context.Context, id string) (int64, *api_error.RequestError)
+	// Reserve holds the key of an upload until it arrives or its reservation ends and returns the ID of the upload.
+	// A key reserved by another upload is a conflict and a full drop box is forbidden
+	Reserve(ctx context.Context, id string, upload types.DropUpload) (string, *api_error.RequestError)
+	// Waiting returns true if a dropped file on its way was reserved on key
+	Waiting(ctx context.Context, key string) (bool, *api_error.RequestError)
+	// Arrived marks the upload with the given ID as arrived at key and returns its drop box,
+	// or nil if that upload was not waiting for key
+	Arrived(ctx context.Context, uploadID string, key string, size int64, at time.Time) (*types.DropBox, *types.DropUpload, *api_error.RequestError)
+	// Uploads returns the files that arrived in the drop box of owner, the newest first, and marks them as seen.
+	// An empty owner reads the drop box whoever created it
+	Uploads(ctx context.Context, id string, owner string) (*types.DropBox, []types.DropUpload, *api_error.RequestError)
+	// List returns the drop boxes of owner, the newest first
+	List(ctx context.Context, owner string) ([]types.DropBox, *api_error.RequestError)
+	// Revoke deletes the drop box of owner, an empty owner revokes the drop box whoever created it.
+	// It returns false if there was no such drop box
+	Revoke(ctx context.Context, id string, owner string) (bool, *api_error.RequestError)
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS drop_boxes (
+	id            TEXT PRIMARY KEY,
+	token_hash    TEXT NOT NULL UNIQUE,
+	key           TEXT NOT NULL,
+	owner         TEXT NOT NULL,
+	owner_name    TEXT NOT NULL,
+	message       TEXT NOT NULL,
+	categories    TEXT NOT NULL,
+	created_at    INTEGER NOT NULL,
+	expires_at    INTEGER NOT NULL,
+	max_files     INTEGER NOT NULL,
+	max_file_size INTEGER NOT NULL,
+	seen_at       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS drop_boxes_owner ON drop_boxes(owner);
+CREATE TABLE IF NOT EXISTS drop_uploads (
+	box_id       TEXT NOT NULL REFERENCES drop_boxes(id) ON DELETE CASCADE,
+	id           TEXT NOT NULL,
+	key          TEXT NOT NULL,
+	size         INTEGER NOT NULL,
+	sender       TEXT NOT NULL,
+	requested_at INTEGER NOT NULL,
+	arrived_at   INTEGER,
+	PRIMARY KEY (box_id, key)
+);
+CREATE INDEX IF NOT EXISTS drop_uploads_key ON drop_uploads(key);
+`
+
+// selectBoxes reads drop boxes along with the count of their uploads
+const selectBoxes = `
+	SELECT b.id, b.key, b.owner, b.owner_name, b.message, b.categories, b.created_at, b.expires_at,
+		b.max_files, b.max_file_size, COUNT(u.arrived_at), COUNT(CASE WHEN u.arrived_at > b.seen_at THEN 1 END), MAX(u.arrived_at)
+	FROM drop_boxes b LEFT JOIN drop_uploads u ON u.box_id = b.id`
+
+// NewStore creates the drop box tables if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) Create(ctx context.Context, box types.DropBox) (*types.DropBox, *api_error.RequestError) {
+	token, err := shares.NewToken()
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to create drop box", s.logger)
+	}
+
+	box.ID = uuid.New().String()
+	box.Token = token
+	categories := make([]string, len(box.Categories))
+	for i, category := range box.Categories {
+		categories[i] = string(category)
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO drop_boxes (id, token_hash, key, owner, owner_name, message, categories, created_at, expires_at, max_files, max_file_size, seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)`,
+		box.ID, shares.HashToken(token), box.Key, box.Owner, box.OwnerName, box.Message,
+		strings.Join(categories, ","), box.CreatedAt.UnixNano(), box.ExpiresAt.UnixNano(), box.MaxFiles, box.MaxFileSize,
+	); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to create drop box", s.logger)
+	}
+	return &box, nil
+}
+
+func (s *sqlStore) Open(ctx context.Context, token string) (*types.DropBox, *api_error.RequestError) {
+	box, err := scanBox(s.db.QueryRowContext(ctx, selectBoxes+` WHERE b.token_hash = ? GROUP BY b.id`, shares.HashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, api_error.NewRequestError(nil, api_error.NotFoundError, "drop box not found", s.logger)
+	}
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to open drop box", s.logger)
+	}
+	if box.Expired(time.Now()) {
+		return nil, api_error.NewRequestError(nil, api_error.GoneError, fmt.Sprintf("the drop box closed on %s", box.ExpiresAt.Format(time.RFC1123)), s.logger)
+	}
+	return box, nil
+}
+
+func (s *sqlStore) Used(ctx context.Context, id string) (int64, *api_error.RequestError) {
+	var used int64
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM drop_uploads
+		WHERE box_id = ? AND (arrived_at IS NOT NULL OR requested_at > ?)`,
+		id, time.Now().Add(-ReservationTTL).UnixNano(),
+	).Scan(&used); err != nil {
+		return 0, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read drop box", s.logger)
+	}
+	return used, nil
+}
+
+func (s *sqlStore) Reserve(ctx context.Context, id string, upload types.DropUpload) (string, *api_error.RequestError) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve upload", s.logger)
+	}
+	defer tx.Rollback()
+
+	var expiresAt, maxFiles int64
+	err = tx.QueryRowContext(ctx, `SELECT expires_at, max_files FROM drop_boxes WHERE id = ?`, id).Scan(&expiresAt, &maxFiles)
+	if err == sql.ErrNoRows {
+		return "", api_error.NewRequestError(nil, api_error.NotFoundError, "drop box not found", s.logger)
+	}
+	if err != nil {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve upload", s.logger)
+	}
+	if upload.RequestedAt.UnixNano() >= expiresAt {
+		return "", api_error.NewRequestError(nil, api_error.GoneError, "the drop box is closed", s.logger)
+	}
+
+	cutoff := upload.RequestedAt.Add(-ReservationTTL).UnixNano()
+	var taken, used int64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM drop_uploads WHERE key = ? AND arrived_at IS NULL AND requested_at > ?`,
+		upload.Key, cutoff,
+	).Scan(&taken); err != nil {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve upload", s.logger)
+	}
+	if taken > 0 {
+		return "", api_error.NewRequestError(nil, api_error.ConflictError, "another upload is on its way with this name", s.logger)
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM drop_uploads WHERE box_id = ? AND (arrived_at IS NOT NULL OR requested_at > ?)`,
+		id, cutoff,
+	).Scan(&used); err != nil {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve upload", s.logger)
+	}
+	if maxFiles > 0 && used >= maxFiles {
+		return "", api_error.NewRequestError(nil, api_error.ForbiddenError, fmt.Sprintf("the drop box takes %d files and is full", maxFiles), s.logger)
+	}
+
+	// A file of the drop box that was deleted since can be dropped again under the same name
+	uploadID := uuid.New().String()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO drop_uploads (box_id, id, key, size, sender, requested_at, arrived_at) VALUES (?, ?, ?, ?, ?, ?, NULL)
+		ON CONFLICT (box_id, key) DO UPDATE SET
+			id = excluded.id,
+			size = excluded.size,
+			sender = excluded.sender,
+			requested_at = excluded.requested_at,
+			arrived_at = NULL`,
+		id, uploadID, upload.Key, upload.Size, upload.From, upload.RequestedAt.UnixNano(),
+	); err != nil {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve upload", s.logger)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve upload", s.logger)
+	}
+	return uploadID, nil
+}
+
+func (s *sqlStore) Waiting(ctx context.Context, key string) (bool, *api_error.RequestError) {
+	var waiting bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM drop_uploads WHERE key = ? AND arrived_at IS NULL)`, key).Scan(&waiting); err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read dropped files", s.logger)
+	}
+	return waiting, nil
+}
+
+func (s *sqlStore) Arrived(ctx context.Context, uploadID string, key string, size int64, at time.Time) (*types.DropBox, *types.DropUpload, *api_error.RequestError) {
+	upload, err := scanUpload(s.db.QueryRowContext(ctx, `
+		UPDATE drop_uploads SET size = ?, arrived_at = ?
+		WHERE id = ? AND key = ? AND arrived_at IS NULL
+		RETURNING box_id, key, size, sender, requested_at, arrived_at`,
+		size, at.UnixNano(), uploadID, key,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to record dropped file", s.logger)
+	}
+
+	box, err := scanBox(s.db.QueryRowContext(ctx, selectBoxes+` WHERE b.id = ? GROUP BY b.id`, upload.boxID))
+	if err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to record dropped file", s.logger)
+	}
+	return box, &upload.DropUpload, nil
+}
+
+func (s *sqlStore) Uploads(ctx context.Context, id string, owner string) (*types.DropBox, []types.DropUpload, *api_error.RequestError) {
+	query := selectBoxes + ` WHERE b.id = ?`
+	args := []interface{}{id}
+	if owner != "" {
+		query += ` AND b.owner = ?`
+		args = append(args, owner)
+	}
+	box, err := scanBox(s.db.QueryRowContext(ctx, query+` GROUP BY b.id`, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil, api_error.NewRequestError(nil, api_error.NotFoundError, "drop box not found", s.logger)
+	}
+	if err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list dropped files", s.logger)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT box_id, key, size, sender, requested_at, arrived_at FROM drop_uploads
+		WHERE box_id = ? AND arrived_at IS NOT NULL
+		ORDER BY arrived_at DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list dropped files", s.logger)
+	}
+	defer rows.Close()
+
+	uploads := make([]types.DropUpload, 0)
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list dropped files", s.logger)
+		}
+		uploads = append(uploads, upload.DropUpload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list dropped files", s.logger)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `UPDATE drop_boxes SET seen_at = ? WHERE id = ?`, time.Now().UnixNano(), id); err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list dropped files", s.logger)
+	}
+	return box, uploads, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, owner string) ([]types.DropBox, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, selectBoxes+` WHERE b.owner = ? GROUP BY b.id ORDER BY b.created_at DESC`, owner)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list drop boxes", s.logger)
+	}
+	defer rows.Close()
+
+	boxes := make([]types.DropBox, 0)
+	for rows.Next() {
+		box, err := scanBox(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list drop boxes", s.logger)
+		}
+		boxes = append(boxes, *box)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list drop boxes", s.logger)
+	}
+	return boxes, nil
+}
+
+func (s *sqlStore) Revoke(ctx context.Context, id string, owner string) (bool, *api_error.RequestError) {
+	query := `DELETE FROM drop_boxes WHERE id = ?`
+	args := []interface{}{id}
+	if owner != "" {
+		query += ` AND owner = ?`
+		args = append(args, owner)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to revoke drop box", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to revoke drop box", s.logger)
+	}
+	return affected > 0, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBox(row scanner) (*types.DropBox, error) {
+	var box types.DropBox
+	var categories string
+	var createdAt, expiresAt int64
+	var lastUploadAt sql.NullInt64
+	if err := row.Scan(
+		&box.ID, &box.Key, &box.Owner, &box.OwnerName, &box.Message, &categories, &createdAt, &expiresAt,
+		&box.MaxFiles, &box.MaxFileSize, &box.Uploads, &box.NewUploads, &lastUploadAt,
+	); err != nil {
+		return nil, err
+	}
+	if categories != "" {
+		for _, category := range strings.Split(categories, ",") {
+			box.Categories = append(box.Categories, types.Category(category))
+		}
+	}
+	box.CreatedAt = time.Unix(0, createdAt).UTC()
+	box.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	if lastUploadAt.Valid {
+		at := time.Unix(0, lastUploadAt.Int64).UTC()
+		box.LastUploadAt = &at
+	}
+	return &box, nil
+}
+
+// dropped is a dropped file along with its drop box
+type dropped struct {
+	types.DropUpload
+	boxID string
+}
+
+func scanUpload(row scanner) (*dropped, error) {
+	var u dropped
+	var requestedAt int64
+	var arrivedAt sql.NullInt64
+	if err := row.Scan(&u.boxID, &u.Key, &u.Size, &u.From, &requestedAt, &arrivedAt); err != nil {
+		return nil, err
+	}
+	u.RequestedAt = time.Unix(0, requestedAt).UTC()
+	if arrivedAt.Valid {
+		at := time.Unix(0, arrivedAt.Int64).UTC()
+		u.ArrivedAt = &at
+	}
+	return &u, nil
+}
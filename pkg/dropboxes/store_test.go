@@ -0,0 +1,221 @@
+package dropboxes
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db)
+}
+
+func newBox(t *testing.T, store Store, key string, expiresIn time.Duration, maxFiles int64) *types.DropBox {
+	t.Helper()
+	now := time.Now()
+	box, err := store.Create(context.Background(), types.DropBox{
+		Key:       key,
+		Owner:     "owner",
+		OwnerName: "owner",
+		CreatedAt: now,
+		ExpiresAt: now.Add(expiresIn),
+		MaxFiles:  maxFiles,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func upload(key string, at time.Time) types.DropUpload {
+	return types.DropUpload{Key: key, Size: 10, From: "grandma", RequestedAt: at}
+}
+
+func checkStatus(t *testing.T, what string, err *api_error.RequestError, want api_error.Type) {
+	t.Helper()
+	if err == nil || err.Status != want {
+		t.Errorf("%s returned %v, want a %d", what, err, want)
+	}
+}
+
+func TestNumberedKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		want    string
+	}{
+		{name: "photo.jpg", attempt: 1, want: "home/a/Drop/photo.jpg"},
+		{name: "photo.jpg", attempt: 2, want: "home/a/Drop/photo (2).jpg"},
+		{name: "archive.tar.gz", attempt: 3, want: "home/a/Drop/archive.tar (3).gz"},
+		{name: "README", attempt: 2, want: "home/a/Drop/README (2)"},
+	}
+	for _, tt := range tests {
+		if got := NumberedKey("home/a/Drop/", tt.name, tt.attempt); got != tt.want {
+			t.Errorf("NumberedKey(%q, %d) = %q, want %q", tt.name, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestReserveFull(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	box := newBox(t, store, "home/a/Drop/", time.Hour, 2)
+	now := time.Now()
+
+	for _, key := range []string{"home/a/Drop/1.jpg", "home/a/Drop/2.jpg"} {
+		if _, err := store.Reserve(ctx, box.ID, upload(key, now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := store.Reserve(ctx, box.ID, upload("home/a/Drop/3.jpg", now))
+	checkStatus(t, "reserving past the limit", err, api_error.ForbiddenError)
+
+	used, err := store.Used(ctx, box.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 2 {
+		t.Errorf("Used() = %d, want 2", used)
+	}
+
+	// An upload that never arrived gives its place back once its reservation ends
+	later := now.Add(ReservationTTL + time.Minute)
+	if _, err := store.Reserve(ctx, box.ID, upload("home/a/Drop/3.jpg", later)); err != nil {
+		t.Errorf("reserving after the reservations ended returned %v", err)
+	}
+}
+
+func TestReserveConflict(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	box := newBox(t, store, "home/a/Drop/", time.Hour, 0)
+	other := newBox(t, store, "home/a/Drop/", time.Hour, 0)
+	now := time.Now()
+
+	if _, err := store.Reserve(ctx, box.ID, upload("home/a/Drop/photo.jpg", now)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := store.Reserve(ctx, box.ID, upload("home/a/Drop/photo.jpg", now))
+	checkStatus(t, "reserving a name on its way", err, api_error.ConflictError)
+	_, err = store.Reserve(ctx, other.ID, upload("home/a/Drop/photo.jpg", now))
+	checkStatus(t, "reserving a name on its way through another drop box", err, api_error.ConflictError)
+
+	// The caller numbers the name and tries again
+	if _, err := store.Reserve(ctx, box.ID, upload(NumberedKey(box.Key, "photo.jpg", 2), now)); err != nil {
+		t.Errorf("reserving the numbered name returned %v", err)
+	}
+
+	// The name is free again once the reservation ends
+	if _, err := store.Reserve(ctx, box.ID, upload("home/a/Drop/photo.jpg", now.Add(ReservationTTL+time.Minute))); err != nil {
+		t.Errorf("reserving after the reservation ended returned %v", err)
+	}
+}
+
+func TestArrived(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	box := newBox(t, store, "home/a/Drop/", time.Hour, 0)
+	key := "home/a/Drop/photo.jpg"
+
+	id, err := store.Reserve(ctx, box.ID, upload(key, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting, err := store.Waiting(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waiting {
+		t.Error("the reserved key should be waiting")
+	}
+
+	// Another upload of the key, such as the owner's own, is not the dropped file
+	arrivedBox, _, err := store.Arrived(ctx, "another upload", key, 20, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrivedBox != nil {
+		t.Error("an upload without the ID of the dropped file was recorded as dropped")
+	}
+	_, err = store.Reserve(ctx, box.ID, upload("home/a/Drop/other.jpg", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrivedBox, _, err = store.Arrived(ctx, id, "home/a/Drop/other.jpg", 20, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrivedBox != nil {
+		t.Error("the ID of the dropped file was recorded for another key")
+	}
+
+	arrivedBox, dropped, err := store.Arrived(ctx, id, key, 20, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrivedBox == nil || arrivedBox.ID != box.ID || arrivedBox.NewUploads != 1 {
+		t.Fatalf("Arrived() = %+v", arrivedBox)
+	}
+	if dropped.Key != key || dropped.Size != 20 || dropped.From != "grandma" || dropped.ArrivedAt == nil {
+		t.Errorf("Arrived() recorded %+v", dropped)
+	}
+	if waiting, _ := store.Waiting(ctx, key); waiting {
+		t.Error("the key is still waiting once its file arrived")
+	}
+	if again, _, err := store.Arrived(ctx, id, key, 20, time.Now()); err != nil || again != nil {
+		t.Errorf("a redelivered arrival was recorded again: %+v, %v", again, err)
+	}
+
+	// Looking at the uploads marks them as seen
+	_, uploads, err := store.Uploads(ctx, box.ID, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 1 || uploads[0].Key != key {
+		t.Errorf("Uploads() = %+v", uploads)
+	}
+	boxes, err := store.List(ctx, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, listed := range boxes {
+		if listed.ID == box.ID && (listed.Uploads != 1 || listed.NewUploads != 0) {
+			t.Errorf("the drop box lists %d uploads and %d new, want 1 and 0", listed.Uploads, listed.NewUploads)
+		}
+	}
+}
+
+func TestClosedDropBox(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	box := newBox(t, store, "home/a/Drop/", -time.Minute, 0)
+
+	_, err := store.Open(ctx, box.Token)
+	checkStatus(t, "opening an expired drop box", err, api_error.GoneError)
+	_, err = store.Reserve(ctx, box.ID, upload("home/a/Drop/photo.jpg", time.Now()))
+	checkStatus(t, "reserving in an expired drop box", err, api_error.GoneError)
+	_, err = store.Reserve(ctx, "missing", upload("home/a/Drop/photo.jpg", time.Now()))
+	checkStatus(t, "reserving in an unknown drop box", err, api_error.NotFoundError)
+
+	if revoked, err := store.Revoke(ctx, box.ID, "owner"); err != nil || !revoked {
+		t.Fatalf("Revoke() = %v, %v", revoked, err)
+	}
+	_, err = store.Open(ctx, box.Token)
+	checkStatus(t, "opening a revoked drop box", err, api_error.NotFoundError)
+}
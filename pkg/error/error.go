@@ -21,6 +21,16 @@ const (
 	UnauthorizedError Type = 401
 	// ForbiddenError is the error message for forbidden errors
 	ForbiddenError Type = 403
+	// ConflictError is the error message for requests conflicting with the current state
+	ConflictError Type = 409
+	// PreconditionFailedError is the error message for requests whose preconditions do not hold
+	PreconditionFailedError Type = 412
+	// GoneError is the error message for links that expired or were used up
+	GoneError Type = 410
+	// LockedError is the error message for requests on a file locked by another user
+	LockedError Type = 423
+	// ServiceUnavailableError is the error message for features that are not ready yet
+	ServiceUnavailableError Type = 503
 )
 
 // RequestError is the error type for request errors
@@ -29,6 +39,8 @@ type RequestError struct {
 	Status Type
 	Msg    string
 	Logger log.Logger
+	// Details is optional data returned to the client along with the message
+	Details interface{}
 }
 
 func (e *RequestError) Error() string {
@@ -50,12 +62,19 @@ func NewRequestError(err error, status Type, msg string, logger log.Logger) *Req
 	}
 }
 
+// WithDetails sets the data returned to the client along with the message
+func (e *RequestError) WithDetails(details interface{}) *RequestError {
+	e.Details = details
+	return e
+}
+
 // HandleError handles the error
 func HandleError(w http.ResponseWriter, r *http.Request, err *RequestError) {
 	errObj := struct {
-		Message    string `json:"message"`
-		StatusCode int    `json:"status_code"`
-	}{Message: err.Error(), StatusCode: int(err.Status)}
+		Message    string      `json:"message"`
+		StatusCode int         `json:"status_code"`
+		Details    interface{} `json:"details,omitempty"`
+	}{Message: err.Error(), StatusCode: int(err.Status), Details: err.Details}
 
 	switch err.Status {
 	case BadRequestError:
@@ -66,9 +85,20 @@ func HandleError(w http.ResponseWriter, r *http.Request, err *RequestError) {
 		w.WriteHeader(http.StatusUnauthorized)
 	case ForbiddenError:
 		w.WriteHeader(http.StatusForbidden)
+	case ConflictError:
+		w.WriteHeader(http.StatusConflict)
+	case PreconditionFailedError:
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case GoneError:
+		w.WriteHeader(http.StatusGone)
+	case LockedError:
+		w.WriteHeader(http.StatusLocked)
+	case ServiceUnavailableError:
+		w.WriteHeader(http.StatusServiceUnavailable)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		errObj.Message = "Internal Server Error"
+		errObj.Details = nil
 	}
 
 	render.JSON(w, r, errObj)
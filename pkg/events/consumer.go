@@ -0,0 +1,177 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// receiveRetryDelay is how long the consumer waits after the queue failed to return messages
+const receiveRetryDelay = time.Second * 5
+
+// ErrStaleEvent is returned by a handler for an event older than the last one applied to its key, or delivered
+// again once it was applied. The consumer does not pass the event to the handlers after it
+var ErrStaleEvent = api_error.NewRequestError(nil, api_error.ConflictError, "stale event", nil)
+
+// Handler reacts to changes made to objects in the bucket
+type Handler interface {
+	HandleObjectEvent(ctx context.Context, event types.ObjectEvent) *api_error.RequestError
+}
+
+// Completer is a handler told once every handler applied an event
+type Completer interface {
+	CompleteObjectEvent(ctx context.Context, event types.ObjectEvent) *api_error.RequestError
+}
+
+// Consumer passes the events of S3 notifications to every handler
+type Consumer struct {
+	bucket   string
+	handlers []Handler
+	logger   log.Logger
+}
+
+// NewConsumer creates a new consumer for the notifications of bucket
+func NewConsumer(logger log.Logger, bucket string, handlers ...Handler) *Consumer {
+	return &Consumer{
+		bucket:   bucket,
+		handlers: handlers,
+		logger:   logger,
+	}
+}
+
+// Process parses a notification body and passes its events to every handler in order.
+// A stale event stops at the handler that found it stale
+func (c *Consumer) Process(ctx context.Context, body []byte) *api_error.RequestError {
+	events, err := ParseNotification(body, c.bucket)
+	if err != nil {
+		return api_error.NewRequestError(err, api_error.BadRequestError, "invalid notification", c.logger)
+	}
+
+	for _, event := range events {
+		if err := c.handle(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle passes an event to every handler, then tells the completers once all of them applied it
+func (c *Consumer) handle(ctx context.Context, event types.ObjectEvent) *api_error.RequestError {
+	for _, handler := range c.handlers {
+		err := handler.HandleObjectEvent(ctx, event)
+		if err == ErrStaleEvent {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, handler := range c.handlers {
+		if completer, ok := handler.(Completer); ok {
+			if err := completer.CompleteObjectEvent(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run receives messages from the queue until ctx is done.
+// Processed messages are deleted, messages whose handlers failed are left on the queue to be delivered again
+func (c *Consumer) Run(ctx context.Context, queue Queue) {
+	for ctx.Err() == nil {
+		messages, err := queue.Receive(ctx)
+		if err != nil {
+			c.logger.Error("Error while receiving notifications: ", err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(receiveRetryDelay):
+			}
+			continue
+		}
+
+		for _, message := range messages {
+			if err := c.Process(ctx, []byte(message.Body)); err != nil {
+				c.logger.Error("Error while processing notification ", message.ID, ": ", err.Error())
+				// A malformed message will never succeed, drop it instead of retrying forever
+				if err.Status != api_error.BadRequestError {
+					continue
+				}
+			}
+			if err := queue.Delete(ctx, message.ReceiptHandle); err != nil {
+				c.logger.Error("Error while deleting notification ", message.ID, ": ", err.Error())
+			}
+		}
+	}
+}
+
+// NewIndexHandler returns a handler applying events to the metadata index
+func NewIndexHandler(metadata index.Index) Handler {
+	return &indexHandler{metadata: metadata}
+}
+
+type indexHandler struct {
+	metadata index.Index
+}
+
+// HandleObjectEvent applies an event to the index, or returns ErrStaleEvent when it is out of order or was applied already
+func (h *indexHandler) HandleObjectEvent(ctx context.Context, event types.ObjectEvent) *api_error.RequestError {
+	// Notifications can arrive out of order or more than once. S3 orders the events of a key by their sequencer,
+	// a deleted key keeps the sequencer of its removal so a late upload event does not bring the file back
+	ordered := false
+	if event.Sequencer != "" {
+		last, err := h.metadata.Sequencer(ctx, event.Object.Key)
+		if err != nil {
+			return err
+		}
+		if last != "" {
+			if !sequencerAfter(event.Sequencer, last) {
+				return ErrStaleEvent
+			}
+			ordered = true
+		}
+	}
+	// Keys indexed by a walk of the bucket have no sequencer, fall back to the modification date
+	if !ordered {
+		existing, err := h.metadata.Get(ctx, event.Object.Key)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.LastModified.After(event.Time) {
+			return ErrStaleEvent
+		}
+	}
+
+	switch event.Type {
+	case types.ObjectCreated:
+		return h.metadata.Put(ctx, event.Object)
+	case types.ObjectRemoved:
+		return h.metadata.Delete(ctx, event.Object.Key)
+	}
+	return nil
+}
+
+// CompleteObjectEvent records the sequencer of an event once every handler applied it. An event whose
+// handlers failed is applied again when it is delivered again
+func (h *indexHandler) CompleteObjectEvent(ctx context.Context, event types.ObjectEvent) *api_error.RequestError {
+	if event.Sequencer == "" {
+		return nil
+	}
+	return h.metadata.SetSequencer(ctx, event.Object.Key, event.Sequencer)
+}
+
+// sequencerAfter returns true if the sequencer a comes after b. Sequencers are hexadecimal numbers
+// of varying length, the shorter one is padded with leading zeros before comparing
+func sequencerAfter(a string, b string) bool {
+	if len(a) < len(b) {
+		a = strings.Repeat("0", len(b)-len(a)) + a
+	} else if len(b) < len(a) {
+		b = strings.Repeat("0", len(a)-len(b)) + b
+	}
+	return strings.ToUpper(a) > strings.ToUpper(b)
+}
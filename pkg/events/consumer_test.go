@@ -0,0 +1,245 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	_ "modernc.org/sqlite"
+)
+
+const testBucket = "test-bucket"
+
+func notificationBody(eventName string, key string, size int64, eventTime time.Time, sequencer string) string {
+	return fmt.Sprintf(`{"Records":[{"eventName":%q,"eventTime":%q,"s3":{"bucket":{"name":%q},"object":{"key":%q,"size":%d,"eTag":"abc","sequencer":%q}}}]}`,
+		eventName, eventTime.Format(time.RFC3339Nano), testBucket, key, size, sequencer)
+}
+
+func newTestIndex(t *testing.T) index.Index {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return index.NewIndex(logger, db)
+}
+
+func TestParseNotification(t *testing.T) {
+	eventTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	raw := notificationBody("ObjectCreated:Put", "Photos/2024/Beach+day.jpg", 42, eventTime, "0055AED6DCD90281E5")
+
+	tests := []struct {
+		name string
+		body string
+		want []types.ObjectEvent
+	}{
+		{
+			name: "raw notification",
+			body: raw,
+			want: []types.ObjectEvent{{
+				Type:      types.ObjectCreated,
+				Object:    types.Object{Key: "Photos/2024/Beach day.jpg", Size: 42, ETag: `"abc"`, LastModified: eventTime},
+				Time:      eventTime,
+				Sequencer: "0055AED6DCD90281E5",
+			}},
+		},
+		{
+			name: "sns envelope",
+			body: fmt.Sprintf(`{"Type":"Notification","Message":%q}`, notificationBody("ObjectRemoved:Delete", "a.txt", 0, eventTime, "0055AED6DCD90281E5")),
+			want: []types.ObjectEvent{{
+				Type:      types.ObjectRemoved,
+				Object:    types.Object{Key: "a.txt"},
+				Time:      eventTime,
+				Sequencer: "0055AED6DCD90281E5",
+			}},
+		},
+		{
+			name: "test event",
+			body: `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"test-bucket"}`,
+			want: []types.ObjectEvent{},
+		},
+		{
+			name: "other bucket",
+			body: `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"other"},"object":{"key":"a.txt"}}}]}`,
+			want: []types.ObjectEvent{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNotification([]byte(tt.body), testBucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsumerRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	metadata := newTestIndex(t)
+	logger, _ := log.NewLogerForTest()
+	consumer := NewConsumer(logger, testBucket, NewIndexHandler(metadata))
+
+	queue := NewMemoryQueue()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	queue.Send(notificationBody("ObjectCreated:Put", "Photos/a.jpg", 100, start, "0055AED6DCD90281E5"))
+	queue.Send(notificationBody("ObjectCreated:Put", "Photos/b.jpg", 50, start, "0055AED6DCD90281E6"))
+	queue.Send(notificationBody("ObjectCreated:CompleteMultipartUpload", "Videos/c.mp4", 1000, start, "0055AED6DCD90281E7"))
+	queue.Send(notificationBody("ObjectRemoved:Delete", "Photos/b.jpg", 0, start.Add(time.Minute), "0055AED6DCD90281E8"))
+	// An older upload arriving late must not replace the indexed one
+	queue.Send(notificationBody("ObjectCreated:Put", "Photos/a.jpg", 999, start.Add(-time.Minute), "0055AED6DCD90281E4"))
+	// Nor bring back a deleted file, even when its event time is later than the removal
+	queue.Send(notificationBody("ObjectCreated:Put", "Photos/d.jpg", 10, start, "0055AED6DCD90281F0"))
+	queue.Send(notificationBody("ObjectRemoved:Delete", "Photos/d.jpg", 0, start, "0055AED6DCD90281F2"))
+	queue.Send(notificationBody("ObjectCreated:Put", "Photos/d.jpg", 10, start.Add(time.Minute), "0055AED6DCD90281F1"))
+	// A longer sequencer is a later event of the same key
+	queue.Send(notificationBody("ObjectCreated:Put", "Videos/c.mp4", 2000, start, "0055AED6DCD90281E7000001"))
+	queue.Send("not json")
+
+	done := make(chan struct{})
+	go func() {
+		consumer.Run(ctx, queue)
+		close(done)
+	}()
+
+	for queue.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%d messages left on the queue", queue.Len())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	cancel()
+	<-done
+
+	tests := []struct {
+		prefix  string
+		size    int64
+		objects int64
+	}{
+		{prefix: "", size: 2100, objects: 2},
+		{prefix: "Photos/", size: 100, objects: 1},
+		{prefix: "Videos/", size: 2000, objects: 1},
+	}
+	for _, tt := range tests {
+		stats, err := metadata.FolderStats(context.Background(), tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Size != tt.size || stats.Objects != tt.objects {
+			t.Errorf("folder %q has size %d and %d objects, want %d and %d", tt.prefix, stats.Size, stats.Objects, tt.size, tt.objects)
+		}
+	}
+}
+
+// recordingHandler records the events it is given, failing the first fail of them
+type recordingHandler struct {
+	events []types.ObjectEvent
+	fail   int
+}
+
+func (h *recordingHandler) HandleObjectEvent(ctx context.Context, event types.ObjectEvent) *api_error.RequestError {
+	if h.fail > 0 {
+		h.fail--
+		return api_error.NewRequestError(nil, api_error.InternalServerError, "handler failed", nil)
+	}
+	h.events = append(h.events, event)
+	return nil
+}
+
+func TestConsumerSkipsStaleEvents(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	newer := notificationBody("ObjectCreated:Put", "Photos/a.jpg", 100, start, "0055AED6DCD90281E6")
+	older := notificationBody("ObjectCreated:Put", "Photos/a.jpg", 50, start.Add(-time.Minute), "0055AED6DCD90281E5")
+
+	tests := []struct {
+		name     string
+		messages []string
+		// fail is the number of times the recording handler fails before it succeeds
+		fail int
+		want []string
+	}{
+		{name: "duplicate delivery", messages: []string{newer, newer}, want: []string{"0055AED6DCD90281E6"}},
+		{name: "out of order delivery", messages: []string{newer, older}, want: []string{"0055AED6DCD90281E6"}},
+		{name: "older event first", messages: []string{older, newer}, want: []string{"0055AED6DCD90281E5", "0055AED6DCD90281E6"}},
+		{name: "delivered again after a handler failed", messages: []string{newer, newer, newer}, fail: 1, want: []string{"0055AED6DCD90281E6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := log.NewLogerForTest()
+			metadata := newTestIndex(t)
+			recorder := &recordingHandler{fail: tt.fail}
+			consumer := NewConsumer(logger, testBucket, NewIndexHandler(metadata), recorder)
+
+			for i, message := range tt.messages {
+				err := consumer.Process(ctx, []byte(message))
+				if i < tt.fail {
+					if err == nil {
+						t.Fatal("the failing handler should fail the message")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := make([]string, len(recorder.events))
+			for i, event := range recorder.events {
+				got[i] = event.Sequencer
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("the handler after the index got %v, want %v", got, tt.want)
+			}
+			stats, err := metadata.FolderStats(ctx, "Photos/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Size != 100 {
+				t.Errorf("Photos/ has size %d, want 100", stats.Size)
+			}
+		})
+	}
+}
+
+func TestSequencerAfter(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "0055AED6DCD90281E6", b: "0055AED6DCD90281E5", want: true},
+		{a: "0055AED6DCD90281E5", b: "0055AED6DCD90281E5", want: false},
+		{a: "0055AED6DCD90281E5", b: "0055AED6DCD90281E6", want: false},
+		{a: "0055AED6DCD90281E5000001", b: "0055AED6DCD90281E5", want: true},
+		{a: "55AED6DCD90281E6", b: "0055AED6DCD90281E5", want: true},
+		{a: "0055aed6dcd90281e6", b: "0055AED6DCD90281E5", want: true},
+	}
+	for _, tt := range tests {
+		if got := sequencerAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("sequencerAfter(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
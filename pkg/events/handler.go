@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"net/http"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxNotificationSize bounds the size of a webhook body
+const maxNotificationSize = 1 << 20
+
+// Routes returns the routes for the events package.
+// Webhook calls must carry the shared secret in the X-Webhook-Secret header
+func Routes(consumer *Consumer, secret string) *chi.Mux {
+	r := chi.NewRouter()
+
+	h := &handler{
+		consumer: consumer,
+		secret:   secret,
+		logger:   log.NewLogger().With(context.Background(), "Version", "1.0.0"),
+	}
+
+	r.Post("/s3", h.ReceiveNotification)
+
+	return r
+}
+
+type handler struct {
+	consumer *Consumer
+	secret   string
+	logger   log.Logger
+}
+
+// ReceiveNotification processes a S3 notification, either raw or wrapped in an SNS envelope
+func (h *handler) ReceiveNotification(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Webhook-Secret")), []byte(h.secret)) != 1 {
+		api_error.HandleError(w, r, api_error.NewRequestError(nil, api_error.UnauthorizedError, "invalid webhook secret", h.logger))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotificationSize))
+	if err != nil {
+		api_error.HandleError(w, r, api_error.NewRequestError(err, api_error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	if err := h.consumer.Process(r.Context(), body); err != nil {
+		api_error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+// Package events keeps the API state current by consuming S3 event notifications.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// notification is the body S3 sends to queues and webhooks
+type notification struct {
+	Records []record `json:"Records"`
+	// Event is only set on the s3:TestEvent sent when notifications are configured
+	Event string `json:"Event"`
+}
+
+type record struct {
+	EventName string    `json:"eventName"`
+	EventTime time.Time `json:"eventTime"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key       string `json:"key"`
+			Size      int64  `json:"size"`
+			ETag      string `json:"eTag"`
+			Sequencer string `json:"sequencer"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// snsEnvelope wraps notifications delivered through an SNS topic
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ParseNotification returns the object events of bucket held by a notification body.
+// Bodies wrapped in an SNS envelope are unwrapped, test events and events of other buckets are ignored
+func ParseNotification(body []byte, bucket string) ([]types.ObjectEvent, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Type == "Notification" && envelope.Message != "" {
+		body = []byte(envelope.Message)
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+
+	events := make([]types.ObjectEvent, 0, len(n.Records))
+	for _, r := range n.Records {
+		if r.S3.Bucket.Name != bucket {
+			continue
+		}
+
+		var eventType types.EventType
+		switch {
+		case strings.HasPrefix(r.EventName, "ObjectCreated:"):
+			eventType = types.ObjectCreated
+		case strings.HasPrefix(r.EventName, "ObjectRemoved:"):
+			eventType = types.ObjectRemoved
+		default:
+			continue
+		}
+
+		// Keys are URL encoded with spaces sent as plus signs
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object key %q: %w", r.S3.Object.Key, err)
+		}
+
+		event := types.ObjectEvent{
+			Type:      eventType,
+			Object:    types.Object{Key: key},
+			Time:      r.EventTime,
+			Sequencer: r.S3.Object.Sequencer,
+		}
+		if eventType == types.ObjectCreated {
+			event.Object.Size = r.S3.Object.Size
+			// Listings return quoted etags, notifications do not
+			if r.S3.Object.ETag != "" {
+				event.Object.ETag = fmt.Sprintf("%q", strings.Trim(r.S3.Object.ETag, `"`))
+			}
+			// Notifications do not carry the modification date of the object, the event time is
+			// within moments of it. The reconciler compares objects by ETag and size for this reason
+			event.Object.LastModified = r.EventTime
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Queue is a SQS style queue of notification messages.
+// Received messages stay on the queue until they are deleted
+type Queue interface {
+	Receive(ctx context.Context) ([]types.QueueMessage, *api_error.RequestError)
+	Delete(ctx context.Context, receiptHandle string) *api_error.RequestError
+}
+
+// MemoryQueue is an in memory queue standing in for SQS when running locally and in tests
+type MemoryQueue struct {
+	mu       sync.Mutex
+	pending  []types.QueueMessage
+	inflight map[string]types.QueueMessage
+	next     int
+	notify   chan struct{}
+}
+
+// NewMemoryQueue creates an empty in memory queue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		inflight: make(map[string]types.QueueMessage),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Send adds a message to the queue
+func (q *MemoryQueue) Send(body string) {
+	q.mu.Lock()
+	q.next++
+	id := strconv.Itoa(q.next)
+	q.pending = append(q.pending, types.QueueMessage{ID: id, ReceiptHandle: id, Body: body})
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Receive waits for messages, returning them all, or nothing once ctx is done
+func (q *MemoryQueue) Receive(ctx context.Context) ([]types.QueueMessage, *api_error.RequestError) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			messages := q.pending
+			q.pending = nil
+			for _, message := range messages {
+				q.inflight[message.ReceiptHandle] = message
+			}
+			q.mu.Unlock()
+			return messages, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-q.notify:
+		}
+	}
+}
+
+// Delete removes a received message from the queue
+func (q *MemoryQueue) Delete(ctx context.Context, receiptHandle string) *api_error.RequestError {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, receiptHandle)
+	return nil
+}
+
+// Len returns the number of messages that were not deleted yet
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) + len(q.inflight)
+}
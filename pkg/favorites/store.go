@@ -0,0 +1,145 @@
+// Package favorites keeps the files and folders each user starred.
+package favorites
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Store is the interface for the favorites store
+type Store interface {
+	// Add stars a file, or a folder when path ends with a slash. Starring it again is a no-op
+	Add(ctx context.Context, userID string, path string) (*types.Favorite, *api_error.RequestError)
+	// Remove unstars a path, it returns false if the path was not starred
+	Remove(ctx context.Context, userID string, path string) (bool, *api_error.RequestError)
+	// List returns the paths under prefix starred by the user, sorted by path
+	List(ctx context.Context, userID string, prefix string) ([]types.Favorite, *api_error.RequestError)
+	// Move points the favorites of every user at a renamed or moved path.
+	// Moving a folder moves the favorites of everything under it
+	Move(ctx context.Context, from string, to string) *api_error.RequestError
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS favorites (
+	user_id    TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	starred_at INTEGER NOT NULL,
+	PRIMARY KEY (user_id, path)
+);
+CREATE INDEX IF NOT EXISTS favorites_path ON favorites(path);
+`
+
+// NewStore creates the favorites table if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) Add(ctx context.Context, userID string, path string) (*types.Favorite, *api_error.RequestError) {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO favorites (user_id, path, starred_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, path) DO NOTHING`,
+		userID, path, time.Now().UnixNano(),
+	); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to add favorite", s.logger)
+	}
+
+	favorite, err := scanFavorite(s.db.QueryRowContext(ctx, `SELECT path, starred_at FROM favorites WHERE user_id = ? AND path = ?`, userID, path))
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to add favorite", s.logger)
+	}
+	return favorite, nil
+}
+
+func (s *sqlStore) Remove(ctx context.Context, userID string, path string) (bool, *api_error.RequestError) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM favorites WHERE user_id = ? AND path = ?`, userID, path)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to remove favorite", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to remove favorite", s.logger)
+	}
+	return affected > 0, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, userID string, prefix string) ([]types.Favorite, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT path, starred_at FROM favorites
+		WHERE user_id = ? AND substr(path, 1, length(?)) = ?
+		ORDER BY path`,
+		userID, prefix, prefix,
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list favorites", s.logger)
+	}
+	defer rows.Close()
+
+	favorites := make([]types.Favorite, 0)
+	for rows.Next() {
+		favorite, err := scanFavorite(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list favorites", s.logger)
+		}
+		favorites = append(favorites, *favorite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list favorites", s.logger)
+	}
+	return favorites, nil
+}
+
+func (s *sqlStore) Move(ctx context.Context, from string, to string) *api_error.RequestError {
+	var err error
+	if strings.HasSuffix(from, "/") {
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE OR REPLACE favorites SET path = ? || substr(path, length(?) + 1)
+			WHERE substr(path, 1, length(?)) = ?`,
+			to, from, from, from,
+		)
+	} else {
+		_, err = s.db.ExecContext(ctx, `UPDATE OR REPLACE favorites SET path = ? WHERE path = ?`, to, from)
+	}
+	if err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to move favorites", s.logger)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFavorite(row scanner) (*types.Favorite, error) {
+	var favorite types.Favorite
+	var starredAt int64
+	if err := row.Scan(&favorite.Path, &starredAt); err != nil {
+		return nil, err
+	}
+	favorite.StarredAt = time.Unix(0, starredAt).UTC()
+	favorite.IsDir = strings.HasSuffix(favorite.Path, "/")
+	favorite.Name = favoriteName(favorite.Path)
+	return &favorite, nil
+}
+
+func favoriteName(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
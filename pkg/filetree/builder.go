@@ -0,0 +1,105 @@
+// Package filetree builds folder trees out of flat object keys.
+package filetree
+
+import (
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Builder builds a file tree out of object keys.
+// Folders are indexed by their full path so adding a key only costs one map
+// lookup per path segment instead of a scan over the siblings of every segment
+type Builder struct {
+	root    *types.Folder
+	folders map[string]*types.Folder
+}
+
+// NewBuilder creates a tree builder with an empty root folder
+func NewBuilder(name string) *Builder {
+	return &Builder{
+		root: &types.Folder{
+			Name:  name,
+			Items: make([]types.FileItem, 0),
+			IsDir: true,
+		},
+		folders: make(map[string]*types.Folder),
+	}
+}
+
+// Add inserts the object at path into the tree, creating the missing folders.
+// The size and modification date of the object are rolled up into every ancestor.
+// Keys ending with a slash are folder markers and only create folders
+func (b *Builder) Add(path string, size int64, lastModified time.Time) {
+	parent := b.root
+	b.rollUp(parent, size, lastModified)
+
+	start := 0
+	for {
+		end := strings.IndexByte(path[start:], '/')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		folder, ok := b.folders[path[:end]]
+		if !ok {
+			folder = &types.Folder{
+				Name:  path[start:end],
+				Items: make([]types.FileItem, 0),
+				IsDir: true,
+			}
+			b.folders[path[:end]] = folder
+			parent.Items = append(parent.Items, folder)
+		}
+		b.rollUp(folder, size, lastModified)
+
+		parent = folder
+		start = end + 1
+	}
+
+	if start == len(path) {
+		return
+	}
+	parent.Items = append(parent.Items, &types.File{
+		Name:         path[start:],
+		Size:         size,
+		LastModified: lastModified,
+	})
+}
+
+// Root returns the root folder of the tree
+func (b *Builder) Root() *types.Folder {
+	return b.root
+}
+
+// rollUp adds the size of an object to a folder and keeps its latest modification date
+func (b *Builder) rollUp(folder *types.Folder, size int64, lastModified time.Time) {
+	folder.Size += size
+	if lastModified.After(folder.LastModified) {
+		folder.LastModified = lastModified
+	}
+}
+
+// Truncate drops the items of every folder that is depth levels below root.
+// A depth of zero or less keeps the whole tree
+func Truncate(root *types.Folder, depth int) {
+	if depth <= 0 {
+		return
+	}
+	for _, item := range root.Items {
+		folder, ok := item.(*types.Folder)
+		if !ok {
+			continue
+		}
+		if depth == 1 {
+			if len(folder.Items) > 0 {
+				folder.Items = make([]types.FileItem, 0)
+				folder.Truncated = true
+			}
+			continue
+		}
+		Truncate(folder, depth-1)
+	}
+}
@@ -0,0 +1,282 @@
+package filetree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// legacyBuildFileTree is the tree building the builder replaced, it scans the siblings of every
+// path segment. The builder must produce the same tree
+func legacyBuildFileTree(root *types.Folder, path string, size int64, lastModified time.Time) {
+	pathParts := strings.Split(path, "/")
+	fileName := pathParts[len(pathParts)-1]
+
+	for i, part := range pathParts {
+		// Skip the last part since it's the file name
+		if i == len(pathParts)-1 {
+			continue
+		}
+		if !legacyContainsFolder(root.Items, part) {
+			root.Items = append(root.Items, &types.Folder{
+				Name:         part,
+				Size:         0,
+				Items:        make([]types.FileItem, 0),
+				LastModified: time.Now(),
+				IsDir:        true,
+			})
+		}
+
+		root = legacyFindFolder(root, part)
+		// Add the size of the folder
+		root.Size += size
+	}
+
+	root.Items = append(root.Items, &types.File{
+		Name:         fileName,
+		Size:         size,
+		LastModified: lastModified,
+	})
+}
+
+func legacyFindFolder(root *types.Folder, name string) *types.Folder {
+	for _, folder := range root.Items {
+		if folder.GetName() == name {
+			return folder.(*types.Folder)
+		}
+	}
+	return nil
+}
+
+func legacyContainsFolder(folders []types.FileItem, name string) bool {
+	for _, folder := range folders {
+		if folder.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+type testObject struct {
+	key          string
+	size         int64
+	lastModified time.Time
+}
+
+func day(d int) time.Time {
+	return time.Date(2023, 10, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuilderMatchesLegacyTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []testObject
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "files at the root",
+			objects: []testObject{
+				{"a.jpg", 10, day(1)},
+				{"b.jpg", 20, day(3)},
+				{"c.jpg", 30, day(2)},
+			},
+		},
+		{
+			name: "one folder",
+			objects: []testObject{
+				{"photos/a.jpg", 10, day(1)},
+				{"photos/b.jpg", 20, day(5)},
+				{"notes.txt", 5, day(2)},
+			},
+		},
+		{
+			name: "nested folders",
+			objects: []testObject{
+				{"photos/2023/summer/a.jpg", 100, day(4)},
+				{"photos/2023/summer/b.jpg", 200, day(9)},
+				{"photos/2023/winter/c.jpg", 300, day(2)},
+				{"photos/2022/d.jpg", 400, day(1)},
+				{"photos/e.jpg", 50, day(7)},
+				{"docs/taxes/2023.pdf", 60, day(8)},
+				{"readme.md", 1, day(3)},
+			},
+		},
+		{
+			name: "same folder name at different levels",
+			objects: []testObject{
+				{"a/a/a/file.txt", 1, day(6)},
+				{"a/b/a/file.txt", 2, day(2)},
+				{"b/a/file.txt", 4, day(4)},
+				{"a/file.txt", 8, day(1)},
+			},
+		},
+		{
+			name: "keys out of order",
+			objects: []testObject{
+				{"z/y/x.txt", 3, day(1)},
+				{"a/b.txt", 5, day(9)},
+				{"z/a.txt", 7, day(5)},
+				{"z/y/w.txt", 11, day(3)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy := &types.Folder{Name: "/", Items: make([]types.FileItem, 0), IsDir: true}
+			builder := NewBuilder("/")
+			for _, obj := range tt.objects {
+				legacyBuildFileTree(legacy, obj.key, obj.size, obj.lastModified)
+				legacy.Size += obj.size
+				builder.Add(obj.key, obj.size, obj.lastModified)
+			}
+
+			got := builder.Root()
+			compareTrees(t, "/", got, legacy)
+			checkRollUp(t, "/", got)
+		})
+	}
+}
+
+func TestBuilderFolderMarkers(t *testing.T) {
+	builder := NewBuilder("/")
+	builder.Add("photos/", 0, day(1))
+	builder.Add("photos/2023/", 0, day(2))
+	builder.Add("photos/2023/a.jpg", 10, day(3))
+
+	root := builder.Root()
+	if len(root.Items) != 1 {
+		t.Fatalf("root has %d items, want 1", len(root.Items))
+	}
+	photos := root.Items[0].(*types.Folder)
+	if len(photos.Items) != 1 || photos.Items[0].GetName() != "2023" {
+		t.Fatalf("photos items = %v, want only 2023", photos.Items)
+	}
+	year := photos.Items[0].(*types.Folder)
+	if len(year.Items) != 1 || year.Items[0].GetName() != "a.jpg" {
+		t.Fatalf("2023 items = %v, want only a.jpg", year.Items)
+	}
+	if photos.Size != 10 || !photos.LastModified.Equal(day(3)) {
+		t.Errorf("photos size %d modified %s, want 10 and %s", photos.Size, photos.LastModified, day(3))
+	}
+}
+
+// compareTrees checks got has the items, order and sizes of want. The legacy folders carry
+// the time they were built at, so their modification dates are checked by checkRollUp instead
+func compareTrees(t *testing.T, path string, got, want *types.Folder) {
+	t.Helper()
+	if got.Name != want.Name || got.Size != want.Size {
+		t.Errorf("%s: got %q of %d bytes, want %q of %d bytes", path, got.Name, got.Size, want.Name, want.Size)
+	}
+	if len(got.Items) != len(want.Items) {
+		t.Fatalf("%s: got %d items, want %d", path, len(got.Items), len(want.Items))
+	}
+	for i := range want.Items {
+		switch w := want.Items[i].(type) {
+		case *types.Folder:
+			g, ok := got.Items[i].(*types.Folder)
+			if !ok {
+				t.Fatalf("%s: item %d is %T, want a folder", path, i, got.Items[i])
+			}
+			compareTrees(t, path+w.Name+"/", g, w)
+		case *types.File:
+			g, ok := got.Items[i].(*types.File)
+			if !ok {
+				t.Fatalf("%s: item %d is %T, want a file", path, i, got.Items[i])
+			}
+			if *g != *w {
+				t.Errorf("%s: got file %+v, want %+v", path, *g, *w)
+			}
+		}
+	}
+}
+
+// checkRollUp checks the size and modification date of every folder are the total and latest of
+// the files below it, and returns them
+func checkRollUp(t *testing.T, path string, folder *types.Folder) (int64, time.Time) {
+	t.Helper()
+	var size int64
+	var latest time.Time
+	for _, item := range folder.Items {
+		var s int64
+		var m time.Time
+		switch i := item.(type) {
+		case *types.Folder:
+			s, m = checkRollUp(t, path+i.Name+"/", i)
+		case *types.File:
+			s, m = i.Size, i.LastModified
+		}
+		size += s
+		if m.After(latest) {
+			latest = m
+		}
+	}
+	if folder.Size != size {
+		t.Errorf("%s: size %d, want %d", path, folder.Size, size)
+	}
+	if !folder.LastModified.Equal(latest) {
+		t.Errorf("%s: last modified %s, want %s", path, folder.LastModified, latest)
+	}
+	return size, latest
+}
+
+// syntheticKeys generates count keys spread over folders folders, each nested depth levels deep
+func syntheticKeys(count, folders, depth int) []string {
+	keys := make([]string, count)
+	for i := range keys {
+		path := ""
+		for d := 0; d < depth; d++ {
+			path += fmt.Sprintf("folder-%d-%d/", d, (i/(d+1))%folders)
+		}
+		keys[i] = fmt.Sprintf("%sfile-%d.jpg", path, i)
+	}
+	return keys
+}
+
+func benchmarkBuilder(b *testing.B, count, folders, depth int) {
+	keys := syntheticKeys(count, folders, depth)
+	lastModified := time.Date(2023, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree := NewBuilder("/")
+		for _, key := range keys {
+			tree.Add(key, 1024, lastModified)
+		}
+	}
+}
+
+// benchmarkLegacy is the baseline the builder benchmarks are compared with
+func benchmarkLegacy(b *testing.B, count, folders, depth int) {
+	keys := syntheticKeys(count, folders, depth)
+	lastModified := time.Date(2023, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root := &types.Folder{Name: "/", Items: make([]types.FileItem, 0), IsDir: true}
+		for _, key := range keys {
+			legacyBuildFileTree(root, key, 1024, lastModified)
+			root.Size += 1024
+		}
+	}
+}
+
+// Few very large folders, the worst case for scanning siblings
+func BenchmarkBuilderWide100k(b *testing.B) { benchmarkBuilder(b, 100_000, 10, 1) }
+func BenchmarkBuilderWide250k(b *testing.B) { benchmarkBuilder(b, 250_000, 10, 1) }
+func BenchmarkLegacyWide100k(b *testing.B)  { benchmarkLegacy(b, 100_000, 10, 1) }
+
+// Many sibling folders with a handful of files each
+func BenchmarkBuilderFlat100k(b *testing.B) { benchmarkBuilder(b, 100_000, 20_000, 1) }
+func BenchmarkLegacyFlat100k(b *testing.B)  { benchmarkLegacy(b, 100_000, 20_000, 1) }
+
+// Photo library style layout, several levels of nested folders
+func BenchmarkBuilderDeep100k(b *testing.B) { benchmarkBuilder(b, 100_000, 50, 5) }
+func BenchmarkLegacyDeep100k(b *testing.B)  { benchmarkLegacy(b, 100_000, 50, 5) }
@@ -0,0 +1,50 @@
+package fulltext
+
+import (
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	// MaxDocumentSize is the size above which documents are not read for indexing
+	MaxDocumentSize = 10 << 20
+	// maxTextSize caps how much text of a single document is indexed
+	maxTextSize = 1 << 20
+)
+
+// textExtensions are the extensions of the documents read as plain text
+var textExtensions = map[string]bool{
+	"txt":      true,
+	"md":       true,
+	"markdown": true,
+	"csv":      true,
+	"tsv":      true,
+	"json":     true,
+}
+
+// Indexable returns true if the text of the object can be extracted and indexed
+func Indexable(object types.Object) bool {
+	if object.IsFolderMarker() || object.Size > MaxDocumentSize {
+		return false
+	}
+	ext := types.Extension(object.Key)
+	return textExtensions[ext] || ext == "pdf"
+}
+
+// Extract returns the text of a document based on its extension.
+// Only PDFs with a text layer written with simple fonts produce text, others return an empty string
+func Extract(key string, content []byte) string {
+	var text string
+	if types.Extension(key) == "pdf" {
+		text = extractPDF(content)
+	} else {
+		text = strings.ToValidUTF8(string(content), " ")
+	}
+
+	if len(text) > maxTextSize {
+		// Do not leave half a character at the end
+		text = strings.ToValidUTF8(text[:maxTextSize], "")
+	}
+	return text
+}
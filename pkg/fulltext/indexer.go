@@ -0,0 +1,139 @@
+package fulltext
+
+import (
+	"context"
+	"io"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Indexer reads the text-like documents of the bucket into the full-text index.
+// Uploads are indexed as their event notifications arrive, a periodic sync picks up
+// whatever the notifications missed
+type Indexer struct {
+	store    Store
+	metadata index.Index
+	driver   api_aws.S3Driver
+	bucket   string
+	logger   log.Logger
+}
+
+// NewIndexer creates a new indexer for the documents of bucket
+func NewIndexer(logger log.Logger, store Store, metadata index.Index, driver api_aws.S3Driver, bucket string) *Indexer {
+	return &Indexer{
+		store:    store,
+		metadata: metadata,
+		driver:   driver,
+		bucket:   bucket,
+		logger:   logger,
+	}
+}
+
+// Run syncs the full-text index every interval until ctx is done
+func (x *Indexer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := x.Sync(ctx); err != nil && ctx.Err() == nil {
+			x.logger.Error("Error while syncing the full-text index: ", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync indexes the documents of the metadata index that are new or changed since they were
+// last indexed and drops the ones that are gone. It returns the number of documents indexed.
+// Nothing is done until the metadata index is built
+func (x *Indexer) Sync(ctx context.Context) (int, *api_error.RequestError) {
+	if !x.metadata.Ready(ctx) {
+		return 0, nil
+	}
+	objects, err := x.metadata.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	versions, err := x.store.Versions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for _, object := range objects {
+		if !Indexable(object) {
+			continue
+		}
+		etag, ok := versions[object.Key]
+		delete(versions, object.Key)
+		if ok && etag == object.ETag {
+			continue
+		}
+
+		if err := x.index(ctx, object); err != nil {
+			if ctx.Err() != nil {
+				return indexed, err
+			}
+			x.logger.Error("Error while indexing the text of ", object.Key, ": ", err.Error())
+			continue
+		}
+		indexed++
+	}
+
+	// Whatever is left was deleted or is no longer indexable
+	stale := make([]string, 0, len(versions))
+	for key := range versions {
+		stale = append(stale, key)
+	}
+	if len(stale) > 0 {
+		if err := x.store.Delete(ctx, stale...); err != nil {
+			return indexed, err
+		}
+	}
+
+	if indexed > 0 || len(stale) > 0 {
+		x.logger.Infof("Synced full-text index of %s: %d indexed, %d removed", x.bucket, indexed, len(stale))
+	}
+	return indexed, nil
+}
+
+// HandleObjectEvent indexes an uploaded document and drops a deleted one
+func (x *Indexer) HandleObjectEvent(ctx context.Context, event types.ObjectEvent) *api_error.RequestError {
+	if event.Type == types.ObjectCreated && Indexable(event.Object) {
+		return x.index(ctx, event.Object)
+	}
+	return x.store.Delete(ctx, event.Object.Key)
+}
+
+// index downloads a document and replaces its indexed text
+func (x *Indexer) index(ctx context.Context, object types.Object) *api_error.RequestError {
+	res, err := x.driver.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &x.bucket,
+		Key:    &object.Key,
+	})
+	if err != nil {
+		if err.Status == api_error.NotFoundError {
+			return x.store.Delete(ctx, object.Key)
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	content, readErr := io.ReadAll(io.LimitReader(res.Body, MaxDocumentSize))
+	if readErr != nil {
+		return api_error.NewRequestError(readErr, api_error.InternalServerError, "failed to read document", x.logger)
+	}
+
+	// Documents without text are stored too, so they are not downloaded again until they change
+	return x.store.Put(ctx, object.Key, object.ETag, Extract(object.Key, content))
+}
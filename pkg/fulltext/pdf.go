@@ -0,0 +1,266 @@
+package fulltext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxStreamSize bounds how much a single PDF stream may inflate to
+const maxStreamSize = 16 << 20
+
+// streamStart matches the stream keyword right after the dictionary of a stream. Requiring the end
+// of a dictionary keeps the keyword from matching inside endstream
+var streamStart = regexp.MustCompile(`>>[ \t\r\n]*stream\r?\n`)
+
+// extractPDF pulls the text out of the content streams of a PDF.
+// It understands uncompressed and Flate compressed streams and the text showing operators
+// (Tj, TJ, ' and "). Text drawn with embedded or CID fonts is not decoded
+func extractPDF(content []byte) string {
+	var text strings.Builder
+	for _, loc := range streamStart.FindAllIndex(content, -1) {
+		end := bytes.Index(content[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := content[loc[1] : loc[1]+end]
+
+		// The filters are in the stream dictionary, right before the stream keyword
+		dictStart := dictionaryStart(content, loc[0])
+		if dictStart < 0 {
+			continue
+		}
+		dict := content[dictStart : loc[0]+2]
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := inflate(data)
+			if err != nil {
+				continue
+			}
+			data = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// Images and other encodings never hold text
+			continue
+		}
+
+		if bytes.Contains(data, []byte("BT")) {
+			text.WriteString(contentStreamText(data))
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// dictionaryStart returns where the dictionary ending with the >> at end starts, skipping the
+// dictionaries nested in it, or -1 if it is not closed
+func dictionaryStart(content []byte, end int) int {
+	depth := 0
+	for i := end + 1; i > 0; i-- {
+		switch {
+		case content[i-1] == '>' && content[i] == '>':
+			depth++
+			i--
+		case content[i-1] == '<' && content[i] == '<':
+			depth--
+			i--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// Truncated streams still hold useful text, keep what could be read
+	inflated, err := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	if len(inflated) > 0 {
+		return inflated, nil
+	}
+	return nil, err
+}
+
+// contentStreamText runs through the operators of a content stream and collects the shown strings
+func contentStreamText(data []byte) string {
+	var text strings.Builder
+	var operands []string
+	inArray := false
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			s, next := readLiteralString(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] != '<':
+			s, next := readHexString(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(data) && (data[i] == '-' || data[i] == '.' || (data[i] >= '0' && data[i] <= '9')) {
+				i++
+			}
+			// A large negative kerning inside a TJ array is how most writers draw a space
+			if inArray {
+				if n, err := strconv.ParseFloat(string(data[start:i]), 64); err == nil && n < -200 {
+					operands = append(operands, " ")
+				}
+			}
+		case isOperatorChar(c):
+			start := i
+			for i < len(data) && isOperatorChar(data[i]) {
+				i++
+			}
+			switch string(data[start:i]) {
+			case "Tj", "TJ":
+				text.WriteString(strings.Join(operands, ""))
+			case "'", `"`:
+				text.WriteString("\n")
+				text.WriteString(strings.Join(operands, ""))
+			case "Td", "TD", "T*", "Tm":
+				text.WriteString("\n")
+			case "ET":
+				text.WriteString("\n")
+			}
+			operands = operands[:0]
+		default:
+			i++
+		}
+	}
+	return collapseBlankLines(text.String())
+}
+
+func isOperatorChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*' || c == '\'' || c == '"'
+}
+
+// readLiteralString reads a (string) starting at data[start], handling nesting and escapes
+func readLiteralString(data []byte, start int) (string, int) {
+	var s []byte
+	depth := 0
+	i := start
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodeString(s), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch e := data[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(data[i:j]), 8, 8)
+					s = append(s, byte(n))
+					i = j - 1
+				} else {
+					s = append(s, e)
+				}
+			}
+			continue
+		}
+		s = append(s, c)
+	}
+	return decodeString(s), i
+}
+
+// decodeString decodes the bytes of a PDF string, which are either UTF-16 with a byte order mark
+// or a single byte encoding that matches Latin-1 for the characters that matter
+func decodeString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(s))
+	for i, b := range s {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// readHexString reads a <hex string> starting at data[start].
+// Hex strings usually hold glyph ids rather than characters, so they are only kept when they decode to printable text
+func readHexString(data []byte, start int) (string, int) {
+	end := bytes.IndexByte(data[start:], '>')
+	if end < 0 {
+		return "", len(data)
+	}
+	digits := strings.Map(func(r rune) rune {
+		if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return r
+		}
+		return -1
+	}, string(data[start+1:start+end]))
+	if len(digits)%2 == 1 {
+		digits += "0"
+	}
+
+	s := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		n, _ := strconv.ParseUint(digits[i:i+2], 16, 8)
+		if n < 0x20 || n > 0x7e {
+			return "", start + end + 1
+		}
+		s = append(s, byte(n))
+	}
+	return string(s), start + end + 1
+}
+
+func collapseBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
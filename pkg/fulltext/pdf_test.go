@@ -0,0 +1,106 @@
+package fulltext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pdfStream returns a stream object with its dictionary entries and data
+func pdfStream(number int, dict string, data []byte) string {
+	return fmt.Sprintf("%d 0 obj\n<< /Length %d %s >>\nstream\n%s\nendstream\nendobj\n", number, len(data), dict, data)
+}
+
+// deflate compresses a content stream. Graphics state operators are added in front, short
+// data would be stored as it is rather than compressed
+func deflate(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write([]byte(strings.Repeat("q 1 0 0 1 0 0 cm Q\n", 50) + data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []string
+		want    string
+	}{
+		{
+			name:    "uncompressed stream",
+			objects: []string{pdfStream(4, "", []byte("BT /F1 12 Tf 72 712 Td (Hello World) Tj ET"))},
+			want:    "Hello World",
+		},
+		{
+			name:    "flate compressed stream",
+			objects: []string{pdfStream(4, "/Filter /FlateDecode", deflate(t, "BT /F1 12 Tf (Compressed text) Tj ET"))},
+			want:    "Compressed text",
+		},
+		{
+			name:    "decode parameters nested in the dictionary",
+			objects: []string{pdfStream(4, "/Filter /FlateDecode /DecodeParms << /Columns 4 >>", deflate(t, "BT (Nested) Tj ET"))},
+			want:    "Nested",
+		},
+		{
+			name: "every stream once",
+			objects: []string{
+				pdfStream(4, "", []byte("BT (First page) Tj ET")),
+				pdfStream(5, "", []byte("BT (Second page) Tj ET")),
+				pdfStream(6, "", []byte("BT (Third page) Tj ET")),
+			},
+			want: "First page\nSecond page\nThird page",
+		},
+		{
+			name:    "kerned array with spaces",
+			objects: []string{pdfStream(4, "", []byte("BT [(Fam)10(ily)-250(photos)] TJ ET"))},
+			want:    "Family photos",
+		},
+		{
+			name:    "next line operators",
+			objects: []string{pdfStream(4, "", []byte("BT (Line one) Tj (Line two) ' 0 -14 Td (Line three) Tj ET"))},
+			want:    "Line one\nLine two\nLine three",
+		},
+		{
+			name:    "escapes and octal codes",
+			objects: []string{pdfStream(4, "", []byte(`BT (Caf\351 \(open\)) Tj ET`))},
+			want:    "Café (open)",
+		},
+		{
+			name:    "utf-16 string",
+			objects: []string{pdfStream(4, "", []byte("BT (\xfe\xff\x00H\x00i) Tj ET"))},
+			want:    "Hi",
+		},
+		{
+			name:    "printable hex string",
+			objects: []string{pdfStream(4, "", []byte("BT <48656C6C6F> Tj ET"))},
+			want:    "Hello",
+		},
+		{
+			name:    "image streams are skipped",
+			objects: []string{pdfStream(4, "/Filter /DCTDecode", []byte("BT (not text) Tj ET"))},
+			want:    "",
+		},
+		{
+			name:    "no text",
+			objects: []string{pdfStream(4, "", []byte("0 0 m 100 100 l S"))},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "%PDF-1.4\n" + strings.Join(tt.objects, "") + "trailer\n<< /Root 1 0 R >>\n%%EOF\n"
+			if got := extractPDF([]byte(content)); got != tt.want {
+				t.Errorf("extractPDF() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
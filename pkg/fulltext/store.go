@@ -0,0 +1,242 @@
+// Package fulltext indexes the text inside documents stored in the bucket so they can be found by content.
+package fulltext
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+)
+
+// Match is a document whose text matched a search
+type Match struct {
+	Key string
+	// Snippet is the HTML escaped part of the text around the match, matched terms are wrapped in <mark> tags
+	Snippet string
+}
+
+// Matched terms are delimited with control characters the stored text never holds, so the
+// snippet can be escaped before they are turned into tags
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// markTags turns the delimiters of an escaped snippet into tags
+var markTags = strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>")
+
+// stripMarks removes the delimiters of matched terms from the text of a document
+var stripMarks = strings.NewReplacer(markStart, "", markEnd, "")
+
+// Store is the interface for the full-text index
+type Store interface {
+	// Put replaces the indexed text of a document
+	Put(ctx context.Context, key string, etag string, text string) *api_error.RequestError
+	// Delete removes documents from the index
+	Delete(ctx context.Context, keys ...string) *api_error.RequestError
+	// Versions returns the etag each indexed document was indexed at
+	Versions(ctx context.Context) (map[string]string, *api_error.RequestError)
+	// Search returns up to limit documents under prefix matching every word of query, best match first
+	Search(ctx context.Context, prefix string, query string, limit int) ([]Match, *api_error.RequestError)
+	// Move points the document of a moved file at its new key, replacing a document already there.
+	// Moving a folder moves the documents of everything under it
+	Move(ctx context.Context, from string, to string) *api_error.RequestError
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id         INTEGER PRIMARY KEY,
+	key        TEXT NOT NULL UNIQUE,
+	etag       TEXT NOT NULL,
+	indexed_at INTEGER NOT NULL
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS document_text USING fts5(body, tokenize = 'unicode61 remove_diacritics 2');
+`
+
+// NewStore creates the full-text tables if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) Put(ctx context.Context, key string, etag string, text string) *api_error.RequestError {
+	return s.withTx(ctx, "failed to update full-text index", func(tx *sql.Tx) error {
+		// The text of a document is stored with the rowid of its documents row
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM documents WHERE key = ?`, key).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			res, err := tx.ExecContext(ctx, `INSERT INTO documents (key, etag, indexed_at) VALUES (?, ?, ?)`, key, etag, time.Now().UnixNano())
+			if err != nil {
+				return err
+			}
+			if id, err = res.LastInsertId(); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if _, err := tx.ExecContext(ctx, `UPDATE documents SET etag = ?, indexed_at = ? WHERE id = ?`, etag, time.Now().UnixNano(), id); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM document_text WHERE rowid = ?`, id); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO document_text (rowid, body) VALUES (?, ?)`, id, stripMarks.Replace(text))
+		return err
+	})
+}
+
+func (s *sqlStore) Delete(ctx context.Context, keys ...string) *api_error.RequestError {
+	return s.withTx(ctx, "failed to update full-text index", func(tx *sql.Tx) error {
+		for _, key := range keys {
+			var id int64
+			err := tx.QueryRowContext(ctx, `SELECT id FROM documents WHERE key = ?`, key).Scan(&id)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM document_text WHERE rowid = ?`, id); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStore) Versions(ctx context.Context) (map[string]string, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, `SELECT key, etag FROM documents`)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read full-text index", s.logger)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]string)
+	for rows.Next() {
+		var key, etag string
+		if err := rows.Scan(&key, &etag); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read full-text index", s.logger)
+		}
+		versions[key] = etag
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read full-text index", s.logger)
+	}
+	return versions, nil
+}
+
+func (s *sqlStore) Search(ctx context.Context, prefix string, query string, limit int) ([]Match, *api_error.RequestError) {
+	matches := make([]Match, 0)
+	expression := matchExpression(query)
+	if expression == "" {
+		return matches, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.key, snippet(document_text, 0, ?, ?, '…', 16)
+		FROM document_text JOIN documents d ON d.id = document_text.rowid
+		WHERE document_text MATCH ? AND d.key >= ? AND d.key < ?
+		ORDER BY bm25(document_text)
+		LIMIT ?`,
+		markStart, markEnd, expression, prefix, prefix+"\xff", limit,
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to search full-text index", s.logger)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var match Match
+		if err := rows.Scan(&match.Key, &match.Snippet); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to search full-text index", s.logger)
+		}
+		// The text comes from the documents, it is only safe to show as HTML once escaped
+		match.Snippet = markTags.Replace(html.EscapeString(match.Snippet))
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to search full-text index", s.logger)
+	}
+	return matches, nil
+}
+
+func (s *sqlStore) Move(ctx context.Context, from string, to string) *api_error.RequestError {
+	// moved selects the documents being moved, renamed is the key each one moves to
+	moved, renamed := `key = ?`, `?`
+	args := []interface{}{from}
+	renamedArgs := []interface{}{to}
+	if strings.HasSuffix(from, "/") {
+		moved, renamed = `substr(key, 1, length(?)) = ?`, `? || substr(key, length(?) + 1)`
+		args = []interface{}{from, from}
+		renamedArgs = []interface{}{to, from}
+	}
+	return s.withTx(ctx, "failed to move full-text index", func(tx *sql.Tx) error {
+		// The documents in the way are deleted with their text first
+		replaced := `SELECT id FROM documents WHERE key IN (SELECT ` + renamed + ` FROM documents WHERE ` + moved + `)`
+		replacedArgs := append(append([]interface{}{}, renamedArgs...), args...)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM document_text WHERE rowid IN (`+replaced+`)`, replacedArgs...); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE id IN (`+replaced+`)`, replacedArgs...); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE documents SET key = `+renamed+` WHERE `+moved, append(renamedArgs, args...)...)
+		return err
+	})
+}
+
+// withTx runs fn in a transaction, rolling it back if fn fails
+func (s *sqlStore) withTx(ctx context.Context, msg string, fn func(tx *sql.Tx) error) *api_error.RequestError {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, msg, s.logger)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return api_error.NewRequestError(err, api_error.InternalServerError, msg, s.logger)
+	}
+	if err := tx.Commit(); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, msg, s.logger)
+	}
+	return nil
+}
+
+// matchExpression turns a user query into an FTS5 expression matching every word of it.
+// Words are quoted so FTS5 operators are taken literally, the last word also matches as
+// a prefix so results show up while the user is still typing
+func matchExpression(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
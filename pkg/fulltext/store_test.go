@@ -0,0 +1,133 @@
+package fulltext
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db)
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "tax", want: `"tax"*`},
+		{query: "tax return 2023", want: `"tax" "return" "2023"*`},
+		{query: "  café   crème ", want: `"café" "crème"*`},
+		{query: `tax OR "return" NEAR(x)`, want: `"tax" "OR" "return" "NEAR" "x"*`},
+		{query: "school-trip.pdf", want: `"school" "trip" "pdf"*`},
+		{query: "*** ---", want: ""},
+		{query: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := matchExpression(tt.query); got != tt.want {
+			t.Errorf("matchExpression(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	documents := map[string]string{
+		"home/a/Taxes/2023.txt":     "Tax return for 2023, the refund arrives in May",
+		"home/a/Recipes/soup.md":    "Tomato soup with basil and a pinch of salt",
+		"home/b/Taxes/2022.txt":     "Tax return for 2022",
+		"family/School/letter.pdf":  "The school trip to the museum is on Friday",
+		"family/School/crème.txt":   "Crème brûlée for the bake sale",
+		"family/School/removed.txt": "This document is removed before searching",
+		"home/a/Notes/page.html":    "<script>alert('hi')</script> \x02injected\x03 markup & more",
+	}
+	for key, text := range documents {
+		if err := store.Put(ctx, key, `"v1"`, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Replacing the text of a document drops the old one
+	if err := store.Put(ctx, "home/a/Recipes/soup.md", `"v2"`, "Pumpkin soup with ginger"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "family/School/removed.txt", "family/School/missing.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := store.Versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 6 || versions["home/a/Recipes/soup.md"] != `"v2"` || versions["home/a/Taxes/2023.txt"] != `"v1"` {
+		t.Errorf("versions = %v", versions)
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		query  string
+		want   []string
+	}{
+		{name: "every word has to match", prefix: "", query: "tax 2023", want: []string{"home/a/Taxes/2023.txt"}},
+		{name: "prefix limits the documents", prefix: "home/b/", query: "tax", want: []string{"home/b/Taxes/2022.txt"}},
+		{name: "last word matches as a prefix", prefix: "family/", query: "muse", want: []string{"family/School/letter.pdf"}},
+		{name: "diacritics are ignored", prefix: "", query: "creme brulee", want: []string{"family/School/crème.txt"}},
+		{name: "replaced text is gone", prefix: "", query: "tomato", want: []string{}},
+		{name: "new text is found", prefix: "", query: "pumpkin", want: []string{"home/a/Recipes/soup.md"}},
+		{name: "deleted documents are gone", prefix: "", query: "removed", want: []string{}},
+		{name: "operators are taken literally", prefix: "", query: "tax OR soup", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := store.Search(ctx, tt.prefix, tt.query, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(matches))
+			for _, match := range matches {
+				got = append(got, match.Key)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	matches, err := store.Search(ctx, "", "refund", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Snippet != "Tax return for 2023, the <mark>refund</mark> arrives in May" {
+		t.Errorf("matches = %+v", matches)
+	}
+
+	// The text of documents is escaped, only the marks are markup
+	matches, err = store.Search(ctx, "", "alert", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "&lt;script&gt;<mark>alert</mark>(&#39;hi&#39;)&lt;/script&gt; injected markup &amp; more"
+	if len(matches) != 1 || matches[0].Snippet != want {
+		t.Errorf("matches = %+v, want snippet %q", matches, want)
+	}
+}
@@ -0,0 +1,335 @@
+// Package homes moves the files written before per-user spaces existed into the home of their owner.
+package homes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/activity"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/favorites"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/fulltext"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/locks"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// maxCopySize is the largest object a single CopyObject takes
+	maxCopySize = 5 << 30
+	// copyPartSize is the size of the parts larger objects are copied in
+	copyPartSize = 512 << 20
+	// maxParts is the most parts a multipart upload takes, the parts grow for objects that would need more
+	maxParts = 10000
+)
+
+// Plan says whose home every top-level folder or file of the bucket moves into
+type Plan struct {
+	// Owners maps the name of a top-level folder or file to the Cognito sub of its owner,
+	// or to "family" for the entries moving into the family space
+	Owners map[string]string
+	// DefaultOwner receives the entries missing from Owners, they are left in place when it is empty
+	DefaultOwner string
+}
+
+// Move is a top-level folder or file moved into a home
+type Move struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Objects int    `json:"objects"`
+}
+
+// Report describes what a migration moved
+type Report struct {
+	DryRun  bool     `json:"dryRun"`
+	Moved   []Move   `json:"moved"`
+	Skipped []string `json:"skipped"`
+	// Changed are the objects written to during the migration, they are left in place for the next run
+	Changed []string `json:"changed"`
+}
+
+// Stores are the stores keeping paths the migration moves along with the files
+type Stores struct {
+	Metadata  index.Index
+	Favorites favorites.Store
+	Locks     locks.Store
+	FullText  fulltext.Store
+	Activity  activity.Store
+}
+
+// Migrator moves top-level entries of the bucket into homes and keeps the stores in line
+type Migrator struct {
+	driver    api_aws.S3Driver
+	metadata  index.Index
+	favorites favorites.Store
+	locks     locks.Store
+	fulltext  fulltext.Store
+	activity  activity.Store
+	bucket    string
+	logger    log.Logger
+}
+
+// NewMigrator creates a new migrator for bucket
+func NewMigrator(logger log.Logger, driver api_aws.S3Driver, stores Stores, bucket string) *Migrator {
+	return &Migrator{
+		driver:    driver,
+		metadata:  stores.Metadata,
+		favorites: stores.Favorites,
+		locks:     stores.Locks,
+		fulltext:  stores.FullText,
+		activity:  stores.Activity,
+		bucket:    bucket,
+		logger:    logger,
+	}
+}
+
+// Migrate copies every object outside of the homes prefix into the home of its owner and deletes the original.
+// Objects are copied with a condition on their ETag and only deleted when they did not change since,
+// so a file changed during the migration is left in place. Running it again only moves what is left
+func (m *Migrator) Migrate(ctx context.Context, plan Plan, dryRun bool) (*Report, *api_error.RequestError) {
+	report := &Report{DryRun: dryRun, Moved: make([]Move, 0), Skipped: make([]string, 0), Changed: make([]string, 0)}
+
+	moves := make(map[string]*Move)
+	skipped := make(map[string]bool)
+	var objects []types.Object
+	err := index.Walk(ctx, m.driver, m.bucket, "", func(object types.Object) *api_error.RequestError {
+		if strings.HasPrefix(object.Key, types.HomesPrefix) || strings.HasPrefix(object.Key, types.FamilyPrefix) {
+			return nil
+		}
+		entry := topLevel(object.Key)
+		owner, ok := plan.Owners[strings.TrimSuffix(entry, "/")]
+		if !ok {
+			owner = plan.DefaultOwner
+		}
+		if owner == "" {
+			skipped[entry] = true
+			return nil
+		}
+		move, ok := moves[entry]
+		if !ok {
+			move = &Move{From: entry, To: targetPrefix(owner) + entry}
+			moves[entry] = move
+		}
+		move.Objects++
+		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, move := range moves {
+		report.Moved = append(report.Moved, *move)
+	}
+	sort.Slice(report.Moved, func(i, j int) bool { return report.Moved[i].From < report.Moved[j].From })
+	for entry := range skipped {
+		report.Skipped = append(report.Skipped, entry)
+	}
+	sort.Strings(report.Skipped)
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, object := range objects {
+		move := moves[topLevel(object.Key)]
+		moved, err := m.moveObject(ctx, object, move.To+strings.TrimPrefix(object.Key, move.From))
+		if err != nil {
+			return report, err
+		}
+		if !moved {
+			report.Changed = append(report.Changed, object.Key)
+		}
+	}
+	for _, move := range report.Moved {
+		if err := m.favorites.Move(ctx, move.From, move.To); err != nil {
+			return report, err
+		}
+		m.logger.Infof("Moved %s to %s (%d objects)", move.From, move.To, move.Objects)
+	}
+	return report, nil
+}
+
+// moveObject copies an object to its new key, deletes the original and moves the index, locks,
+// full-text entry and downloads of the file with it. An object changed after the copy stays where it
+// was and the copy is removed, so the next run moves the new version. It returns false in that case.
+// S3 cannot delete on a condition, an object written between the check and the delete is still lost
+func (m *Migrator) moveObject(ctx context.Context, object types.Object, to string) (bool, *api_error.RequestError) {
+	etag, lastModified, err := m.copyObject(ctx, object, to)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := m.changed(ctx, object)
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		m.logger.Infof("%s changed during the migration, it is left in place", object.Key)
+		return false, m.driver.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &m.bucket, Key: &to})
+	}
+	if err := m.driver.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &m.bucket, Key: &object.Key}); err != nil {
+		return false, err
+	}
+
+	moved := object
+	moved.Key = to
+	moved.LastModified = lastModified
+	if etag != "" {
+		moved.ETag = etag
+	}
+	if err := m.metadata.Move(ctx, object.Key, moved); err != nil {
+		return false, err
+	}
+	if err := m.locks.Move(ctx, object.Key, to); err != nil {
+		return false, err
+	}
+	if err := m.fulltext.Move(ctx, object.Key, to); err != nil {
+		return false, err
+	}
+	return true, m.activity.Move(ctx, object.Key, to)
+}
+
+// changed returns true if the object is gone or no longer has the ETag it was listed with
+func (m *Migrator) changed(ctx context.Context, object types.Object) (bool, *api_error.RequestError) {
+	res, err := m.driver.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &m.bucket, Key: &object.Key})
+	if err != nil && err.Status == api_error.NotFoundError {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return object.ETag != "" && (res.ETag == nil || *res.ETag != object.ETag), nil
+}
+
+// copyObject copies an object to another key on the S3 side and returns the ETag and last modified time
+// of the copy. Objects over the 5 GB a single copy takes are copied in parts
+func (m *Migrator) copyObject(ctx context.Context, object types.Object, to string) (string, time.Time, *api_error.RequestError) {
+	source := copySource(m.bucket, object.Key)
+	var ifMatch *string
+	if object.ETag != "" {
+		ifMatch = &object.ETag
+	}
+	if object.Size <= maxCopySize {
+		res, err := m.driver.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:            &m.bucket,
+			Key:               &to,
+			CopySource:        &source,
+			CopySourceIfMatch: ifMatch,
+		})
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		etag, lastModified := "", time.Now().UTC()
+		if res.CopyObjectResult != nil {
+			if res.CopyObjectResult.ETag != nil {
+				etag = *res.CopyObjectResult.ETag
+			}
+			if res.CopyObjectResult.LastModified != nil {
+				lastModified = res.CopyObjectResult.LastModified.UTC()
+			}
+		}
+		return etag, lastModified, nil
+	}
+
+	// A multipart upload does not carry the headers of the source over like CopyObject does
+	head, err := m.driver.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &m.bucket, Key: &object.Key, IfMatch: ifMatch})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	upload, err := m.driver.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             &m.bucket,
+		Key:                &to,
+		ContentType:        head.ContentType,
+		CacheControl:       head.CacheControl,
+		ContentDisposition: head.ContentDisposition,
+		Metadata:           head.Metadata,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	parts, err := m.copyParts(ctx, object, to, source, ifMatch, upload.UploadId)
+	if err != nil {
+		if abortErr := m.driver.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: &m.bucket, Key: &to, UploadId: upload.UploadId}); abortErr != nil {
+			m.logger.Error("Error aborting the copy of ", object.Key, ": ", abortErr.Error())
+		}
+		return "", time.Time{}, err
+	}
+	res, err := m.driver.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &m.bucket,
+		Key:             &to,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	etag := ""
+	if res.ETag != nil {
+		etag = *res.ETag
+	}
+	return etag, time.Now().UTC(), nil
+}
+
+// copyParts copies an object into a multipart upload in ranges, every range on the condition of the ETag
+// the object was listed with
+func (m *Migrator) copyParts(ctx context.Context, object types.Object, to string, source string, ifMatch *string, uploadID *string) ([]s3types.CompletedPart, *api_error.RequestError) {
+	partSize := max(int64(copyPartSize), (object.Size+maxParts-1)/maxParts)
+	parts := make([]s3types.CompletedPart, 0, (object.Size+partSize-1)/partSize)
+	for start, number := int64(0), int32(1); start < object.Size; start, number = start+partSize, number+1 {
+		end := min(start+partSize, object.Size) - 1
+		byteRange := fmt.Sprintf("bytes=%d-%d", start, end)
+		res, err := m.driver.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:            &m.bucket,
+			Key:               &to,
+			UploadId:          uploadID,
+			PartNumber:        number,
+			CopySource:        &source,
+			CopySourceRange:   &byteRange,
+			CopySourceIfMatch: ifMatch,
+		})
+		if err != nil {
+			return nil, err
+		}
+		part := s3types.CompletedPart{PartNumber: number}
+		if res.CopyPartResult != nil {
+			part.ETag = res.CopyPartResult.ETag
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// targetPrefix returns the prefix of the space an owner's entries move into
+func targetPrefix(owner string) string {
+	if owner == string(types.SpaceFamily) {
+		return types.FamilyPrefix
+	}
+	return types.HomePrefix(owner)
+}
+
+// topLevel returns the top-level entry a key belongs to, a folder name with a trailing slash or a file name
+func topLevel(key string) string {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i+1]
+	}
+	return key
+}
+
+// copySource builds the URL encoded bucket/key source of a copy
+func copySource(bucket string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
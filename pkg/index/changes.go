@@ -0,0 +1,199 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// StateChangesEpoch identifies the current change history, it changes every time the index is rebuilt
+	StateChangesEpoch = "changes_epoch"
+	// StateChangesPrunedThrough is the last sequence number removed from the change history
+	StateChangesPrunedThrough = "changes_pruned_through"
+
+	// changeRetention is how long changes are kept before clients have to list the drive again
+	changeRetention = time.Hour * 24 * 30
+)
+
+// recordChange appends a change to the history, from is the previous key of a moved object
+func recordChange(ctx context.Context, tx *sql.Tx, changeType types.ChangeType, object types.Object, from string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO changes (type, key, size, etag, from_key, changed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		string(changeType), object.Key, object.Size, object.ETag, from, time.Now().UnixNano(),
+	)
+	return err
+}
+
+// resetChanges clears the history and starts a new epoch so every cursor handed out so far requires a reset
+func resetChanges(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM changes`); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO index_state (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`,
+		StateChangesEpoch, uuid.New().String(),
+	)
+	return err
+}
+
+func (i *sqlIndex) Changes(ctx context.Context, cursor string, limit int) (*types.ChangeFeed, *api_error.RequestError) {
+	// Reading the history does not write to it, the writes prune it. A read transaction sees the
+	// history as a whole so a prune in between cannot hide changes from the cursor
+	tx, txErr := i.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if txErr != nil {
+		return nil, api_error.NewRequestError(txErr, api_error.InternalServerError, "failed to read changes", i.logger)
+	}
+	defer tx.Rollback()
+
+	var epoch string
+	var prunedThrough, latest int64
+	err := func() error {
+		if err := tx.QueryRowContext(ctx, `SELECT value FROM index_state WHERE name = ?`, StateChangesEpoch).Scan(&epoch); err != nil {
+			return err
+		}
+		var err error
+		if prunedThrough, err = changesPrunedThrough(ctx, tx); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM changes`).Scan(&latest); err != nil {
+			return err
+		}
+		if latest < prunedThrough {
+			latest = prunedThrough
+		}
+		return nil
+	}()
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read changes", i.logger)
+	}
+
+	feed := &types.ChangeFeed{
+		Changes: make([]types.Change, 0),
+		Cursor:  encodeCursor(epoch, latest),
+	}
+	// Without a cursor the client only learns where the history currently ends
+	if cursor == "" {
+		return feed, nil
+	}
+
+	cursorEpoch, seq, ok := decodeCursor(cursor)
+	if !ok {
+		return nil, api_error.NewRequestError(nil, api_error.BadRequestError, "invalid cursor", i.logger)
+	}
+	if cursorEpoch != epoch || seq < prunedThrough || seq > latest {
+		feed.ResetRequired = true
+		return feed, nil
+	}
+
+	rows, queryErr := tx.QueryContext(ctx, `
+		SELECT seq, type, key, size, etag, from_key, changed_at FROM changes
+		WHERE seq > ? ORDER BY seq LIMIT ?`,
+		seq, limit+1,
+	)
+	if queryErr != nil {
+		return nil, api_error.NewRequestError(queryErr, api_error.InternalServerError, "failed to read changes", i.logger)
+	}
+	defer rows.Close()
+
+	changes := make([]types.Change, 0, limit)
+	last := seq
+	for rows.Next() {
+		if len(changes) == limit {
+			feed.HasMore = true
+			break
+		}
+		var change types.Change
+		var changeType string
+		var changedAt int64
+		if err := rows.Scan(&last, &changeType, &change.Key, &change.Size, &change.ETag, &change.From, &changedAt); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read changes", i.logger)
+		}
+		change.Type = types.ChangeType(changeType)
+		change.Time = fromUnixNano(changedAt)
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read changes", i.logger)
+	}
+
+	feed.Changes = changes
+	feed.Cursor = encodeCursor(epoch, last)
+	return feed, nil
+}
+
+// startChanges starts the epoch of the history if there is none yet
+func startChanges(db *sql.DB) error {
+	_, err := db.Exec(`INSERT OR IGNORE INTO index_state (name, value) VALUES (?, ?)`, StateChangesEpoch, uuid.New().String())
+	return err
+}
+
+// changesPrunedThrough returns the last sequence number removed from the history so far
+func changesPrunedThrough(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var value string
+	switch err := tx.QueryRowContext(ctx, `SELECT value FROM index_state WHERE name = ?`, StateChangesPrunedThrough).Scan(&value); err {
+	case nil:
+		prunedThrough, _ := strconv.ParseInt(value, 10, 64)
+		return prunedThrough, nil
+	case sql.ErrNoRows:
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// pruneChanges removes the changes older than the retention. It runs with every write to the index
+// so the history never holds more than the retention and the writes since
+func pruneChanges(ctx context.Context, tx *sql.Tx) error {
+	prunedThrough, err := changesPrunedThrough(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-changeRetention).UnixNano()
+	var expired sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT MAX(seq) FROM changes WHERE changed_at < ?`, cutoff).Scan(&expired); err != nil {
+		return err
+	}
+	if !expired.Valid || expired.Int64 <= prunedThrough {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM changes WHERE seq <= ?`, expired.Int64); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO index_state (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`,
+		StateChangesPrunedThrough, strconv.FormatInt(expired.Int64, 10),
+	)
+	return err
+}
+
+func encodeCursor(epoch string, seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", epoch, seq)))
+}
+
+func decodeCursor(cursor string) (string, int64, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, false
+	}
+	epoch, seq, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", 0, false
+	}
+	n, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return epoch, n, true
+}
@@ -0,0 +1,162 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := encodeCursor("5f0c3c1e-epoch", 42)
+	epoch, seq, ok := decodeCursor(cursor)
+	if !ok || epoch != "5f0c3c1e-epoch" || seq != 42 {
+		t.Errorf("decodeCursor(encodeCursor()) = %q, %d, %v", epoch, seq, ok)
+	}
+
+	for _, invalid := range []string{"not base64!", encodeCursor("epoch", 1)[:3], "ZXBvY2g", "ZXBvY2g6eA"} {
+		if _, _, ok := decodeCursor(invalid); ok {
+			t.Errorf("decodeCursor(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestChanges(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	start, err := idx.Changes(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(start.Changes) != 0 || start.Cursor == "" {
+		t.Fatalf("Changes() without a cursor = %+v", start)
+	}
+
+	if err := idx.Put(ctx, object("a.txt", 1, "e1"), object("b.txt", 2, "e1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Put(ctx, object("a.txt", 3, "e2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Move(ctx, "b.txt", object("c.txt", 2, "e1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Delete(ctx, "a.txt", "missing.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []types.Change{
+		{Type: types.ChangeCreated, Key: "a.txt"},
+		{Type: types.ChangeCreated, Key: "b.txt"},
+		{Type: types.ChangeModified, Key: "a.txt"},
+		{Type: types.ChangeMoved, Key: "c.txt", From: "b.txt"},
+		{Type: types.ChangeDeleted, Key: "a.txt"},
+	}
+	var got []types.Change
+	cursor := start.Cursor
+	for page := 0; ; page++ {
+		if page > len(want) {
+			t.Fatal("the pages never end")
+		}
+		feed, err := idx.Changes(ctx, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed.ResetRequired {
+			t.Fatal("a current cursor should not require a reset")
+		}
+		got = append(got, feed.Changes...)
+		cursor = feed.Cursor
+		if !feed.HasMore {
+			break
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Key != want[i].Key || got[i].From != want[i].From {
+			t.Errorf("change %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// The cursor of the last page has nothing new
+	feed, err := idx.Changes(ctx, cursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Changes) != 0 || feed.HasMore || feed.Cursor != cursor {
+		t.Errorf("Changes() at the end = %+v", feed)
+	}
+
+	if _, err := idx.Changes(ctx, "not a cursor", 2); err == nil || err.Status != api_error.BadRequestError {
+		t.Errorf("an invalid cursor returned %v", err)
+	}
+}
+
+func TestChangesReset(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	if err := idx.Put(ctx, object("a.txt", 1, "e1"), object("b.txt", 2, "e1"), object("c.txt", 3, "e1")); err != nil {
+		t.Fatal(err)
+	}
+	epoch, err := idx.State(ctx, StateChangesEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		reset  bool
+	}{
+		{name: "current epoch", cursor: encodeCursor(epoch, 1)},
+		{name: "other epoch", cursor: encodeCursor("other", 1), reset: true},
+		{name: "ahead of the history", cursor: encodeCursor(epoch, 4), reset: true},
+	}
+	for _, tt := range tests {
+		feed, err := idx.Changes(ctx, tt.cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed.ResetRequired != tt.reset {
+			t.Errorf("%s: ResetRequired = %v, want %v", tt.name, feed.ResetRequired, tt.reset)
+		}
+	}
+
+	// Changes older than the retention are pruned with the next write
+	db := idx.(*sqlIndex).db
+	old := time.Now().Add(-changeRetention - time.Hour).UnixNano()
+	if _, err := db.Exec(`UPDATE changes SET changed_at = ? WHERE seq <= 2`, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Put(ctx, object("d.txt", 4, "e1")); err != nil {
+		t.Fatal(err)
+	}
+	prunedThrough, err := idx.State(ctx, StateChangesPrunedThrough)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prunedThrough != "2" {
+		t.Fatalf("pruned through %q, want 2", prunedThrough)
+	}
+
+	for _, tt := range []struct {
+		seq   int64
+		reset bool
+	}{{seq: 1, reset: true}, {seq: 2}, {seq: 3}} {
+		feed, err := idx.Changes(ctx, encodeCursor(epoch, tt.seq), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed.ResetRequired != tt.reset {
+			t.Errorf("cursor at %d: ResetRequired = %v, want %v", tt.seq, feed.ResetRequired, tt.reset)
+		}
+		if !tt.reset && len(feed.Changes) != int(4-tt.seq) {
+			t.Errorf("cursor at %d: got %d changes, want %d", tt.seq, len(feed.Changes), 4-tt.seq)
+		}
+	}
+}
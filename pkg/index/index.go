@@ -0,0 +1,496 @@
+// Package index keeps a local copy of the bucket metadata so listings and
+// folder sizes can be answered without walking the bucket.
+package index
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Index is the interface for the bucket metadata index
+type Index interface {
+	// Ready returns true once the index has been built at least once
+	Ready(ctx context.Context) bool
+	// Put adds or updates objects and rolls their sizes up into their folders
+	Put(ctx context.Context, objects ...types.Object) *api_error.RequestError
+	// Delete removes objects and subtracts their sizes from their folders
+	Delete(ctx context.Context, keys ...string) *api_error.RequestError
+	// Move replaces the object at from with object and reports it as a single move in the change feed.
+	// Only moves made by the API are reported as moves, the bucket only tells about creates and deletes
+	Move(ctx context.Context, from string, object types.Object) *api_error.RequestError
+	// Get returns the object with the given key, or nil if it is not indexed
+	Get(ctx context.Context, key string) (*types.Object, *api_error.RequestError)
+	// List returns every object under prefix sorted by key
+	List(ctx context.Context, prefix string) ([]types.Object, *api_error.RequestError)
+	// ListChildren returns the objects and folders directly under prefix
+	ListChildren(ctx context.Context, prefix string) ([]types.Object, []types.FolderStats, *api_error.RequestError)
+	// FolderStats returns the totals of the folder at prefix
+	FolderStats(ctx context.Context, prefix string) (*types.FolderStats, *api_error.RequestError)
+	// ListRange returns the objects with a key after after and up to until, an empty until has no upper bound
+	ListRange(ctx context.Context, after string, until string) ([]types.Object, *api_error.RequestError)
+	// Sync puts objects and deletes the removed keys found by a listing of the bucket made at listedAt.
+	// The keys changed by an event or the API since then are left as they are and returned
+	Sync(ctx context.Context, listedAt time.Time, objects []types.Object, removed []string) ([]string, *api_error.RequestError)
+	// Rebuild replaces the content of the index with a full walk of the bucket
+	Rebuild(ctx context.Context, driver api_aws.S3Driver, bucket string) (int, *api_error.RequestError)
+	// State returns a value stored alongside the index, or an empty string if it is not set
+	State(ctx context.Context, name string) (string, *api_error.RequestError)
+	// SetState stores a value alongside the index, an empty value removes it
+	SetState(ctx context.Context, name string, value string) *api_error.RequestError
+	// Changes returns up to limit changes made to the index after cursor
+	Changes(ctx context.Context, cursor string, limit int) (*types.ChangeFeed, *api_error.RequestError)
+	// Search returns up to limit files and folders under prefix whose name matches query, best match first
+	Search(ctx context.Context, prefix string, query string, limit int) ([]types.SearchResult, *api_error.RequestError)
+	// Recent returns up to limit files under prefix sorted from the most recently modified, starting after the given file
+	Recent(ctx context.Context, prefix string, before time.Time, beforeKey string, limit int) ([]types.Object, *api_error.RequestError)
+	// Sequencer returns the sequencer of the last bucket event applied to key, or an empty string if there is none.
+	// Deleted keys keep the sequencer of their removal as a tombstone
+	Sequencer(ctx context.Context, key string) (string, *api_error.RequestError)
+	// SetSequencer records the sequencer of the last bucket event applied to key
+	SetSequencer(ctx context.Context, key string, sequencer string) *api_error.RequestError
+}
+
+const (
+	// StateBuiltAt is the state holding when the index was last fully built or reconciled
+	StateBuiltAt = "built_at"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS objects (
+	key           TEXT PRIMARY KEY,
+	parent        TEXT NOT NULL,
+	size          INTEGER NOT NULL,
+	etag          TEXT NOT NULL,
+	last_modified INTEGER NOT NULL,
+	search_name   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS objects_parent ON objects(parent);
+CREATE INDEX IF NOT EXISTS objects_last_modified ON objects(last_modified, key);
+
+CREATE TABLE IF NOT EXISTS folders (
+	path          TEXT PRIMARY KEY,
+	parent        TEXT NOT NULL,
+	size          INTEGER NOT NULL,
+	objects       INTEGER NOT NULL,
+	last_modified INTEGER NOT NULL,
+	search_name   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS folders_parent ON folders(parent);
+
+CREATE TABLE IF NOT EXISTS index_state (
+	name  TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS changes (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	type       TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	etag       TEXT NOT NULL,
+	from_key   TEXT NOT NULL DEFAULT '',
+	changed_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS changes_changed_at ON changes(changed_at);
+
+CREATE TABLE IF NOT EXISTS sequencers (
+	key         TEXT PRIMARY KEY,
+	sequencer   TEXT NOT NULL,
+	recorded_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sequencers_recorded_at ON sequencers(recorded_at);
+`
+
+// NewIndex creates the index tables if needed and returns the index
+func NewIndex(logger log.Logger, db *sql.DB) Index {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+	if err := startChanges(db); err != nil {
+		panic(err)
+	}
+
+	return &sqlIndex{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlIndex struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (i *sqlIndex) Ready(ctx context.Context) bool {
+	var builtAt string
+	err := i.db.QueryRowContext(ctx, `SELECT value FROM index_state WHERE name = ?`, StateBuiltAt).Scan(&builtAt)
+	return err == nil
+}
+
+func (i *sqlIndex) Put(ctx context.Context, objects ...types.Object) *api_error.RequestError {
+	return i.withTx(ctx, "failed to update index", func(tx *sql.Tx) error {
+		for _, object := range objects {
+			change, err := putObject(ctx, tx, object)
+			if err != nil {
+				return err
+			}
+			if change == "" {
+				continue
+			}
+			if err := recordChange(ctx, tx, change, object, ""); err != nil {
+				return err
+			}
+		}
+		return pruneChanges(ctx, tx)
+	})
+}
+
+func (i *sqlIndex) Delete(ctx context.Context, keys ...string) *api_error.RequestError {
+	return i.withTx(ctx, "failed to update index", func(tx *sql.Tx) error {
+		for _, key := range keys {
+			existing, err := deleteObject(ctx, tx, key)
+			if err != nil {
+				return err
+			}
+			if existing == nil {
+				continue
+			}
+			if err := recordChange(ctx, tx, types.ChangeDeleted, *existing, ""); err != nil {
+				return err
+			}
+		}
+		if err := deleteEmptyFolders(ctx, tx); err != nil {
+			return err
+		}
+		return pruneChanges(ctx, tx)
+	})
+}
+
+func (i *sqlIndex) Move(ctx context.Context, from string, object types.Object) *api_error.RequestError {
+	return i.withTx(ctx, "failed to update index", func(tx *sql.Tx) error {
+		existing, err := deleteObject(ctx, tx, from)
+		if err != nil {
+			return err
+		}
+		if _, err := putObject(ctx, tx, object); err != nil {
+			return err
+		}
+		if err := deleteEmptyFolders(ctx, tx); err != nil {
+			return err
+		}
+
+		// A source that was not indexed yet is a new object to the clients
+		change, source := types.ChangeMoved, from
+		if existing == nil {
+			change, source = types.ChangeCreated, ""
+		}
+		if err := recordChange(ctx, tx, change, object, source); err != nil {
+			return err
+		}
+		return pruneChanges(ctx, tx)
+	})
+}
+
+func (i *sqlIndex) Get(ctx context.Context, key string) (*types.Object, *api_error.RequestError) {
+	object, err := scanObject(i.db.QueryRowContext(ctx, `SELECT key, size, etag, last_modified FROM objects WHERE key = ?`, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return object, nil
+}
+
+func (i *sqlIndex) List(ctx context.Context, prefix string) ([]types.Object, *api_error.RequestError) {
+	// Every key starting with prefix sorts between prefix and prefix followed by the highest byte
+	rows, err := i.db.QueryContext(ctx, `
+		SELECT key, size, etag, last_modified FROM objects
+		WHERE key >= ? AND key < ? ORDER BY key`,
+		prefix, prefix+"\xff",
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	defer rows.Close()
+
+	objects := make([]types.Object, 0)
+	for rows.Next() {
+		object, err := scanObject(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+		}
+		objects = append(objects, *object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return objects, nil
+}
+
+func (i *sqlIndex) ListRange(ctx context.Context, after string, until string) ([]types.Object, *api_error.RequestError) {
+	rows, err := i.db.QueryContext(ctx, `
+		SELECT key, size, etag, last_modified FROM objects
+		WHERE key > ? AND (? = '' OR key <= ?) ORDER BY key`,
+		after, until, until,
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	defer rows.Close()
+
+	objects := make([]types.Object, 0)
+	for rows.Next() {
+		object, err := scanObject(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+		}
+		objects = append(objects, *object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return objects, nil
+}
+
+func (i *sqlIndex) ListChildren(ctx context.Context, prefix string) ([]types.Object, []types.FolderStats, *api_error.RequestError) {
+	rows, err := i.db.QueryContext(ctx, `SELECT key, size, etag, last_modified FROM objects WHERE parent = ? ORDER BY key`, prefix)
+	if err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	objects := make([]types.Object, 0)
+	for rows.Next() {
+		object, err := scanObject(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+		}
+		// Folder markers show up as folders
+		if object.IsFolderMarker() {
+			continue
+		}
+		objects = append(objects, *object)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+
+	rows, err = i.db.QueryContext(ctx, `SELECT path, size, objects, last_modified FROM folders WHERE parent = ? AND path != '' ORDER BY path`, prefix)
+	if err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	defer rows.Close()
+
+	folders := make([]types.FolderStats, 0)
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return objects, folders, nil
+}
+
+func (i *sqlIndex) FolderStats(ctx context.Context, prefix string) (*types.FolderStats, *api_error.RequestError) {
+	folder, err := scanFolder(i.db.QueryRowContext(ctx, `SELECT path, size, objects, last_modified FROM folders WHERE path = ?`, prefix))
+	if err == sql.ErrNoRows {
+		return &types.FolderStats{Path: prefix}, nil
+	}
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return folder, nil
+}
+
+func (i *sqlIndex) State(ctx context.Context, name string) (string, *api_error.RequestError) {
+	var value string
+	err := i.db.QueryRowContext(ctx, `SELECT value FROM index_state WHERE name = ?`, name).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index state", i.logger)
+	}
+	return value, nil
+}
+
+func (i *sqlIndex) SetState(ctx context.Context, name string, value string) *api_error.RequestError {
+	var err error
+	if value == "" {
+		_, err = i.db.ExecContext(ctx, `DELETE FROM index_state WHERE name = ?`, name)
+	} else {
+		_, err = i.db.ExecContext(ctx, `
+			INSERT INTO index_state (name, value) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET value = excluded.value`,
+			name, value,
+		)
+	}
+	if err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to update index state", i.logger)
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction, rolling it back if fn fails
+func (i *sqlIndex) withTx(ctx context.Context, msg string, fn func(tx *sql.Tx) error) *api_error.RequestError {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, msg, i.logger)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return api_error.NewRequestError(err, api_error.InternalServerError, msg, i.logger)
+	}
+	if err := tx.Commit(); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, msg, i.logger)
+	}
+	return nil
+}
+
+// putObject adds or updates an object and rolls its size up into its folders. It returns the kind of
+// change made, or an empty change when the same content was already indexed
+func putObject(ctx context.Context, tx *sql.Tx, object types.Object) (types.ChangeType, error) {
+	existing, err := scanObject(tx.QueryRowContext(ctx, `SELECT key, size, etag, last_modified FROM objects WHERE key = ?`, object.Key))
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	change := types.ChangeCreated
+	var oldSize int64
+	var count int64 = 1
+	if existing != nil {
+		// Nothing to do when the same content is put again. Objects put from bucket events carry the
+		// time of the event, so the modification date alone is no change
+		if existing.Size == object.Size && existing.ETag == object.ETag {
+			return "", nil
+		}
+		change = types.ChangeModified
+		oldSize = existing.Size
+		count = 0
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO objects (key, parent, size, etag, last_modified, search_name) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET size = excluded.size, etag = excluded.etag, last_modified = excluded.last_modified`,
+		object.Key, types.ParentPath(object.Key), object.Size, object.ETag, unixNano(object.LastModified), searchName(object.Key),
+	); err != nil {
+		return "", err
+	}
+	if err := addToFolders(ctx, tx, object.Key, object.Size-oldSize, count, unixNano(object.LastModified)); err != nil {
+		return "", err
+	}
+	return change, nil
+}
+
+// deleteObject removes an object and subtracts its size from its folders.
+// It returns the removed object, or nil if it was not indexed
+func deleteObject(ctx context.Context, tx *sql.Tx, key string) (*types.Object, error) {
+	existing, err := scanObject(tx.QueryRowContext(ctx, `SELECT key, size, etag, last_modified FROM objects WHERE key = ?`, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM objects WHERE key = ?`, key); err != nil {
+		return nil, err
+	}
+	if err := addToFolders(ctx, tx, key, -existing.Size, -1, 0); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// deleteEmptyFolders removes the folders without objects left, they are gone from the bucket as well.
+// The root folder always stays
+func deleteEmptyFolders(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM folders WHERE objects <= 0 AND path != ''`)
+	return err
+}
+
+// addToFolders adds a size and object count difference to every folder holding key, creating missing folders
+func addToFolders(ctx context.Context, tx *sql.Tx, key string, size int64, count int64, lastModified int64) error {
+	for _, path := range folderPaths(key) {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO folders (path, parent, size, objects, last_modified, search_name) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (path) DO UPDATE SET
+				size = size + excluded.size,
+				objects = objects + excluded.objects,
+				last_modified = max(last_modified, excluded.last_modified)`,
+			path, types.ParentPath(path), size, count, lastModified, searchName(path),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// folderPaths returns the root folder and the path of every folder above key.
+// A folder marker key is part of the folder it marks
+func folderPaths(key string) []string {
+	paths := []string{""}
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' {
+			paths = append(paths, key[:i+1])
+		}
+	}
+	return paths
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanObject(row scanner) (*types.Object, error) {
+	var object types.Object
+	var lastModified int64
+	if err := row.Scan(&object.Key, &object.Size, &object.ETag, &lastModified); err != nil {
+		return nil, err
+	}
+	object.LastModified = fromUnixNano(lastModified)
+	return &object, nil
+}
+
+func scanFolder(row scanner) (*types.FolderStats, error) {
+	var folder types.FolderStats
+	var lastModified int64
+	if err := row.Scan(&folder.Path, &folder.Size, &folder.Objects, &lastModified); err != nil {
+		return nil, err
+	}
+	folder.LastModified = fromUnixNano(lastModified)
+	return &folder, nil
+}
+
+// unixNano stores a timestamp as nanoseconds, unknown timestamps are stored as zero
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// NormalizePrefix turns a folder name coming from a request into an index prefix with a trailing slash
+func NormalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
@@ -0,0 +1,314 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"testing"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	_ "modernc.org/sqlite"
+)
+
+const testBucket = "test-bucket"
+
+func newTestIndex(t *testing.T) Index {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewIndex(logger, db)
+}
+
+// fakeBucket stands in for S3 with a bucket listed pageSize keys at a time.
+// The other calls of the driver are not implemented
+type fakeBucket struct {
+	api_aws.S3Driver
+	objects  map[string]types.Object
+	pageSize int
+	// emptyPages are the pages, counted from 0, returned truncated without objects before the page due
+	emptyPages map[int]bool
+	pages      int
+	// listed is called with every page before it is returned
+	listed func(page *s3.ListObjectsV2Output)
+}
+
+func newFakeBucket(pageSize int, objects ...types.Object) *fakeBucket {
+	bucket := &fakeBucket{objects: make(map[string]types.Object), pageSize: pageSize}
+	for _, object := range objects {
+		bucket.objects[object.Key] = object
+	}
+	return bucket
+}
+
+// ListObjects pages through the keys in order, the continuation token is the last key of the previous page
+func (b *fakeBucket) ListObjects(ctx context.Context, params *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, *api_error.RequestError) {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	after := aws.ToString(params.StartAfter)
+	if params.ContinuationToken != nil {
+		after = *params.ContinuationToken
+	}
+	prefix := aws.ToString(params.Prefix)
+
+	page := b.pages
+	b.pages++
+	if b.emptyPages[page] {
+		return &s3.ListObjectsV2Output{IsTruncated: true, NextContinuationToken: aws.String(after)}, nil
+	}
+
+	res := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		if key <= after || len(key) < len(prefix) || key[:len(prefix)] != prefix {
+			continue
+		}
+		if len(res.Contents) == b.pageSize {
+			res.IsTruncated = true
+			res.NextContinuationToken = res.Contents[len(res.Contents)-1].Key
+			break
+		}
+		object := b.objects[key]
+		res.Contents = append(res.Contents, s3types.Object{
+			Key:          aws.String(object.Key),
+			Size:         object.Size,
+			ETag:         aws.String(object.ETag),
+			LastModified: aws.Time(object.LastModified),
+		})
+	}
+	if b.listed != nil {
+		b.listed(res)
+	}
+	return res, nil
+}
+
+func object(key string, size int64, etag string) types.Object {
+	return types.Object{Key: key, Size: size, ETag: etag, LastModified: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func keysOf(objects []types.Object) []string {
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Key
+	}
+	return keys
+}
+
+func equalKeys(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func checkFolders(t *testing.T, idx Index, want map[string][2]int64) {
+	t.Helper()
+	for prefix, totals := range want {
+		stats, err := idx.FolderStats(context.Background(), prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Size != totals[0] || stats.Objects != totals[1] {
+			t.Errorf("folder %q has size %d and %d objects, want %d and %d", prefix, stats.Size, stats.Objects, totals[0], totals[1])
+		}
+	}
+}
+
+func TestFolderRollups(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	if err := idx.Put(ctx,
+		object("a/b/1.txt", 10, "e1"),
+		object("a/2.txt", 5, "e2"),
+		object("c.txt", 1, "e3"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {16, 3}, "a/": {15, 2}, "a/b/": {10, 1}})
+
+	// A new version replaces the size without counting the object twice
+	if err := idx.Put(ctx, object("a/b/1.txt", 20, "e4")); err != nil {
+		t.Fatal(err)
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {26, 3}, "a/": {25, 2}, "a/b/": {20, 1}})
+
+	// Removing the last object of a folder removes the folder
+	if err := idx.Delete(ctx, "a/b/1.txt"); err != nil {
+		t.Fatal(err)
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {6, 2}, "a/": {5, 1}, "a/b/": {0, 0}})
+	_, folders, err := idx.ListChildren(ctx, "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 0 {
+		t.Errorf("a/ still lists %d folders", len(folders))
+	}
+
+	if err := idx.Move(ctx, "a/2.txt", object("d/2.txt", 5, "e2")); err != nil {
+		t.Fatal(err)
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {6, 2}, "a/": {0, 0}, "d/": {5, 1}})
+
+	// A folder marker is listed as its folder, not as a file
+	if err := idx.Put(ctx, object("e/", 0, "marker")); err != nil {
+		t.Fatal(err)
+	}
+	objects, folders, err := idx.ListChildren(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keysOf(objects); !equalKeys(got, []string{"c.txt"}) {
+		t.Errorf("root lists files %v, want [c.txt]", got)
+	}
+	paths := make([]string, len(folders))
+	for i, folder := range folders {
+		paths[i] = folder.Path
+	}
+	if !equalKeys(paths, []string{"d/", "e/"}) {
+		t.Errorf("root lists folders %v, want [d/ e/]", paths)
+	}
+}
+
+func TestPutSameContent(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	if err := idx.Put(ctx, object("a.txt", 10, "e1")); err != nil {
+		t.Fatal(err)
+	}
+	start, err := idx.Changes(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bucket events carry their own time, the same content at a later time is no change
+	later := object("a.txt", 10, "e1")
+	later.LastModified = later.LastModified.Add(time.Hour)
+	if err := idx.Put(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	feed, err := idx.Changes(ctx, start.Cursor, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Changes) != 0 {
+		t.Errorf("putting the same content recorded %d changes", len(feed.Changes))
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {10, 1}})
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	if err := idx.Put(ctx,
+		object("Photos/", 0, "marker"),
+		object("Photos/a.jpg", 1, "e"),
+		object("Photos/2024/b.jpg", 1, "e"),
+		object("Photos/été.jpg", 1, "e"),
+		object("Photos/中.jpg", 1, "e"),
+		object("Photos2/c.jpg", 1, "e"),
+		object("Photo.jpg", 1, "e"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "Photos/", want: []string{"Photos/", "Photos/2024/b.jpg", "Photos/a.jpg", "Photos/été.jpg", "Photos/中.jpg"}},
+		{prefix: "Photos/2024/", want: []string{"Photos/2024/b.jpg"}},
+		{prefix: "Photos", want: []string{"Photos/", "Photos/2024/b.jpg", "Photos/a.jpg", "Photos/été.jpg", "Photos/中.jpg", "Photos2/c.jpg"}},
+		{prefix: "Videos/", want: []string{}},
+	}
+	for _, tt := range tests {
+		objects, err := idx.List(ctx, tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keysOf(objects); !equalKeys(got, tt.want) {
+			t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+
+	ranged, err := idx.ListRange(ctx, "Photos/a.jpg", "Photos2/c.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keysOf(ranged), []string{"Photos/été.jpg", "Photos/中.jpg", "Photos2/c.jpg"}; !equalKeys(got, want) {
+		t.Errorf("ListRange() = %v, want %v", got, want)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	if idx.Ready(ctx) {
+		t.Fatal("a new index should not be ready")
+	}
+	if err := idx.Put(ctx, object("stale/gone.txt", 100, "e"), object("a/1.txt", 1, "old")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := idx.Changes(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := newFakeBucket(2,
+		object("a/1.txt", 10, "new"),
+		object("a/b/2.txt", 20, "e"),
+		object("c.txt", 30, "e"),
+	)
+	count, err := idx.Rebuild(ctx, bucket, testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Rebuild() = %d objects, want 3", count)
+	}
+	if !idx.Ready(ctx) {
+		t.Error("the index should be ready once rebuilt")
+	}
+
+	objects, err := idx.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keysOf(objects), []string{"a/1.txt", "a/b/2.txt", "c.txt"}; !equalKeys(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {60, 3}, "a/": {30, 2}, "a/b/": {20, 1}, "stale/": {0, 0}})
+
+	// The history of the replaced content no longer applies
+	feed, err := idx.Changes(ctx, before.Cursor, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !feed.ResetRequired {
+		t.Error("a cursor from before the rebuild should require a reset")
+	}
+}
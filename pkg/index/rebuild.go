@@ -0,0 +1,130 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Walk pages through every object under prefix in the bucket and calls fn for each of them.
+// Walking stops at the first error returned by fn
+func Walk(ctx context.Context, driver api_aws.S3Driver, bucket string, prefix string, fn func(object types.Object) *api_error.RequestError) *api_error.RequestError {
+	var continuationToken *string
+	for {
+		res, err := driver.ListObjects(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			Prefix:            &prefix,
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range res.Contents {
+			if item.Key == nil {
+				continue
+			}
+			if err := fn(ObjectFromS3(item)); err != nil {
+				return err
+			}
+		}
+
+		if !res.IsTruncated {
+			return nil
+		}
+		continuationToken = res.NextContinuationToken
+	}
+}
+
+// ObjectFromS3 converts an object returned by ListObjectsV2 into its metadata
+func ObjectFromS3(item s3types.Object) types.Object {
+	object := types.Object{
+		Key:  aws.ToString(item.Key),
+		Size: item.Size,
+		ETag: aws.ToString(item.ETag),
+	}
+	if item.LastModified != nil {
+		object.LastModified = *item.LastModified
+	}
+	return object
+}
+
+func (i *sqlIndex) Rebuild(ctx context.Context, driver api_aws.S3Driver, bucket string) (int, *api_error.RequestError) {
+	// Walk the bucket before touching the index so readers are only blocked for the final swap
+	objects := make([]types.Object, 0)
+	if err := Walk(ctx, driver, bucket, "", func(object types.Object) *api_error.RequestError {
+		objects = append(objects, object)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Aggregate the folder totals in memory
+	folders := map[string]*types.FolderStats{"": {Path: ""}}
+	for _, object := range objects {
+		for _, path := range folderPaths(object.Key) {
+			folder, ok := folders[path]
+			if !ok {
+				folder = &types.FolderStats{Path: path}
+				folders[path] = folder
+			}
+			folder.Size += object.Size
+			folder.Objects++
+			if object.LastModified.After(folder.LastModified) {
+				folder.LastModified = object.LastModified
+			}
+		}
+	}
+
+	err := i.withTx(ctx, "failed to rebuild index", func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM objects; DELETE FROM folders;`); err != nil {
+			return err
+		}
+		// The history no longer matches the index, sync clients have to start over
+		if err := resetChanges(ctx, tx); err != nil {
+			return err
+		}
+
+		insertObject, err := tx.PrepareContext(ctx, `INSERT INTO objects (key, parent, size, etag, last_modified, search_name) VALUES (?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertObject.Close()
+		for _, object := range objects {
+			if _, err := insertObject.ExecContext(ctx, object.Key, types.ParentPath(object.Key), object.Size, object.ETag, unixNano(object.LastModified), searchName(object.Key)); err != nil {
+				return err
+			}
+		}
+
+		insertFolder, err := tx.PrepareContext(ctx, `INSERT INTO folders (path, parent, size, objects, last_modified, search_name) VALUES (?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insertFolder.Close()
+		for _, folder := range folders {
+			if _, err := insertFolder.ExecContext(ctx, folder.Path, types.ParentPath(folder.Path), folder.Size, folder.Objects, unixNano(folder.LastModified), searchName(folder.Path)); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO index_state (name, value) VALUES (?, ?)
+			ON CONFLICT (name) DO UPDATE SET value = excluded.value`,
+			StateBuiltAt, time.Now().UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	i.logger.Infof("Rebuilt index of %s with %d objects in %d folders", bucket, len(objects), len(folders))
+	return len(objects), nil
+}
@@ -0,0 +1,42 @@
+package index
+
+import (
+	"context"
+	"time"
+
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Recent returns up to limit files under prefix sorted from the most recently modified.
+// Only files modified before before, or at the same time with a key sorting before beforeKey,
+// are returned, so the last file of a page is the cursor of the next. A zero before starts from the latest
+func (i *sqlIndex) Recent(ctx context.Context, prefix string, before time.Time, beforeKey string, limit int) ([]types.Object, *api_error.RequestError) {
+	query := `SELECT key, size, etag, last_modified FROM objects WHERE key >= ? AND key < ? AND substr(key, -1) != '/'`
+	args := []interface{}{prefix, prefix + "\xff"}
+	if !before.IsZero() {
+		query += ` AND (last_modified < ? OR (last_modified = ? AND key < ?))`
+		args = append(args, unixNano(before), unixNano(before), beforeKey)
+	}
+	query += ` ORDER BY last_modified DESC, key DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	defer rows.Close()
+
+	objects := make([]types.Object, 0)
+	for rows.Next() {
+		object, err := scanObject(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+		}
+		objects = append(objects, *object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return objects, nil
+}
@@ -0,0 +1,54 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+func TestRecent(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	at := func(minute int) time.Time {
+		return time.Date(2024, 5, 1, 12, minute, 0, 0, time.UTC)
+	}
+	// b, c and d share a modification date, the key breaks the tie
+	if err := idx.Put(ctx,
+		types.Object{Key: "home/a/a.jpg", Size: 1, ETag: "e", LastModified: at(1)},
+		types.Object{Key: "home/a/b.jpg", Size: 1, ETag: "e", LastModified: at(2)},
+		types.Object{Key: "home/a/c.jpg", Size: 1, ETag: "e", LastModified: at(2)},
+		types.Object{Key: "home/a/d.jpg", Size: 1, ETag: "e", LastModified: at(2)},
+		types.Object{Key: "home/a/e.jpg", Size: 1, ETag: "e", LastModified: at(3)},
+		types.Object{Key: "home/a/Folder/", Size: 0, ETag: "marker", LastModified: at(4)},
+		types.Object{Key: "home/b/f.jpg", Size: 1, ETag: "e", LastModified: at(5)},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var before time.Time
+	var beforeKey string
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("the pages never end")
+		}
+		objects, err := idx.Recent(ctx, "home/a/", before, beforeKey, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) == 0 {
+			break
+		}
+		got = append(got, keysOf(objects)...)
+		last := objects[len(objects)-1]
+		before, beforeKey = last.LastModified, last.Key
+	}
+
+	want := []string{"home/a/e.jpg", "home/a/d.jpg", "home/a/c.jpg", "home/a/b.jpg", "home/a/a.jpg"}
+	if !equalKeys(got, want) {
+		t.Errorf("Recent() pages = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,326 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// StateReconcileCheckpoint is the state holding the last key reached by an unfinished reconciliation
+	StateReconcileCheckpoint = "reconcile_checkpoint"
+	// StateReconcileReport is the state holding the report of the last finished reconciliation
+	StateReconcileReport = "reconcile_report"
+
+	// reconcilePageInterval is the minimum time between two listing pages, about 5000 keys per second
+	reconcilePageInterval = time.Millisecond * 200
+	// maxReportedKeys caps how many keys of each kind are kept in a report
+	maxReportedKeys = 100
+)
+
+// ReconcileReport describes the drift found between the index and the bucket
+type ReconcileReport struct {
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	// ResumedFrom is the key the walk resumed after when a previous run was interrupted
+	ResumedFrom  string   `json:"resumedFrom,omitempty"`
+	Scanned      int      `json:"scanned"`
+	AddedCount   int      `json:"addedCount"`
+	ChangedCount int      `json:"changedCount"`
+	RemovedCount int      `json:"removedCount"`
+	Added        []string `json:"added"`
+	Changed      []string `json:"changed"`
+	Removed      []string `json:"removed"`
+}
+
+// Reconciler walks the bucket and brings the index back in line with it.
+// Changes made outside the API (the AWS console, sync tools, presigned uploads)
+// are picked up this way
+type Reconciler struct {
+	index  Index
+	driver api_aws.S3Driver
+	bucket string
+	logger log.Logger
+}
+
+// NewReconciler creates a new reconciler for the index of bucket
+func NewReconciler(logger log.Logger, index Index, driver api_aws.S3Driver, bucket string) *Reconciler {
+	return &Reconciler{
+		index:  index,
+		driver: driver,
+		bucket: bucket,
+		logger: logger,
+	}
+}
+
+// Run reconciles the index every interval until ctx is done
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("Error while reconciling the index: ", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile walks the bucket page by page and compares every page with the same key range
+// of the index. New and changed objects are written to the index, missing ones are removed.
+// The last key of every page is saved as a checkpoint so an interrupted walk resumes where it stopped
+func (r *Reconciler) Reconcile(ctx context.Context) (*ReconcileReport, *api_error.RequestError) {
+	after, err := r.index.State(ctx, StateReconcileCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconcileReport{
+		StartedAt:   time.Now(),
+		ResumedFrom: after,
+		Added:       make([]string, 0),
+		Changed:     make([]string, 0),
+		Removed:     make([]string, 0),
+	}
+
+	// Pace the walk so it does not compete with user requests
+	ticker := time.NewTicker(reconcilePageInterval)
+	defer ticker.Stop()
+
+	var continuationToken *string
+	for {
+		input := &s3.ListObjectsV2Input{
+			Bucket:            &r.bucket,
+			ContinuationToken: continuationToken,
+		}
+		if continuationToken == nil && after != "" {
+			input.StartAfter = &after
+		}
+		listedAt := time.Now()
+		res, err := r.driver.ListObjects(ctx, input)
+		if err != nil {
+			return report, err
+		}
+
+		objects := make([]types.Object, 0, len(res.Contents))
+		for _, item := range res.Contents {
+			if item.Key != nil {
+				objects = append(objects, ObjectFromS3(item))
+			}
+		}
+
+		// The last page covers every indexed key left. A truncated page without objects says
+		// nothing about the keys after it, the next page does
+		if !res.IsTruncated || len(objects) > 0 {
+			until := ""
+			if res.IsTruncated {
+				until = objects[len(objects)-1].Key
+			}
+			if err := r.reconcileRange(ctx, report, listedAt, after, until, objects); err != nil {
+				return report, err
+			}
+		}
+
+		if !res.IsTruncated {
+			break
+		}
+		if len(objects) > 0 {
+			after = objects[len(objects)-1].Key
+			if err := r.index.SetState(ctx, StateReconcileCheckpoint, after); err != nil {
+				return report, err
+			}
+		}
+		continuationToken = res.NextContinuationToken
+
+		select {
+		case <-ctx.Done():
+			return report, api_error.NewRequestError(ctx.Err(), api_error.BadRequestError, "reconciliation interrupted", r.logger)
+		case <-ticker.C:
+		}
+	}
+
+	report.CompletedAt = time.Now()
+	if err := r.finish(ctx, report); err != nil {
+		return report, err
+	}
+
+	r.logger.Infof("Reconciled index of %s: %d scanned, %d added, %d changed, %d removed",
+		r.bucket, report.Scanned, report.AddedCount, report.ChangedCount, report.RemovedCount)
+	return report, nil
+}
+
+// LastReport returns the report of the last finished reconciliation, or nil if there is none
+func (r *Reconciler) LastReport(ctx context.Context) (*ReconcileReport, *api_error.RequestError) {
+	value, err := r.index.State(ctx, StateReconcileReport)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var report ReconcileReport
+	if err := json.Unmarshal([]byte(value), &report); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read reconcile report", r.logger)
+	}
+	return &report, nil
+}
+
+// reconcileRange compares a page of bucket objects listed at listedAt with the indexed objects in (after, until].
+// The index is read after the listing, the keys an event changed in between are left to the event
+func (r *Reconciler) reconcileRange(ctx context.Context, report *ReconcileReport, listedAt time.Time, after string, until string, objects []types.Object) *api_error.RequestError {
+	indexed, err := r.index.ListRange(ctx, after, until)
+	if err != nil {
+		return err
+	}
+
+	// Both lists are sorted by key, so they can be merged in one pass
+	var added, changed []types.Object
+	var removed []string
+	i, j := 0, 0
+	for i < len(objects) || j < len(indexed) {
+		switch {
+		case j == len(indexed) || (i < len(objects) && objects[i].Key < indexed[j].Key):
+			added = append(added, objects[i])
+			i++
+		case i == len(objects) || indexed[j].Key < objects[i].Key:
+			removed = append(removed, indexed[j].Key)
+			j++
+		default:
+			// Objects indexed from bucket events carry the time of the event rather than the
+			// modification date of the object, so only the content is compared
+			if objects[i].Size != indexed[j].Size || objects[i].ETag != indexed[j].ETag {
+				changed = append(changed, objects[i])
+			}
+			i++
+			j++
+		}
+	}
+	report.Scanned += len(objects)
+	if len(added) == 0 && len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	skipped, err := r.index.Sync(ctx, listedAt, append(added, changed...), removed)
+	if err != nil {
+		return err
+	}
+	left := make(map[string]bool, len(skipped))
+	for _, key := range skipped {
+		left[key] = true
+	}
+	for _, object := range added {
+		if !left[object.Key] {
+			report.AddedCount++
+			report.Added = appendCapped(report.Added, object.Key)
+		}
+	}
+	for _, object := range changed {
+		if !left[object.Key] {
+			report.ChangedCount++
+			report.Changed = appendCapped(report.Changed, object.Key)
+		}
+	}
+	for _, key := range removed {
+		if !left[key] {
+			report.RemovedCount++
+			report.Removed = appendCapped(report.Removed, key)
+		}
+	}
+	return nil
+}
+
+func (i *sqlIndex) Sync(ctx context.Context, listedAt time.Time, objects []types.Object, removed []string) ([]string, *api_error.RequestError) {
+	skipped := make([]string, 0)
+	err := i.withTx(ctx, "failed to update index", func(tx *sql.Tx) error {
+		skipped = skipped[:0]
+		for _, object := range objects {
+			changed, err := changedSince(ctx, tx, object.Key, listedAt)
+			if err != nil {
+				return err
+			}
+			if changed {
+				skipped = append(skipped, object.Key)
+				continue
+			}
+			change, err := putObject(ctx, tx, object)
+			if err != nil {
+				return err
+			}
+			if change == "" {
+				continue
+			}
+			if err := recordChange(ctx, tx, change, object, ""); err != nil {
+				return err
+			}
+		}
+		for _, key := range removed {
+			changed, err := changedSince(ctx, tx, key, listedAt)
+			if err != nil {
+				return err
+			}
+			if changed {
+				skipped = append(skipped, key)
+				continue
+			}
+			existing, err := deleteObject(ctx, tx, key)
+			if err != nil {
+				return err
+			}
+			if existing == nil {
+				continue
+			}
+			if err := recordChange(ctx, tx, types.ChangeDeleted, *existing, ""); err != nil {
+				return err
+			}
+		}
+		if err := deleteEmptyFolders(ctx, tx); err != nil {
+			return err
+		}
+		return pruneChanges(ctx, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// changedSince returns true if key was written to the index, moved or had a bucket event applied at since or later
+func changedSince(ctx context.Context, tx *sql.Tx, key string, since time.Time) (bool, error) {
+	var changed bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM changes WHERE changed_at >= ? AND (key = ? OR from_key = ?))
+			OR EXISTS (SELECT 1 FROM sequencers WHERE key = ? AND recorded_at >= ?)`,
+		since.UnixNano(), key, key, key, since.UnixNano(),
+	).Scan(&changed)
+	return changed, err
+}
+
+// finish clears the checkpoint, stores the report and marks the index as built
+func (r *Reconciler) finish(ctx context.Context, report *ReconcileReport) *api_error.RequestError {
+	encoded, encodeErr := json.Marshal(report)
+	if encodeErr != nil {
+		return api_error.NewRequestError(encodeErr, api_error.InternalServerError, "failed to store reconcile report", r.logger)
+	}
+	if err := r.index.SetState(ctx, StateReconcileReport, string(encoded)); err != nil {
+		return err
+	}
+	if err := r.index.SetState(ctx, StateReconcileCheckpoint, ""); err != nil {
+		return err
+	}
+	return r.index.SetState(ctx, StateBuiltAt, report.CompletedAt.UTC().Format(time.RFC3339))
+}
+
+func appendCapped(keys []string, key string) []string {
+	if len(keys) >= maxReportedKeys {
+		return keys
+	}
+	return append(keys, key)
+}
@@ -0,0 +1,163 @@
+package index
+
+import (
+	"context"
+	"testing"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func newTestReconciler(t *testing.T, idx Index, bucket *fakeBucket) *Reconciler {
+	t.Helper()
+	logger, _ := log.NewLogerForTest()
+	return NewReconciler(logger, idx, bucket, testBucket)
+}
+
+func indexedKeys(t *testing.T, idx Index) []string {
+	t.Helper()
+	objects, err := idx.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keysOf(objects)
+}
+
+func TestReconcileMerge(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	if err := idx.Put(ctx,
+		object("a.txt", 1, "e"),
+		object("b.txt", 2, "old"),
+		object("c.txt", 3, "e"),
+		object("e.txt", 5, "e"),
+		object("g.txt", 7, "e"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := newFakeBucket(2,
+		object("a.txt", 1, "e"),
+		object("b.txt", 20, "new"),
+		object("d.txt", 4, "e"),
+		object("e.txt", 5, "e"),
+		object("f.txt", 6, "e"),
+	)
+	report, err := newTestReconciler(t, idx, bucket).Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := indexedKeys(t, idx), []string{"a.txt", "b.txt", "d.txt", "e.txt", "f.txt"}; !equalKeys(got, want) {
+		t.Errorf("index holds %v, want %v", got, want)
+	}
+	checkFolders(t, idx, map[string][2]int64{"": {36, 5}})
+	if report.Scanned != 5 || !equalKeys(report.Added, []string{"d.txt", "f.txt"}) ||
+		!equalKeys(report.Changed, []string{"b.txt"}) || !equalKeys(report.Removed, []string{"c.txt", "g.txt"}) {
+		t.Errorf("report = %+v", report)
+	}
+	if !idx.Ready(ctx) {
+		t.Error("a finished reconciliation should mark the index as built")
+	}
+	if checkpoint, _ := idx.State(ctx, StateReconcileCheckpoint); checkpoint != "" {
+		t.Errorf("checkpoint %q left after a finished reconciliation", checkpoint)
+	}
+	last, err := newTestReconciler(t, idx, bucket).LastReport(ctx)
+	if err != nil || last == nil || last.AddedCount != 2 {
+		t.Errorf("LastReport() = %+v, %v", last, err)
+	}
+}
+
+func TestReconcileResume(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	// Keys up to the checkpoint were reconciled by the interrupted run and are not looked at again
+	if err := idx.Put(ctx, object("a.txt", 1, "e"), object("b.txt", 2, "e"), object("d.txt", 4, "e")); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.SetState(ctx, StateReconcileCheckpoint, "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := newFakeBucket(2, object("c.txt", 3, "e"))
+	report, err := newTestReconciler(t, idx, bucket).Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := indexedKeys(t, idx), []string{"a.txt", "b.txt", "c.txt"}; !equalKeys(got, want) {
+		t.Errorf("index holds %v, want %v", got, want)
+	}
+	if report.ResumedFrom != "b.txt" || report.Scanned != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if checkpoint, _ := idx.State(ctx, StateReconcileCheckpoint); checkpoint != "" {
+		t.Errorf("checkpoint %q left after a finished reconciliation", checkpoint)
+	}
+}
+
+func TestReconcileEmptyTruncatedPage(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	if err := idx.Put(ctx, object("a.txt", 1, "e"), object("b.txt", 2, "e"), object("c.txt", 3, "e")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A truncated page without objects says nothing about the keys after it
+	bucket := newFakeBucket(2, object("a.txt", 1, "e"), object("b.txt", 2, "e"))
+	bucket.emptyPages = map[int]bool{0: true, 2: true}
+	report, err := newTestReconciler(t, idx, bucket).Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := indexedKeys(t, idx), []string{"a.txt", "b.txt"}; !equalKeys(got, want) {
+		t.Errorf("index holds %v, want %v", got, want)
+	}
+	if report.AddedCount != 0 || !equalKeys(report.Removed, []string{"c.txt"}) {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestReconcileLeavesConcurrentEvents(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	if err := idx.Put(ctx, object("deleted.txt", 1, "e"), object("modified.txt", 2, "old")); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := newFakeBucket(10, object("deleted.txt", 1, "e"), object("modified.txt", 2, "old"), object("listed.txt", 3, "e"))
+	// Events applied between the listing and the read of the index are newer than the listing
+	bucket.listed = func(page *s3.ListObjectsV2Output) {
+		if err := idx.Put(ctx, object("created.txt", 4, "e")); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Delete(ctx, "deleted.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.SetSequencer(ctx, "deleted.txt", "0055AED6DCD90281E5"); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Put(ctx, object("modified.txt", 20, "new")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := newTestReconciler(t, idx, bucket).Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := indexedKeys(t, idx), []string{"created.txt", "listed.txt", "modified.txt"}; !equalKeys(got, want) {
+		t.Errorf("index holds %v, want %v", got, want)
+	}
+	modified, err := idx.Get(ctx, "modified.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified.ETag != "new" {
+		t.Errorf("the listing replaced a newer version with %s", modified.ETag)
+	}
+	if !equalKeys(report.Added, []string{"listed.txt"}) || report.ChangedCount != 0 || report.RemovedCount != 0 {
+		t.Errorf("report = %+v", report)
+	}
+}
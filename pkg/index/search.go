@@ -0,0 +1,96 @@
+package index
+
+import (
+	"context"
+	"strings"
+
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// wordSeparators are the characters after which a name counts as starting a new word
+var wordSeparators = []string{" ", "_", "-", "."}
+
+// searchRanks are the match kinds in the order of the rank computed by Search
+var searchRanks = []types.SearchMatch{
+	types.SearchMatchExact,
+	types.SearchMatchPrefix,
+	types.SearchMatchWord,
+	types.SearchMatchSubstring,
+}
+
+// foldCase is how names and queries are compared ignoring case. It is done in Go because the lower
+// function of SQLite only folds ASCII letters
+func foldCase(value string) string {
+	return strings.ToLower(value)
+}
+
+// searchName is the name of a file or folder as it is stored for searches
+func searchName(path string) string {
+	return foldCase(strings.TrimSuffix(path[len(types.ParentPath(path)):], "/"))
+}
+
+// Search returns up to limit files and folders under prefix whose name contains query, ignoring case.
+// Exact names rank first, then names starting with the query, then names with a word
+// starting with the query and finally any other match. Ties go to the shortest name
+// and then to the most recently modified
+func (i *sqlIndex) Search(ctx context.Context, prefix string, query string, limit int) ([]types.SearchResult, *api_error.RequestError) {
+	query = foldCase(query)
+	pattern := escapeLike(query)
+
+	wordConditions := make([]string, 0, len(wordSeparators))
+	// Every key starting with prefix sorts between prefix and prefix followed by the highest byte
+	args := []interface{}{prefix, prefix + "\xff", prefix, prefix + "\xff", query, pattern + "%"}
+	for _, separator := range wordSeparators {
+		wordConditions = append(wordConditions, `search_name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(separator)+pattern+"%")
+	}
+	args = append(args, "%"+pattern+"%", limit)
+
+	rows, err := i.db.QueryContext(ctx, `
+		WITH entries AS (
+			SELECT key AS path, substr(key, length(parent) + 1) AS name, search_name, size, last_modified, 0 AS is_dir
+			FROM objects WHERE key >= ? AND key < ? AND substr(key, -1) != '/'
+			UNION ALL
+			SELECT path, substr(path, length(parent) + 1, length(path) - length(parent) - 1), search_name, size, last_modified, 1
+			FROM folders WHERE path > ? AND path < ?
+		)
+		SELECT path, name, size, last_modified, is_dir, CASE
+			WHEN search_name = ? THEN 0
+			WHEN search_name LIKE ? ESCAPE '\' THEN 1
+			WHEN `+strings.Join(wordConditions, " OR ")+` THEN 2
+			ELSE 3
+		END AS rank
+		FROM entries
+		WHERE search_name LIKE ? ESCAPE '\'
+		ORDER BY rank, length(name), last_modified DESC, path
+		LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to search index", i.logger)
+	}
+	defer rows.Close()
+
+	results := make([]types.SearchResult, 0)
+	for rows.Next() {
+		var result types.SearchResult
+		var lastModified int64
+		var rank int
+		if err := rows.Scan(&result.Path, &result.Name, &result.Size, &lastModified, &result.IsDir, &rank); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to search index", i.logger)
+		}
+		result.LastModified = fromUnixNano(lastModified)
+		result.Match = searchRanks[rank]
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to search index", i.logger)
+	}
+	return results, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, the query has to use ESCAPE '\'
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
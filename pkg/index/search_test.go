@@ -0,0 +1,106 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "tax", want: "tax"},
+		{value: "50%", want: `50\%`},
+		{value: "my_file", want: `my\_file`},
+		{value: `a\b`, want: `a\\b`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.value); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	objects := []types.Object{
+		{Key: "home/a/Taxes/notes.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/tax", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/taxes-2023.pdf", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/taxes-2024.pdf", Size: 1, ETag: "e", LastModified: newer},
+		{Key: "home/a/old tax return.pdf", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/syntax.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/50% off.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/500 offers.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/my_file.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/myXfile.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/a/Ébauche.txt", Size: 1, ETag: "e", LastModified: older},
+		{Key: "home/b/tax.txt", Size: 1, ETag: "e", LastModified: older},
+	}
+	if err := idx.Put(ctx, objects...); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+		match []types.SearchMatch
+	}{
+		{
+			name:  "ranked by match, then by name length, then by date",
+			query: "TAX",
+			want: []string{
+				"home/a/tax", "home/a/Taxes/", "home/a/taxes-2024.pdf", "home/a/taxes-2023.pdf",
+				"home/a/old tax return.pdf", "home/a/syntax.txt",
+			},
+			match: []types.SearchMatch{
+				types.SearchMatchExact, types.SearchMatchPrefix, types.SearchMatchPrefix, types.SearchMatchPrefix,
+				types.SearchMatchWord, types.SearchMatchSubstring,
+			},
+		},
+		{name: "percent is not a wildcard", query: "50%", want: []string{"home/a/50% off.txt"}},
+		{name: "underscore is not a wildcard", query: "my_", want: []string{"home/a/my_file.txt"}},
+		{name: "case of letters beyond ascii is ignored", query: "ébau", want: []string{"home/a/Ébauche.txt"}},
+		{name: "folder names match", query: "taxes", want: []string{"home/a/Taxes/", "home/a/taxes-2024.pdf", "home/a/taxes-2023.pdf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := idx.Search(ctx, "home/a/", tt.query, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(results))
+			for i, result := range results {
+				got[i] = result.Path
+			}
+			if !equalKeys(got, tt.want) {
+				t.Fatalf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			for i, match := range tt.match {
+				if results[i].Match != match {
+					t.Errorf("%s matched as %s, want %s", results[i].Path, results[i].Match, match)
+				}
+			}
+		})
+	}
+
+	results, err := idx.Search(ctx, "home/a/", "tax", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Search() returned %d results, want the limit of 2", len(results))
+	}
+	if results[1].IsDir != true || results[1].Name != "Taxes" {
+		t.Errorf("the folder came back as %+v", results[1])
+	}
+}
@@ -0,0 +1,37 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+)
+
+// sequencerRetention is how long the sequencer of a key is kept, notifications are not delivered
+// later than the longest a queue retains messages
+const sequencerRetention = time.Hour * 24 * 14
+
+func (i *sqlIndex) Sequencer(ctx context.Context, key string) (string, *api_error.RequestError) {
+	var sequencer string
+	err := i.db.QueryRowContext(ctx, `SELECT sequencer FROM sequencers WHERE key = ?`, key).Scan(&sequencer)
+	if err != nil && err != sql.ErrNoRows {
+		return "", api_error.NewRequestError(err, api_error.InternalServerError, "failed to read index", i.logger)
+	}
+	return sequencer, nil
+}
+
+func (i *sqlIndex) SetSequencer(ctx context.Context, key string, sequencer string) *api_error.RequestError {
+	now := time.Now()
+	return i.withTx(ctx, "failed to update index", func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO sequencers (key, sequencer, recorded_at) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET sequencer = excluded.sequencer, recorded_at = excluded.recorded_at`,
+			key, sequencer, now.UnixNano(),
+		); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM sequencers WHERE recorded_at < ?`, now.Add(-sequencerRetention).UnixNano())
+		return err
+	})
+}
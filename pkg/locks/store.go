@@ -0,0 +1,185 @@
+// Package locks keeps the advisory locks users take on files they are editing.
+package locks
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Store is the interface for the lock store
+type Store interface {
+	// Get returns the lock held on key, or nil if the file is not locked
+	Get(ctx context.Context, key string) (*types.Lock, *api_error.RequestError)
+	// List returns the locks held on files under prefix sorted by key
+	List(ctx context.Context, prefix string) ([]types.Lock, *api_error.RequestError)
+	// Acquire takes the lock, or renews it when the owner already holds it.
+	// A lock held by another user is returned as the details of a conflict error
+	Acquire(ctx context.Context, lock types.Lock) (*types.Lock, *api_error.RequestError)
+	// Release removes the lock on key held by owner, an empty owner releases the lock whoever holds it.
+	// It returns false if there was no such lock
+	Release(ctx context.Context, key string, owner string) (bool, *api_error.RequestError)
+	// Move points the lock on a moved file at its new key.
+	// Moving a folder moves the locks of everything under it
+	Move(ctx context.Context, from string, to string) *api_error.RequestError
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS locks (
+	key        TEXT PRIMARY KEY,
+	owner      TEXT NOT NULL,
+	owner_name TEXT NOT NULL,
+	note       TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS locks_expires_at ON locks(expires_at);
+`
+
+// NewStore creates the lock table if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) Get(ctx context.Context, key string) (*types.Lock, *api_error.RequestError) {
+	lock, err := scanLock(s.db.QueryRowContext(ctx, `
+		SELECT key, owner, owner_name, note, created_at, expires_at FROM locks
+		WHERE key = ? AND expires_at > ?`,
+		key, time.Now().UnixNano(),
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read lock", s.logger)
+	}
+	return lock, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, prefix string) ([]types.Lock, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key, owner, owner_name, note, created_at, expires_at FROM locks
+		WHERE substr(key, 1, length(?)) = ? AND expires_at > ?
+		ORDER BY key`,
+		prefix, prefix, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list locks", s.logger)
+	}
+	defer rows.Close()
+
+	locks := make([]types.Lock, 0)
+	for rows.Next() {
+		lock, err := scanLock(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list locks", s.logger)
+		}
+		locks = append(locks, *lock)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list locks", s.logger)
+	}
+	return locks, nil
+}
+
+func (s *sqlStore) Acquire(ctx context.Context, lock types.Lock) (*types.Lock, *api_error.RequestError) {
+	now := time.Now().UnixNano()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM locks WHERE expires_at <= ?`, now); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to take lock", s.logger)
+	}
+
+	// Only the owner can renew a lock, the insert is a no-op while someone else holds it
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO locks (key, owner, owner_name, note, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			owner_name = excluded.owner_name,
+			note = excluded.note,
+			expires_at = excluded.expires_at
+		WHERE locks.owner = excluded.owner`,
+		lock.Key, lock.Owner, lock.OwnerName, lock.Note, lock.CreatedAt.UnixNano(), lock.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to take lock", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to take lock", s.logger)
+	}
+
+	current, lockErr := s.Get(ctx, lock.Key)
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	if affected == 0 && current != nil {
+		return nil, api_error.NewRequestError(nil, api_error.ConflictError, "file is locked by "+current.OwnerName, s.logger).WithDetails(current)
+	}
+	return current, nil
+}
+
+func (s *sqlStore) Release(ctx context.Context, key string, owner string) (bool, *api_error.RequestError) {
+	query := `DELETE FROM locks WHERE key = ? AND expires_at > ?`
+	args := []interface{}{key, time.Now().UnixNano()}
+	if owner != "" {
+		query += ` AND owner = ?`
+		args = append(args, owner)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to release lock", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to release lock", s.logger)
+	}
+	return affected > 0, nil
+}
+
+func (s *sqlStore) Move(ctx context.Context, from string, to string) *api_error.RequestError {
+	var err error
+	if strings.HasSuffix(from, "/") {
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE OR REPLACE locks SET key = ? || substr(key, length(?) + 1)
+			WHERE substr(key, 1, length(?)) = ?`,
+			to, from, from, from,
+		)
+	} else {
+		_, err = s.db.ExecContext(ctx, `UPDATE OR REPLACE locks SET key = ? WHERE key = ?`, to, from)
+	}
+	if err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to move locks", s.logger)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLock(row scanner) (*types.Lock, error) {
+	var lock types.Lock
+	var createdAt, expiresAt int64
+	if err := row.Scan(&lock.Key, &lock.Owner, &lock.OwnerName, &lock.Note, &createdAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	lock.CreatedAt = time.Unix(0, createdAt)
+	lock.ExpiresAt = time.Unix(0, expiresAt)
+	return &lock, nil
+}
@@ -0,0 +1,135 @@
+// Package notifications keeps the in-app notifications of each user.
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/google/uuid"
+)
+
+// Store is the interface for the notification store
+type Store interface {
+	// Add saves a new unread notification for the user
+	Add(ctx context.Context, userID string, notification types.Notification) (*types.Notification, *api_error.RequestError)
+	// List returns up to limit notifications of the user, the newest first. unread leaves out the ones already read
+	List(ctx context.Context, userID string, unread bool, limit int) ([]types.Notification, *api_error.RequestError)
+	// Read marks the notifications of the user with the given IDs as read, every one of them when ids is empty.
+	// It returns how many were unread
+	Read(ctx context.Context, userID string, ids []string) (int64, *api_error.RequestError)
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS notifications (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	kind       TEXT NOT NULL,
+	message    TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	read_at    INTEGER
+);
+CREATE INDEX IF NOT EXISTS notifications_user ON notifications(user_id, created_at);
+`
+
+// NewStore creates the notification table if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) Add(ctx context.Context, userID string, notification types.Notification) (*types.Notification, *api_error.RequestError) {
+	notification.ID = uuid.New().String()
+	notification.ReadAt = nil
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now().UTC()
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO notifications (id, user_id, kind, message, key, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		notification.ID, userID, notification.Kind, notification.Message, notification.Key, notification.CreatedAt.UnixNano(),
+	); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to add notification", s.logger)
+	}
+	return &notification, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, userID string, unread bool, limit int) ([]types.Notification, *api_error.RequestError) {
+	query := `SELECT id, kind, message, key, created_at, read_at FROM notifications WHERE user_id = ?`
+	if unread {
+		query += ` AND read_at IS NULL`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY created_at DESC, id LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list notifications", s.logger)
+	}
+	defer rows.Close()
+
+	notifications := make([]types.Notification, 0)
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list notifications", s.logger)
+		}
+		notifications = append(notifications, *notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list notifications", s.logger)
+	}
+	return notifications, nil
+}
+
+func (s *sqlStore) Read(ctx context.Context, userID string, ids []string) (int64, *api_error.RequestError) {
+	query := `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	args := []interface{}{time.Now().UnixNano(), userID}
+	if len(ids) > 0 {
+		query += ` AND id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read notifications", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read notifications", s.logger)
+	}
+	return affected, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanNotification(row scanner) (*types.Notification, error) {
+	var notification types.Notification
+	var createdAt int64
+	var readAt sql.NullInt64
+	if err := row.Scan(&notification.ID, &notification.Kind, &notification.Message, &notification.Key, &createdAt, &readAt); err != nil {
+		return nil, err
+	}
+	notification.CreatedAt = time.Unix(0, createdAt).UTC()
+	if readAt.Valid {
+		at := time.Unix(0, readAt.Int64).UTC()
+		notification.ReadAt = &at
+	}
+	return &notification, nil
+}
@@ -0,0 +1,187 @@
+// Package quotas keeps the storage limits of each user's space and of the household.
+package quotas
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Household is the subject of the quota covering the whole drive
+const Household = "household"
+
+// ReservationTTL is how long an upload that has not arrived holds its room under the quotas.
+// It matches the lifetime of the presigned upload
+const ReservationTTL = time.Minute * 15
+
+// Reservation is the room an upload on its way holds under the quotas
+type Reservation struct {
+	// ID tells the reservation apart from those of other uploads of the same key
+	ID  string
+	Key string
+	// Owner is the ID of the user whose home the upload goes to, empty outside of the homes
+	Owner   string
+	Bytes   int64
+	Objects int64
+	At      time.Time
+}
+
+// Defaults are the quotas applying to subjects without their own
+type Defaults struct {
+	User      types.Quota
+	Household types.Quota
+}
+
+// Store is the interface for the quota store
+type Store interface {
+	// Get returns the quota of a user, or of the household, falling back to the defaults
+	Get(ctx context.Context, subject string) (types.Quota, *api_error.RequestError)
+	// Set gives a user, or the household, its own quota
+	Set(ctx context.Context, subject string, quota types.Quota) *api_error.RequestError
+	// Reset removes the quota of a subject so the default applies again, it returns false if there was none
+	Reset(ctx context.Context, subject string) (bool, *api_error.RequestError)
+	// Reserve holds the room of an upload if it fits in every usage, keyed by subject, along with the room
+	// the other uploads on their way hold. Every upload holds its own room, even uploads of the same key.
+	// It returns the subject whose quota the upload would exceed and its usage, or an empty subject once reserved
+	Reserve(ctx context.Context, reservation Reservation, usages map[string]types.Usage) (string, types.Usage, *api_error.RequestError)
+	// Reserved returns true if an upload of key on its way holds room
+	Reserved(ctx context.Context, key string) (bool, *api_error.RequestError)
+	// Release drops the reservation with the given ID, once its upload arrived or did not go ahead
+	Release(ctx context.Context, id string) *api_error.RequestError
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS quotas (
+	subject     TEXT PRIMARY KEY,
+	max_bytes   INTEGER NOT NULL,
+	max_objects INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS quota_reservations (
+	id          TEXT PRIMARY KEY,
+	key         TEXT NOT NULL,
+	owner       TEXT NOT NULL,
+	bytes       INTEGER NOT NULL,
+	objects     INTEGER NOT NULL,
+	reserved_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS quota_reservations_key ON quota_reservations(key);
+CREATE INDEX IF NOT EXISTS quota_reservations_owner ON quota_reservations(owner);
+`
+
+// NewStore creates the quota table if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB, defaults Defaults) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:       db,
+		defaults: defaults,
+		logger:   logger,
+	}
+}
+
+type sqlStore struct {
+	db       *sql.DB
+	defaults Defaults
+	logger   log.Logger
+}
+
+func (s *sqlStore) Get(ctx context.Context, subject string) (types.Quota, *api_error.RequestError) {
+	var quota types.Quota
+	err := s.db.QueryRowContext(ctx, `SELECT max_bytes, max_objects FROM quotas WHERE subject = ?`, subject).Scan(&quota.MaxBytes, &quota.MaxObjects)
+	if err == sql.ErrNoRows {
+		if subject == Household {
+			return s.defaults.Household, nil
+		}
+		return s.defaults.User, nil
+	}
+	if err != nil {
+		return quota, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read quota", s.logger)
+	}
+	return quota, nil
+}
+
+func (s *sqlStore) Set(ctx context.Context, subject string, quota types.Quota) *api_error.RequestError {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO quotas (subject, max_bytes, max_objects) VALUES (?, ?, ?)
+		ON CONFLICT (subject) DO UPDATE SET max_bytes = excluded.max_bytes, max_objects = excluded.max_objects`,
+		subject, quota.MaxBytes, quota.MaxObjects,
+	); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to save quota", s.logger)
+	}
+	return nil
+}
+
+func (s *sqlStore) Reset(ctx context.Context, subject string) (bool, *api_error.RequestError) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM quotas WHERE subject = ?`, subject)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to reset quota", s.logger)
+	}
+	count, _ := res.RowsAffected()
+	return count > 0, nil
+}
+
+func (s *sqlStore) Reserve(ctx context.Context, reservation Reservation, usages map[string]types.Usage) (string, types.Usage, *api_error.RequestError) {
+	// The transaction makes concurrent uploads count each other in
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", types.Usage{}, api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve quota", s.logger)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM quota_reservations WHERE reserved_at <= ?`,
+		reservation.At.Add(-ReservationTTL).UnixNano(),
+	); err != nil {
+		return "", types.Usage{}, api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve quota", s.logger)
+	}
+	for subject, usage := range usages {
+		query := `SELECT COALESCE(SUM(bytes), 0), COALESCE(SUM(objects), 0) FROM quota_reservations`
+		args := []interface{}{}
+		if subject != Household {
+			query += ` WHERE owner = ?`
+			args = append(args, subject)
+		}
+		var bytes, objects int64
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&bytes, &objects); err != nil {
+			return "", types.Usage{}, api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve quota", s.logger)
+		}
+		usage = types.NewUsage(usage.Bytes+bytes, usage.Objects+objects, usage.Quota)
+		if !usage.Allows(reservation.Bytes, reservation.Objects) {
+			return subject, usage, nil
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO quota_reservations (id, key, owner, bytes, objects, reserved_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		// A replacement smaller than the file it replaces frees its room once it arrives, not before
+		reservation.ID, reservation.Key, reservation.Owner, max(reservation.Bytes, 0), reservation.Objects, reservation.At.UnixNano(),
+	); err != nil {
+		return "", types.Usage{}, api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve quota", s.logger)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", types.Usage{}, api_error.NewRequestError(err, api_error.InternalServerError, "failed to reserve quota", s.logger)
+	}
+	return "", types.Usage{}, nil
+}
+
+func (s *sqlStore) Reserved(ctx context.Context, key string) (bool, *api_error.RequestError) {
+	var reserved bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM quota_reservations WHERE key = ? AND reserved_at > ?)`,
+		key, time.Now().Add(-ReservationTTL).UnixNano(),
+	).Scan(&reserved); err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to read quota reservations", s.logger)
+	}
+	return reserved, nil
+}
+
+func (s *sqlStore) Release(ctx context.Context, id string) *api_error.RequestError {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM quota_reservations WHERE id = ?`, id); err != nil {
+		return api_error.NewRequestError(err, api_error.InternalServerError, "failed to release quota", s.logger)
+	}
+	return nil
+}
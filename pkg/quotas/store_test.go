@@ -0,0 +1,148 @@
+package quotas
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db, Defaults{})
+}
+
+// newFileStore opens a database file the way the server does, so several connections write at the same time
+func newFileStore(t *testing.T) Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quotas.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db, Defaults{})
+}
+
+// householdUsage is an empty household allowing up to maxBytes
+func householdUsage(maxBytes int64) map[string]types.Usage {
+	return map[string]types.Usage{Household: types.NewUsage(0, 0, types.Quota{MaxBytes: maxBytes})}
+}
+
+func reservation(id string, key string, bytes int64, at time.Time) Reservation {
+	return Reservation{ID: id, Key: key, Bytes: bytes, Objects: 1, At: at}
+}
+
+func TestReserveConcurrently(t *testing.T) {
+	ctx := context.Background()
+	store := newFileStore(t)
+
+	// Room for 5 uploads of 10 bytes, asked for by 20 uploads at once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exceeded, _, err := store.Reserve(ctx, reservation(fmt.Sprint(i), fmt.Sprintf("file-%d", i), 10, now), householdUsage(50))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if exceeded == "" {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if reserved != 5 {
+		t.Errorf("%d uploads were reserved, want 5", reserved)
+	}
+}
+
+func TestReserveSameKey(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Now()
+
+	// Two uploads of the same key hold their own room
+	for _, id := range []string{"first", "second"} {
+		exceeded, _, err := store.Reserve(ctx, reservation(id, "a.txt", 10, now), householdUsage(20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exceeded != "" {
+			t.Fatalf("upload %s exceeded the quota of %s", id, exceeded)
+		}
+	}
+	exceeded, usage, err := store.Reserve(ctx, reservation("third", "b.txt", 10, now), householdUsage(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exceeded != Household || usage.Bytes != 20 {
+		t.Errorf("a third upload exceeded %q with %d bytes used, want the household with 20", exceeded, usage.Bytes)
+	}
+
+	// The arrival of one leaves the other in place
+	if err := store.Release(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := store.Reserved(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reserved {
+		t.Error("releasing the first upload released the second")
+	}
+	if exceeded, _, err := store.Reserve(ctx, reservation("third", "b.txt", 10, now), householdUsage(20)); err != nil || exceeded != "" {
+		t.Errorf("the room of the released upload was not given back: %q, %v", exceeded, err)
+	}
+}
+
+func TestReservationExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	expired := time.Now().Add(-ReservationTTL - time.Minute)
+	if exceeded, _, err := store.Reserve(ctx, reservation("old", "a.txt", 10, expired), householdUsage(10)); err != nil || exceeded != "" {
+		t.Fatalf("Reserve() = %q, %v", exceeded, err)
+	}
+	reserved, err := store.Reserved(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved {
+		t.Error("an expired reservation still holds its key")
+	}
+
+	// The expired upload no longer counts against the quota
+	exceeded, _, err := store.Reserve(ctx, reservation("new", "b.txt", 10, time.Now()), householdUsage(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exceeded != "" {
+		t.Errorf("an expired reservation still counts against the quota of %s", exceeded)
+	}
+}
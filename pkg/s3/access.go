@@ -0,0 +1,155 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/middleware"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/acl"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// canRead returns true if the user is allowed to see the file or folder at key
+func (c *controller) canRead(ctx context.Context, user *types.User, key string) bool {
+	rules, err := c.accessRules(ctx, key)
+	if err != nil {
+		return false
+	}
+	return allows(rules, user, key, types.PermissionRead)
+}
+
+// authorize returns a forbidden error unless the user holds perm on key
+func (c *controller) authorize(ctx context.Context, scope *Scope, key string, perm types.Permission) *error.RequestError {
+	rules, err := c.accessRules(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !allows(rules, scope.User, key, perm) {
+		path, _ := scope.Path(key)
+		return error.NewRequestError(nil, error.ForbiddenError, fmt.Sprintf("%s permission is required on %s", perm, path), nil)
+	}
+	return nil
+}
+
+// accessRules returns the grants covering prefix and everything under it
+func (c *controller) accessRules(ctx context.Context, prefix string) (acl.Rules, *error.RequestError) {
+	if c.acl == nil {
+		return nil, nil
+	}
+	return c.acl.Covering(ctx, prefix)
+}
+
+// allows returns true if the user holds perm on key. Administrators hold every permission,
+// the grants and the defaults of the space decide for everyone else
+func allows(rules acl.Rules, user *types.User, key string, perm types.Permission) bool {
+	if user == nil {
+		return false
+	}
+	if administers(user) {
+		return true
+	}
+	return rules.Allows(user, key, perm)
+}
+
+// pruneUnreadable removes the files and folders under folder the user cannot read.
+// prefix is the bucket prefix of folder
+func pruneUnreadable(rules acl.Rules, user *types.User, folder *types.Folder, prefix string) {
+	// Without grants only child accounts have folders they cannot read
+	if len(rules) == 0 && !user.IsKid() {
+		return
+	}
+	items := folder.Items[:0]
+	for _, item := range folder.Items {
+		switch v := item.(type) {
+		case *types.File:
+			if allows(rules, user, prefix+v.Name, types.PermissionRead) {
+				items = append(items, v)
+			}
+		case *types.Folder:
+			if allows(rules, user, prefix+v.Name+"/", types.PermissionRead) {
+				pruneUnreadable(rules, user, v, prefix+v.Name+"/")
+				items = append(items, v)
+			}
+		}
+	}
+	folder.Items = items
+}
+
+// administers returns true if the groups of the user allow them to administer the drive
+func administers(user *types.User) bool {
+	return middleware.Allows(user, types.ActionAdminister)
+}
+
+// hidesUnder returns true if the grants may hide part of what is under prefix from the user
+func hidesUnder(rules acl.Rules, user *types.User, prefix string) bool {
+	if administers(user) {
+		return false
+	}
+	if user.IsKid() {
+		return !strings.HasPrefix(prefix, types.KidPrefix(user))
+	}
+	for _, grant := range rules {
+		// Only a deny of read hides anything, denying more leaves the files readable
+		if len(grant.Path) > len(prefix) && strings.HasPrefix(grant.Path, prefix) && grant.Deny &&
+			types.PermissionRead.Includes(grant.Permission) && grant.AppliesTo(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// readableTotals recomputes the size and last modified time of a folder listed from the index, and of its
+// sub folders, from the files the user can read. Totals of the index cover everything, without this
+// they would tell about the files the grants hide. prefix is the bucket prefix of folder
+func (c *controller) readableTotals(ctx context.Context, rules acl.Rules, user *types.User, folder *types.Folder, prefix string) *error.RequestError {
+	if !hidesUnder(rules, user, prefix) {
+		return nil
+	}
+	objects, err := c.metadata.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	folders := make(map[string]*types.Folder)
+	for _, item := range folder.Items {
+		if sub, ok := item.(*types.Folder); ok {
+			sub.Size, sub.LastModified = 0, time.Time{}
+			folders[sub.Name] = sub
+		}
+	}
+	folder.Size, folder.LastModified = 0, time.Time{}
+	add := func(folder *types.Folder, object types.Object) {
+		folder.Size += object.Size
+		if object.LastModified.After(folder.LastModified) {
+			folder.LastModified = object.LastModified
+		}
+	}
+	for _, object := range objects {
+		if !allows(rules, user, object.Key, types.PermissionRead) {
+			continue
+		}
+		add(folder, object)
+		name, _, nested := strings.Cut(strings.TrimPrefix(object.Key, prefix), "/")
+		if sub, ok := folders[name]; ok && nested {
+			add(sub, object)
+		}
+	}
+	return nil
+}
+
+// addRules covers the grants with the entity tag of a listing, so changing them changes the listing
+func addRules(etag *listingETag, rules acl.Rules) {
+	for _, grant := range rules {
+		etag.add(fmt.Sprintf("%s\x00%s:%s", grant.Path, grant.PrincipalType, grant.Principal), fmt.Sprintf("%s:%t", grant.Permission, grant.Deny), 0)
+	}
+}
+
+func (c *controller) requireACL() *error.RequestError {
+	if c.acl == nil {
+		return error.NewRequestError(fmt.Errorf("acl store is not configured"), error.InternalServerError, "access control lists are not available", c.logger)
+	}
+	return nil
+}
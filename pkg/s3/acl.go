@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// GetACL returns the grants set on a folder, the ones it inherits and the permissions of the caller on it
+func (c *controller) GetACL(scope *Scope, path string) (*types.ACL, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireACL(); err != nil {
+		return nil, err
+	}
+	prefix, err := scope.Prefix(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := c.accessRules(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !allows(rules, scope.User, prefix, types.PermissionRead) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "read permission is required on the folder", nil)
+	}
+
+	res := &types.ACL{
+		Path:        relativePath(scope, prefix),
+		Grants:      make([]types.Grant, 0),
+		Inherited:   make([]types.Grant, 0),
+		Permissions: make([]types.Permission, 0),
+	}
+	for _, grant := range rules {
+		if grant.Path == prefix {
+			res.Grants = append(res.Grants, relativeGrant(scope, grant))
+		}
+	}
+	for _, grant := range rules.Above(prefix) {
+		res.Inherited = append(res.Inherited, relativeGrant(scope, grant))
+	}
+	for _, perm := range []types.Permission{types.PermissionRead, types.PermissionWrite, types.PermissionManage} {
+		if allows(rules, scope.User, prefix, perm) {
+			res.Permissions = append(res.Permissions, perm)
+		}
+	}
+	return res, nil
+}
+
+// PutGrant sets the grant of a user or group on a folder, it needs the manage permission.
+// Grants are only set in the family space: homes stay private and nobody else can browse them,
+// so a grant there would give nothing
+func (c *controller) PutGrant(scope *Scope, req *types.GrantRequest) (*types.Grant, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireACL(); err != nil {
+		return nil, err
+	}
+	if req.PrincipalType != types.PrincipalUser && req.PrincipalType != types.PrincipalGroup {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "principalType must be either user or group", nil)
+	}
+	if req.Principal == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "principal is required", nil)
+	}
+	if !req.Permission.Valid() {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "permission must be read, write or manage", nil)
+	}
+	prefix, err := scope.Prefix(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(prefix, types.FamilyPrefix) {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "grants can only be set on folders of the family space", nil)
+	}
+	if err := c.authorize(ctx, scope, prefix, types.PermissionManage); err != nil {
+		return nil, err
+	}
+
+	grant := types.Grant{
+		Path:          prefix,
+		PrincipalType: req.PrincipalType,
+		Principal:     req.Principal,
+		Permission:    req.Permission,
+		Deny:          req.Deny,
+		CreatedBy:     scope.User.ID,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if err := c.acl.Put(ctx, grant); err != nil {
+		return nil, err
+	}
+	res := relativeGrant(scope, grant)
+	return &res, nil
+}
+
+// DeleteGrant removes the grant of a user or group on a folder, it needs the manage permission
+func (c *controller) DeleteGrant(scope *Scope, path string, principalType types.PrincipalType, principal string) *error.RequestError {
+	ctx := context.TODO()
+	if err := c.requireACL(); err != nil {
+		return err
+	}
+	prefix, err := scope.Prefix(path)
+	if err != nil {
+		return err
+	}
+	if err := c.authorize(ctx, scope, prefix, types.PermissionManage); err != nil {
+		return err
+	}
+
+	deleted, err := c.acl.Delete(ctx, prefix, principalType, principal)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return error.NewRequestError(nil, error.NotFoundError, "grant not found", nil)
+	}
+	return nil
+}
+
+// relativeGrant returns the grant with its path relative to the space.
+// Grants set above the root of the space are shown on the root
+func relativeGrant(scope *Scope, grant types.Grant) types.Grant {
+	grant.Path = relativePath(scope, grant.Path)
+	return grant
+}
+
+func relativePath(scope *Scope, key string) string {
+	path, _ := scope.Path(key)
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"context"
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// checkUploadConditions compares the preconditions of an upload with the current version of the file.
+// It returns the headers that let S3 enforce the same conditions when the presigned upload is made,
+// closing the gap between this check and the upload
+func (c *controller) checkUploadConditions(ctx context.Context, scope *Scope, bucket string, key string, req *types.UploadRequest) (map[string]string, *error.RequestError) {
+	if req.IfMatch == "" && req.IfNoneMatch == "" {
+		return nil, nil
+	}
+	if req.IfNoneMatch != "" && req.IfNoneMatch != "*" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, `ifNoneMatch only supports "*"`, c.logger)
+	}
+
+	current, err := c.headObject(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		current.Key, _ = scope.Path(key)
+	}
+
+	headers := make(map[string]string)
+	if req.IfNoneMatch == "*" {
+		if current != nil {
+			return nil, error.NewRequestError(nil, error.ConflictError, "file already exists", c.logger).WithDetails(current)
+		}
+		headers["If-None-Match"] = "*"
+	}
+	if req.IfMatch != "" {
+		if current == nil {
+			return nil, error.NewRequestError(nil, error.PreconditionFailedError, "file does not exist", c.logger)
+		}
+		if !etagEqual(current.ETag, req.IfMatch) {
+			return nil, error.NewRequestError(nil, error.PreconditionFailedError, "file was changed by someone else", c.logger).WithDetails(current)
+		}
+		headers["If-Match"] = current.ETag
+	}
+	return headers, nil
+}
+
+// headObject returns the current version of a file, or nil if it does not exist
+func (c *controller) headObject(ctx context.Context, bucket string, key string) (*types.Object, *error.RequestError) {
+	res, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if err.Status == error.NotFoundError {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	object := &types.Object{
+		Key:  key,
+		Size: res.ContentLength,
+		ETag: aws.ToString(res.ETag),
+	}
+	if res.LastModified != nil {
+		object.LastModified = *res.LastModified
+	}
+	return object, nil
+}
+
+// etagEqual compares two etags ignoring quotes and weak markers
+func etagEqual(a string, b string) bool {
+	normalize := func(etag string) string {
+		return strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+	}
+	return normalize(a) == normalize(b)
+}
@@ -3,12 +3,25 @@ package s3
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/acl"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/activity"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/dropboxes"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/favorites"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/filetree"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/fulltext"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/locks"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/notifications"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/quotas"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/shares"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -16,90 +29,317 @@ import (
 
 // Controller is the interface for the s3 controller
 type Controller interface {
-	ListObjects() (*types.Folder, *error.RequestError)
-	ListFolder(prefix string) (*types.Folder, *error.RequestError)
-	GetFolderSize(prefix string) (int64, *error.RequestError)
-	GetObject(key string) (string, *error.RequestError)
-	UploadObject(file string) (string, *error.RequestError)
+	ListObjects(scope *Scope, prefix string, depth int, filter *Filter) (*types.Folder, string, *error.RequestError)
+	ListFolder(scope *Scope, prefix string, filter *Filter) (*types.Folder, string, *error.RequestError)
+	GetFolderSize(ctx context.Context, prefix string, parallel bool) (*types.FolderSize, *error.RequestError)
+	StartFolderSizeJob(scope *Scope, prefix string, refresh bool) (*types.FolderSizeJob, *error.RequestError)
+	GetFolderSizeJob(scope *Scope, id string) (*types.FolderSizeJob, *error.RequestError)
+	HandleObjectEvent(ctx context.Context, event types.ObjectEvent) *error.RequestError
+	GetChanges(scope *Scope, cursor string, limit int) (*types.ChangeFeed, *error.RequestError)
+	Search(scope *Scope, query string, limit int) (*types.SearchResults, *error.RequestError)
+	SearchContent(scope *Scope, query string, limit int) (*types.ContentSearchResults, *error.RequestError)
+	GetRecent(scope *Scope, cursor string, limit int, location *time.Location) (*types.RecentFeed, *error.RequestError)
+	GetObject(scope *Scope, path string) (string, *error.RequestError)
+	UploadObject(scope *Scope, req *types.UploadRequest) (*types.PresignedURL, *error.RequestError)
+	LockObject(scope *Scope, req *types.LockRequest) (*types.Lock, *error.RequestError)
+	UnlockObject(scope *Scope, path string, force bool) *error.RequestError
+	GetLock(scope *Scope, path string) (*types.Lock, *error.RequestError)
+	AddFavorite(scope *Scope, path string) (*types.Favorite, *error.RequestError)
+	RemoveFavorite(scope *Scope, path string) *error.RequestError
+	ListFavorites(scope *Scope) ([]types.Favorite, *error.RequestError)
+	GetACL(scope *Scope, path string) (*types.ACL, *error.RequestError)
+	PutGrant(scope *Scope, req *types.GrantRequest) (*types.Grant, *error.RequestError)
+	DeleteGrant(scope *Scope, path string, principalType types.PrincipalType, principal string) *error.RequestError
+	GetKidActivity(scope *Scope, userID string, since time.Time) (*types.ActivitySummary, *error.RequestError)
+	RecordAccount(ctx context.Context, user *types.User)
+	GetUsage(scope *Scope, userID string) (*types.StorageUsage, *error.RequestError)
+	SetQuota(scope *Scope, subject string, quota types.Quota) *error.RequestError
+	ResetQuota(scope *Scope, subject string) *error.RequestError
+	GetUsageReport(ctx context.Context) (*types.UsageReport, *error.RequestError)
+	CreateShare(scope *Scope, req *types.ShareRequest) (*types.ShareLink, *error.RequestError)
+	ListShares(scope *Scope) ([]types.ShareLink, *error.RequestError)
+	RevokeShare(scope *Scope, id string) *error.RequestError
+	OpenShare(ctx context.Context, token string, password string, path string) (*types.SharedItem, *error.RequestError)
+	DownloadShare(ctx context.Context, token string, password string, path string) (*types.SharedItem, *error.RequestError)
+	CreateDropBox(scope *Scope, req *types.DropBoxRequest) (*types.DropBox, *error.RequestError)
+	ListDropBoxes(scope *Scope) ([]types.DropBox, *error.RequestError)
+	RevokeDropBox(scope *Scope, id string) *error.RequestError
+	ListDropUploads(scope *Scope, id string) ([]types.DropUpload, *error.RequestError)
+	OpenDropBox(ctx context.Context, token string) (*types.DropBoxInfo, *error.RequestError)
+	DropFile(ctx context.Context, token string, req *types.DropUploadRequest) (*types.PresignedURL, *error.RequestError)
+	ListNotifications(scope *Scope, unread bool, limit int) ([]types.Notification, *error.RequestError)
+	ReadNotifications(scope *Scope, ids []string) *error.RequestError
 	DeleteObject()
 }
 
+// Deps are the driver and stores the controller is built on.
+// Every store is optional. Without the metadata index every request goes to the bucket,
+// without the others the feature they back (locks, full-text search, recent downloads, favorites, folder grants,
+// quotas, share links, drop boxes, notifications) is unavailable. Without grants every user keeps the default
+// permissions of each space and without quotas uploads are not limited. Kids limits the uploads of child accounts
+type Deps struct {
+	S3        api_aws.S3Driver
+	Metadata  index.Index
+	Locks     locks.Store
+	FullText  fulltext.Store
+	Activity  activity.Store
+	Favorites favorites.Store
+	ACL       acl.Store
+	Quotas    quotas.Store
+	Shares    shares.Store
+	DropBoxes dropboxes.Store
+	// Notifications tells the owners of drop boxes when files arrive
+	Notifications notifications.Store
+	Kids          KidPolicy
+	// Events is set when bucket events reach HandleObjectEvent. Quotas are only enforced with them,
+	// the arrival of an upload is what gives back the room it held
+	Events bool
+}
+
 // NewController creates a new controller
-func NewController(logger log.Logger, s3Client api_aws.S3Driver) Controller {
+func NewController(logger log.Logger, deps Deps) Controller {
 	return &controller{
-		logger:   logger,
-		s3Client: s3Client,
+		logger:        logger,
+		s3Client:      deps.S3,
+		metadata:      deps.Metadata,
+		locks:         deps.Locks,
+		fulltext:      deps.FullText,
+		activity:      deps.Activity,
+		favorites:     deps.Favorites,
+		acl:           deps.ACL,
+		quotas:        deps.Quotas,
+		shares:        deps.Shares,
+		dropBoxes:     deps.DropBoxes,
+		notifications: deps.Notifications,
+		kids:          deps.Kids,
+		events:        deps.Events,
+		sizeJobs:      newSizeJobStore(),
 	}
 }
 
 type controller struct {
-	logger   log.Logger
-	s3Client api_aws.S3Driver
+	logger        log.Logger
+	s3Client      api_aws.S3Driver
+	metadata      index.Index
+	locks         locks.Store
+	fulltext      fulltext.Store
+	activity      activity.Store
+	favorites     favorites.Store
+	acl           acl.Store
+	quotas        quotas.Store
+	shares        shares.Store
+	dropBoxes     dropboxes.Store
+	notifications notifications.Store
+	kids          KidPolicy
+	events        bool
+	sizeJobs      *sizeJobStore
+	// accounts holds whether each user was last recorded as a child account
+	accounts sync.Map
 }
 
-func (c *controller) ListObjects() (*types.Folder, *error.RequestError) {
-	bucket := "morales-storage-drive"
-	var continuationToken *string
+// ListObjects builds the file tree of every object under prefix. When depth is greater
+// than zero only that many levels below the prefix are returned, folders whose children
+// were cut off are marked as truncated. Folder sizes always cover the full subtree.
+// The entity tag of the listing is returned along with the tree
+func (c *controller) ListObjects(scope *Scope, prefix string, depth int, filter *Filter) (*types.Folder, string, *error.RequestError) {
+	ctx := context.Background()
+	bucket := api_aws.BucketName
+
+	name := "/"
+	if path := strings.Trim(prefix, "/"); path != "" {
+		name = path
+	}
+	prefix, err := scope.Prefix(prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	rules, err := c.accessRules(ctx, prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	if !allows(rules, scope.User, prefix, types.PermissionRead) {
+		return nil, "", error.NewRequestError(nil, error.ForbiddenError, "read permission is required on the folder", nil)
+	}
 	// Create root folder
-	folder := &types.Folder{
-		Name:         "/",
-		Size:         0,
-		Items:        make([]types.FileItem, 0),
-		LastModified: time.Now(),
-		IsDir:        true,
+	tree := filetree.NewBuilder(name)
+	etag := newListingETag()
+	hides := hidesUnder(rules, scope.User, prefix)
+	add := func(object types.Object) *error.RequestError {
+		etag.add(object.Key, object.ETag, object.Size)
+		// Skip the marker object of the prefix itself, and the files the user cannot read so the
+		// folders above do not count them
+		if object.Key != prefix && (!hides || allows(rules, scope.User, object.Key, types.PermissionRead)) {
+			tree.Add(strings.TrimPrefix(object.Key, prefix), object.Size, object.LastModified)
+		}
+		return nil
 	}
 
-	for {
-		res, err := c.s3Client.ListObjects(context.Background(), &s3.ListObjectsV2Input{
-			Bucket:            &bucket,
-			ContinuationToken: continuationToken,
-		})
+	if c.metadataReady(ctx) {
+		objects, err := c.metadata.List(ctx, prefix)
 		if err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		for _, object := range objects {
+			add(object)
 		}
+	} else if err := index.Walk(ctx, c.s3Client, bucket, prefix, add); err != nil {
+		return nil, "", err
+	}
 
-		for _, item := range res.Contents {
-			if item.Key == nil {
-				continue
-			}
-			buildFileTree(folder, *item.Key, item.Size, *item.LastModified)
-			// add the size of the file
-			folder.Size += item.Size
+	folder := tree.Root()
+	pruneUnreadable(rules, scope.User, folder, prefix)
+	addRules(etag, rules)
+	filter.Apply(folder)
+	filetree.Truncate(folder, depth)
+	setSpace(folder, scope.Space)
+	if err := c.attachLocks(ctx, folder, prefix, etag); err != nil {
+		return nil, "", err
+	}
+	return folder, etag.String(), nil
+}
+
+// ListFolder lists the files and folders directly under prefix along with the entity tag of the listing.
+// Items show who holds their lock and whether the user starred them. When the client did not pick a space,
+// the root of the drive lists the spaces of the user side by side
+func (c *controller) ListFolder(scope *Scope, prefix string, filter *Filter) (*types.Folder, string, *error.RequestError) {
+	ctx := context.TODO()
+	if scope.Implicit && strings.Trim(prefix, "/") == "" {
+		return c.listSpaces(ctx, scope.User, filter)
+	}
+	prefix, err := scope.Prefix(prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	rules, err := c.accessRules(ctx, prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	if !allows(rules, scope.User, prefix, types.PermissionRead) {
+		return nil, "", error.NewRequestError(nil, error.ForbiddenError, "read permission is required on the folder", nil)
+	}
+
+	var root *types.Folder
+	var etag *listingETag
+	ready := c.metadataReady(ctx)
+	if ready {
+		root, etag, err = c.listFolderFromIndex(prefix, filter)
+	} else {
+		root, etag, err = c.listFolderFromBucket(prefix, filter)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	pruneUnreadable(rules, scope.User, root, prefix)
+	if ready {
+		if err := c.readableTotals(ctx, rules, scope.User, root, prefix); err != nil {
+			return nil, "", err
+		}
+	}
+	addRules(etag, rules)
+
+	if err := c.attachLocks(ctx, root, prefix, etag); err != nil {
+		return nil, "", err
+	}
+	if err := c.attachFavorites(ctx, scope.User, root, prefix, etag); err != nil {
+		return nil, "", err
+	}
+	if root.Name, _ = scope.Path(prefix); root.Name == "" {
+		root.Name = "/"
+	}
+	setSpace(root, scope.Space)
+	return root, etag.String(), nil
+}
+
+// listSpaces lists the spaces of the user as the folders of the root of the drive
+func (c *controller) listSpaces(ctx context.Context, user *types.User, filter *Filter) (*types.Folder, string, *error.RequestError) {
+	etag := newListingETag()
+	root := &types.Folder{
+		Name:  "/",
+		Items: make([]types.FileItem, 0),
+		IsDir: true,
+	}
+
+	for _, space := range spacesOf(user) {
+		scope, err := NewScope(user, space)
+		if err != nil {
+			return nil, "", err
+		}
+		folder := &types.Folder{
+			Name:  string(space),
+			Items: make([]types.FileItem, 0),
+			IsDir: true,
+			Space: space,
 		}
-		if !res.IsTruncated {
-			break
+		// Without the index the size of a space is only known through a folder size job
+		if c.metadataReady(ctx) {
+			stats, err := c.metadata.FolderStats(ctx, scope.Root)
+			if err != nil {
+				return nil, "", err
+			}
+			folder.Size = stats.Size
+			folder.LastModified = stats.LastModified
+			etag.add(scope.Root, fmt.Sprintf("%d:%d", stats.Objects, stats.LastModified.UnixNano()), stats.Size)
+
+			rules, err := c.accessRules(ctx, scope.Root)
+			if err != nil {
+				return nil, "", err
+			}
+			if err := c.readableTotals(ctx, rules, user, folder, scope.Root); err != nil {
+				return nil, "", err
+			}
+			addRules(etag, rules)
 		} else {
-			continuationToken = res.NextContinuationToken
+			etag.add(scope.Root, "", 0)
+		}
+
+		root.Size += folder.Size
+		if folder.LastModified.After(root.LastModified) {
+			root.LastModified = folder.LastModified
+		}
+		if filter.MatchFolders() {
+			root.Items = append(root.Items, folder)
 		}
 	}
+	return root, etag.String(), nil
+}
 
-	return folder, nil
+// setSpace marks the folder and its items as part of space
+func setSpace(folder *types.Folder, space types.Space) {
+	folder.Space = space
+	for _, item := range folder.Items {
+		switch v := item.(type) {
+		case *types.File:
+			v.Space = space
+		case *types.Folder:
+			setSpace(v, space)
+		}
+	}
 }
 
-func (c *controller) ListFolder(prefix string) (*types.Folder, *error.RequestError) {
-	bucket := "morales-storage-drive"
+// listFolderFromBucket lists the folder straight from the bucket
+func (c *controller) listFolderFromBucket(prefix string, filter *Filter) (*types.Folder, *listingETag, *error.RequestError) {
+	bucket := api_aws.BucketName
 
-	if prefix != "" {
-		prefix = fmt.Sprintf("%s/", prefix)
-	}
 	res, err := c.s3Client.ListObjects(context.TODO(), &s3.ListObjectsV2Input{
 		Bucket:    &bucket,
 		Prefix:    &prefix,
 		Delimiter: aws.String("/"),
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if prefix == "" {
-		prefix = "/"
+	etag := newListingETag()
+	// The prefix stays as it is, the callers look up locks and favorites with it
+	name := prefix
+	if name == "" {
+		name = "/"
 	}
 	root := &types.Folder{
-		Name:         prefix,
-		Size:         0,
-		Items:        make([]types.FileItem, 0),
-		LastModified: time.Now(),
-		IsDir:        true,
+		Name:  name,
+		Size:  0,
+		Items: make([]types.FileItem, 0),
+		IsDir: true,
 	}
 
 	// Get the files in this folder
@@ -107,8 +347,15 @@ func (c *controller) ListFolder(prefix string) (*types.Folder, *error.RequestErr
 		if item.Key == nil {
 			continue
 		}
+		etag.add(*item.Key, aws.ToString(item.ETag), item.Size)
 		fileParts := strings.Split(*item.Key, "/")
 		fileName := fileParts[len(fileParts)-1]
+		if item.LastModified.After(root.LastModified) {
+			root.LastModified = *item.LastModified
+		}
+		if !filter.MatchFile(fileName, item.Size, *item.LastModified) {
+			continue
+		}
 		root.Items = append(root.Items, &types.File{
 			Name:         fileName,
 			Size:         item.Size,
@@ -118,9 +365,10 @@ func (c *controller) ListFolder(prefix string) (*types.Folder, *error.RequestErr
 	}
 	// Get the folders in this folder
 	for _, item := range res.CommonPrefixes {
-		if item.Prefix == nil {
+		if item.Prefix == nil || !filter.MatchFolders() {
 			continue
 		}
+		etag.add(*item.Prefix, "", 0)
 		folderParts := strings.Split(*item.Prefix, "/")
 		folderName := folderParts[len(folderParts)-2]
 		root.Items = append(root.Items, &types.Folder{
@@ -131,129 +379,238 @@ func (c *controller) ListFolder(prefix string) (*types.Folder, *error.RequestErr
 		})
 	}
 
-	return root, nil
+	return root, etag, nil
 }
 
-func (c *controller) GetObject(key string) (string, *error.RequestError) {
-	url, err := c.s3Client.DownloadObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String("morales-storage-drive"),
-		Key:    aws.String(key),
-	})
+// listFolderFromIndex lists the folder from the metadata index, which also knows the size of sub folders
+func (c *controller) listFolderFromIndex(prefix string, filter *Filter) (*types.Folder, *listingETag, *error.RequestError) {
+	objects, folders, err := c.metadata.ListChildren(context.TODO(), prefix)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
+	etag := newListingETag()
 
-	return url, nil
-}
-
-func (c *controller) GetFolderSize(prefix string) (int64, *error.RequestError) {
-	bucket := "morales-storage-drive"
-
-	if prefix != "" {
-		prefix = fmt.Sprintf("%s/", prefix)
+	name := prefix
+	if name == "" {
+		name = "/"
+	}
+	root := &types.Folder{
+		Name:  name,
+		Size:  0,
+		Items: make([]types.FileItem, 0),
+		IsDir: true,
 	}
 
-	size, err := c.calculateFolderSize(bucket, prefix)
-	if err != nil {
-		return -1, err
+	for _, object := range objects {
+		etag.add(object.Key, object.ETag, object.Size)
+		root.Size += object.Size
+		if object.LastModified.After(root.LastModified) {
+			root.LastModified = object.LastModified
+		}
+		if !filter.MatchFile(object.Name(), object.Size, object.LastModified) {
+			continue
+		}
+		root.Items = append(root.Items, &types.File{
+			Name:         object.Name(),
+			Size:         object.Size,
+			LastModified: object.LastModified,
+			IsDir:        false,
+		})
+	}
+	for _, folder := range folders {
+		// Folder totals change whenever an object under them does
+		etag.add(folder.Path, fmt.Sprintf("%d:%d", folder.Objects, folder.LastModified.UnixNano()), folder.Size)
+		root.Size += folder.Size
+		if folder.LastModified.After(root.LastModified) {
+			root.LastModified = folder.LastModified
+		}
+		if !filter.MatchFolders() {
+			continue
+		}
+		root.Items = append(root.Items, &types.Folder{
+			Name:         folder.Name(),
+			Size:         folder.Size,
+			Items:        make([]types.FileItem, 0),
+			LastModified: folder.LastModified,
+			IsDir:        true,
+		})
 	}
 
-	return size, nil
+	return root, etag, nil
 }
 
-func (c *controller) UploadObject(file string) (string, *error.RequestError) {
-	url, err := c.s3Client.UploadObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String("morales-storage-drive"),
-		Key:    aws.String(file),
-	})
+// maxChangesScanned bounds how many changes of the history are read per change of a page
+const maxChangesScanned = 10
+
+// GetChanges returns the changes made to the space since cursor, leaving out what the user cannot read.
+// The history covers the whole bucket, so it is read until the page is full or maxChangesScanned changes
+// per change asked for were looked at. A page can hold fewer changes than limit, or none, while hasMore is set
+// and the cursor moved on, clients keep following the cursor until hasMore is unset.
+// Until the metadata index is built there is no history, so clients are asked to reset
+func (c *controller) GetChanges(scope *Scope, cursor string, limit int) (*types.ChangeFeed, *error.RequestError) {
+	ctx := context.TODO()
+	if !c.metadataReady(ctx) {
+		return &types.ChangeFeed{Changes: make([]types.Change, 0), ResetRequired: true}, nil
+	}
+	rules, err := c.accessRules(ctx, scope.Root)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return url, nil
-}
-
-func (c *controller) DeleteObject() {
-	panic("not implemented")
-}
-
-func (c *controller) calculateFolderSize(bucket string, prefix string) (int64, *error.RequestError) {
-	var continuationToken *string
-
-	var size int64
+	changes := make([]types.Change, 0, limit)
+	scanned := 0
 	for {
-		res, err := c.s3Client.ListObjects(context.TODO(), &s3.ListObjectsV2Input{
-			Bucket:            &bucket,
-			Prefix:            &prefix,
-			ContinuationToken: continuationToken,
-		})
+		feed, err := c.metadata.Changes(ctx, cursor, limit-len(changes))
 		if err != nil {
-			return -1, err
+			return nil, err
 		}
-
-		// Get the files in this folder
-		for _, item := range res.Contents {
-			if item.Key == nil {
-				continue
+		// Without a cursor there is nothing to read, and a reset drops what was read so far
+		if cursor == "" || feed.ResetRequired {
+			return feed, nil
+		}
+		for _, change := range feed.Changes {
+			if change, ok := scopeChange(scope, rules, change); ok {
+				changes = append(changes, change)
 			}
-			size += item.Size
 		}
-
-		if !res.IsTruncated {
-			break
-		} else {
-			continuationToken = res.NextContinuationToken
+		scanned += len(feed.Changes)
+		cursor = feed.Cursor
+		if !feed.HasMore || len(changes) == limit || scanned >= limit*maxChangesScanned {
+			feed.Changes = changes
+			return feed, nil
 		}
 	}
-
-	return size, nil
 }
 
-func buildFileTree(root *types.Folder, path string, size int64, lastModified time.Time) {
-	pathParts := strings.Split(path, "/")
-	fileName := pathParts[len(pathParts)-1]
+// scopeChange returns a change of the history as seen from the space, or false if it happened outside of
+// the space or to something the user cannot read
+func scopeChange(scope *Scope, rules acl.Rules, change types.Change) (types.Change, bool) {
+	key, inside := scope.Path(change.Key)
+	from, fromInside := scope.Path(change.From)
+	switch {
+	case change.Type == types.ChangeMoved && inside && !fromInside:
+		// Moved in from somewhere the user cannot see
+		change.Type = types.ChangeCreated
+		from = ""
+	case change.Type == types.ChangeMoved && !inside && fromInside:
+		// Moved out of the space
+		change.Type = types.ChangeDeleted
+		key, inside = from, true
+		from = ""
+	}
+	if !inside || !allows(rules, scope.User, scope.Root+key, types.PermissionRead) {
+		return change, false
+	}
+	change.Key = key
+	change.From = from
+	return change, true
+}
 
-	for i, part := range pathParts {
-		// Skip the last part since it's the file name
-		if i == len(pathParts)-1 {
-			continue
-		}
-		if !containsFolder(root.Items, part) {
-			root.Items = append(root.Items, &types.Folder{
-				Name:         part,
-				Size:         0,
-				Items:        make([]types.FileItem, 0),
-				LastModified: time.Now(),
-				IsDir:        true,
-			})
-		}
+// metadataReady returns true when listings can be answered from the metadata index
+func (c *controller) metadataReady(ctx context.Context) bool {
+	return c.metadata != nil && c.metadata.Ready(ctx)
+}
 
-		root = findFolder(root, part)
-		// Add the size of the folder
-		root.Size += size
+// GetObject returns a presigned download url for the file and remembers the download for the recent files feed
+func (c *controller) GetObject(scope *Scope, path string) (string, *error.RequestError) {
+	ctx := context.TODO()
+	key, err := scope.Key(path)
+	if err != nil {
+		return "", err
+	}
+	if err := c.authorize(ctx, scope, key, types.PermissionRead); err != nil {
+		return "", err
 	}
 
-	root.Items = append(root.Items, &types.File{
-		Name:         fileName,
-		Size:         size,
-		LastModified: lastModified,
+	url, err := c.s3Client.DownloadObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(api_aws.BucketName),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return "", err
+	}
+	if c.activity != nil {
+		// The download goes ahead even if it could not be recorded
+		if err := c.activity.RecordDownload(ctx, scope.User.ID, scope.User.IsKid(), key, time.Now()); err != nil {
+			c.logger.Error("Error while recording download of ", key, ": ", err.Error())
+		}
+	}
+
+	return url, nil
 }
 
-func findFolder(root *types.Folder, name string) *types.Folder {
-	for _, folder := range root.Items {
-		if folder.GetName() == name {
-			return folder.(*types.Folder)
+// UploadObject returns a presigned upload url for the file.
+// When the request carries an expected etag, or requires the file not to exist, the
+// current version is checked first and the same condition is signed into the url.
+// Files locked by another user, or going over a storage quota, cannot be uploaded.
+// The upload counts in the activity of the user once the file arrives
+func (c *controller) UploadObject(scope *Scope, req *types.UploadRequest) (*types.PresignedURL, *error.RequestError) {
+	ctx := context.TODO()
+	bucket := api_aws.BucketName
+
+	key, err := scope.Key(req.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(ctx, scope, key, types.PermissionWrite); err != nil {
+		return nil, err
+	}
+	if err := c.checkKidUpload(scope, req); err != nil {
+		return nil, err
+	}
+	if err := c.checkLock(ctx, scope, key); err != nil {
+		return nil, err
+	}
+	headers, err := c.checkUploadConditions(ctx, scope, bucket, key, req)
+	if err != nil {
+		return nil, err
+	}
+	reservation, err := c.reserveQuota(ctx, key, req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	presigned, err := c.presignUpload(ctx, bucket, key, req.Size, req.ContentType, withReservation(headers, reservation))
+	if err != nil {
+		c.releaseQuota(ctx, reservation)
+		return nil, err
+	}
+	if c.activity != nil {
+		if err := c.activity.ExpectUpload(ctx, scope.User.ID, scope.User.IsKid(), key, time.Now()); err != nil {
+			c.logger.Error("Error while recording upload of ", key, ": ", err.Error())
 		}
 	}
-	return nil
+
+	return presigned, nil
 }
 
-func containsFolder(folders []types.FileItem, name string) bool {
-	for _, folder := range folders {
-		if folder.GetName() == name {
-			return true
+// presignUpload presigns the upload of key with the headers S3 has to enforce.
+// The length and type are part of the signature when given, the client has to send the same ones
+func (c *controller) presignUpload(ctx context.Context, bucket string, key string, size int64, contentType string, headers map[string]string) (*types.PresignedURL, *error.RequestError) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if size > 0 || contentType != "" {
+		if headers == nil {
+			headers = make(map[string]string)
 		}
+		if size > 0 {
+			input.ContentLength = size
+			headers["Content-Length"] = strconv.FormatInt(size, 10)
+		}
+		if contentType != "" {
+			input.ContentType = aws.String(contentType)
+			headers["Content-Type"] = contentType
+		}
+	}
+	url, err := c.s3Client.UploadObject(ctx, input, headers)
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return &types.PresignedURL{URL: url, Headers: headers}, nil
+}
+
+func (c *controller) DeleteObject() {
+	panic("not implemented")
 }
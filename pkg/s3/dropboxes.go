@@ -0,0 +1,304 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/dropboxes"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	// maxDropNameAttempts caps how many numbered names are tried when a dropped file is already there
+	maxDropNameAttempts = 20
+	// maxDropMessageLength caps the message shown to the people uploading
+	maxDropMessageLength = 1000
+	// dropHeader signs the ID of the drop box upload into the metadata of a dropped file
+	dropHeader = "X-Amz-Meta-Drop"
+	// dropMetadata is the name S3 gives back the drop box upload ID under
+	dropMetadata = "drop"
+)
+
+// CreateDropBox opens a folder the user can write to for uploads from people without an account.
+// It expires like a share link and can limit the number, size and kind of files
+func (c *controller) CreateDropBox(scope *Scope, req *types.DropBoxRequest) (*types.DropBox, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireDropBoxes(); err != nil {
+		return nil, err
+	}
+	// A drop box writes without the groups of its owner, which are what keeps a child account in its folder
+	if scope.User.IsKid() {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "child accounts cannot open drop boxes", c.logger)
+	}
+	if strings.Trim(req.Path, "/") == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "path must not be empty", c.logger)
+	}
+	prefix, err := scope.Prefix(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := defaultShareDuration
+	if req.ExpiresIn != 0 {
+		duration = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if duration <= 0 || duration > maxShareDuration {
+		return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("expiresIn must be between 1 and %d seconds", int64(maxShareDuration.Seconds())), c.logger)
+	}
+	if req.MaxFiles < 0 || req.MaxFileSize < 0 {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "maxFiles and maxFileSize must not be negative", c.logger)
+	}
+	if len(req.Message) > maxDropMessageLength {
+		return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("message must be at most %d characters", maxDropMessageLength), c.logger)
+	}
+	for _, category := range req.Categories {
+		if _, ok := types.ParseCategory(string(category)); !ok {
+			return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("unknown category: %s", category), c.logger)
+		}
+	}
+	if err := c.authorize(ctx, scope, prefix, types.PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	box := &types.DropBox{
+		Key:         prefix,
+		Owner:       scope.User.ID,
+		OwnerName:   scope.User.Username,
+		Message:     req.Message,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(duration),
+		MaxFiles:    req.MaxFiles,
+		MaxFileSize: req.MaxFileSize,
+		Categories:  req.Categories,
+	}
+	// The drop box writes with the grants of its owner without their groups, one that could never take a file is refused
+	rules, err := c.accessRules(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !rules.Allows(box.OwnerUser(), prefix, types.PermissionWrite) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "a drop box can only open on a folder you can write to yourself, not through your groups", c.logger)
+	}
+	box, err = c.dropBoxes.Create(ctx, *box)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Infof("%s opened a drop box on %s until %s", scope.User.Username, box.Key, box.ExpiresAt.Format(time.RFC3339))
+	return relativeDropBox(box), nil
+}
+
+// ListDropBoxes returns the drop boxes of the user with the number of files that arrived since they last looked
+func (c *controller) ListDropBoxes(scope *Scope) ([]types.DropBox, *error.RequestError) {
+	if err := c.requireDropBoxes(); err != nil {
+		return nil, err
+	}
+	boxes, err := c.dropBoxes.List(context.TODO(), scope.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range boxes {
+		boxes[i] = *relativeDropBox(&boxes[i])
+	}
+	return boxes, nil
+}
+
+// RevokeDropBox closes a drop box of the user, administrators can close the drop boxes of anyone.
+// Uploads already signed can still arrive until their url expires
+func (c *controller) RevokeDropBox(scope *Scope, id string) *error.RequestError {
+	if err := c.requireDropBoxes(); err != nil {
+		return err
+	}
+	owner := scope.User.ID
+	if administers(scope.User) {
+		owner = ""
+	}
+	revoked, err := c.dropBoxes.Revoke(context.TODO(), id, owner)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return error.NewRequestError(nil, error.NotFoundError, "drop box not found", c.logger)
+	}
+	return nil
+}
+
+// ListDropUploads returns the files that arrived in a drop box of the user and marks them as seen
+func (c *controller) ListDropUploads(scope *Scope, id string) ([]types.DropUpload, *error.RequestError) {
+	if err := c.requireDropBoxes(); err != nil {
+		return nil, err
+	}
+	owner := scope.User.ID
+	if administers(scope.User) {
+		owner = ""
+	}
+	box, uploads, err := c.dropBoxes.Uploads(context.TODO(), id, owner)
+	if err != nil {
+		return nil, err
+	}
+	for i := range uploads {
+		uploads[i].Path = strings.TrimPrefix(uploads[i].Key, box.Key)
+	}
+	return uploads, nil
+}
+
+// OpenDropBox returns what the people uploading need to know about a drop box, never what the folder holds
+func (c *controller) OpenDropBox(ctx context.Context, token string) (*types.DropBoxInfo, *error.RequestError) {
+	if err := c.requireDropBoxes(); err != nil {
+		return nil, err
+	}
+	box, err := c.dropBoxes.Open(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.DropBoxInfo{
+		Folder:      shareName(box.Key),
+		OwnerName:   box.OwnerName,
+		Message:     box.Message,
+		ExpiresAt:   box.ExpiresAt,
+		MaxFileSize: box.MaxFileSize,
+		Categories:  box.Categories,
+	}
+	if box.MaxFiles > 0 {
+		used, err := c.dropBoxes.Used(ctx, box.ID)
+		if err != nil {
+			return nil, err
+		}
+		left := max(box.MaxFiles-used, 0)
+		info.FilesLeft = &left
+	}
+	return info, nil
+}
+
+// DropFile returns a presigned upload of a file into a drop box. The file never replaces one already
+// in the folder, it gets a numbered name instead. The size, and the content type when given, are signed
+// into the upload so S3 refuses a different file. The owner is told once the file arrives
+func (c *controller) DropFile(ctx context.Context, token string, req *types.DropUploadRequest) (*types.PresignedURL, *error.RequestError) {
+	bucket := api_aws.BucketName
+	if err := c.requireDropBoxes(); err != nil {
+		return nil, err
+	}
+	box, err := c.dropBoxes.Open(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.File)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "file must be the name of a file", c.logger)
+	}
+	if req.Size <= 0 {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "size is required", c.logger)
+	}
+	if box.MaxFileSize > 0 && req.Size > box.MaxFileSize {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, fmt.Sprintf("the drop box takes files up to %d bytes", box.MaxFileSize), c.logger)
+	}
+	if category := types.CategoryOf(name); len(box.Categories) > 0 && !contains(box.Categories, category) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, fmt.Sprintf("the drop box does not take %s files", category), c.logger)
+	}
+
+	// The drop box writes with the permissions of its owner without their groups, a revoked grant closes it
+	rules, err := c.accessRules(ctx, box.Key+name)
+	if err != nil {
+		return nil, err
+	}
+	if !rules.Allows(box.OwnerUser(), box.Key+name, types.PermissionWrite) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "the drop box no longer takes files", c.logger)
+	}
+
+	key, headers, err := c.reserveDrop(ctx, box, name, req)
+	if err != nil {
+		return nil, err
+	}
+	presigned, err := c.presignUpload(ctx, bucket, key, req.Size, req.ContentType, headers)
+	if err != nil {
+		c.releaseQuota(ctx, headers[reservationHeader])
+		return nil, err
+	}
+	c.logger.Infof("Upload of %s signed for drop box %s", key, box.ID)
+	return presigned, nil
+}
+
+// reserveDrop picks the key of a dropped file, numbering the name while a file or another upload has it,
+// and holds it for the upload. It returns the key along with the headers to sign into the upload:
+// the file must not exist and its metadata tells the drop box upload and the quota reservation it is for
+func (c *controller) reserveDrop(ctx context.Context, box *types.DropBox, name string, req *types.DropUploadRequest) (string, map[string]string, *error.RequestError) {
+	for attempt := 1; attempt <= maxDropNameAttempts; attempt++ {
+		key := dropboxes.NumberedKey(box.Key, name, attempt)
+		existing, err := c.describePath(ctx, key)
+		if err != nil {
+			return "", nil, err
+		}
+		if existing != nil {
+			continue
+		}
+		reservation, err := c.reserveQuota(ctx, key, req.Size)
+		if err != nil {
+			return "", nil, err
+		}
+		upload, err := c.dropBoxes.Reserve(ctx, box.ID, types.DropUpload{
+			Key:         key,
+			Size:        req.Size,
+			From:        req.From,
+			RequestedAt: time.Now(),
+		})
+		if err != nil {
+			c.releaseQuota(ctx, reservation)
+			if err.Status == error.ConflictError {
+				continue
+			}
+			return "", nil, err
+		}
+		headers := map[string]string{"If-None-Match": "*", dropHeader: upload}
+		return key, withReservation(headers, reservation), nil
+	}
+	return "", nil, error.NewRequestError(nil, error.ConflictError, "too many files with this name, rename the file", c.logger)
+}
+
+// noticeDroppedFile tells the owner of a drop box that a file arrived with an in-app notification,
+// the drop box also lists it as new until they look at its uploads. Only the upload signed for the
+// drop box counts, found by the ID in the metadata of the file, not any other upload of the same key
+func (c *controller) noticeDroppedFile(ctx context.Context, event types.ObjectEvent, metadata map[string]string) *error.RequestError {
+	uploadID := metadata[dropMetadata]
+	if c.dropBoxes == nil || uploadID == "" {
+		return nil
+	}
+	at := event.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	box, upload, err := c.dropBoxes.Arrived(ctx, uploadID, event.Object.Key, event.Object.Size, at)
+	if err != nil || box == nil {
+		return err
+	}
+	from := upload.From
+	if from == "" {
+		from = "someone"
+	}
+	c.logger.Infof("%s dropped %s for %s, %d new files in the drop box", from, upload.Key, box.OwnerName, box.NewUploads)
+	c.notify(ctx, box.Owner, types.Notification{
+		Kind:      types.NotificationDroppedFile,
+		Message:   fmt.Sprintf("%s dropped %s in %s", from, shareName(upload.Key), shareName(box.Key)),
+		Key:       upload.Key,
+		CreatedAt: at,
+	})
+	return nil
+}
+
+// relativeDropBox shows the folder of a drop box as a path in the space of its owner
+func relativeDropBox(box *types.DropBox) *types.DropBox {
+	box.Space, box.Path = spaceOf(box.Owner, box.Key)
+	return box
+}
+
+func (c *controller) requireDropBoxes() *error.RequestError {
+	if c.dropBoxes == nil {
+		return error.NewRequestError(fmt.Errorf("drop box store is not configured"), error.InternalServerError, "drop boxes are not available", c.logger)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// listingETag builds the entity tag of a listing out of the keys and etags of the objects it covers.
+// The listing only changes when one of these objects does, so the tag can be compared without
+// comparing the response bodies
+type listingETag struct {
+	hash hash.Hash
+}
+
+func newListingETag() *listingETag {
+	return &listingETag{hash: sha256.New()}
+}
+
+// add covers an object, or a folder when etag is empty, with the listing
+func (e *listingETag) add(key string, etag string, size int64) {
+	fmt.Fprintf(e.hash, "%s\x00%s\x00%d\n", key, etag, size)
+}
+
+// String returns the weak entity tag, listings are only semantically equivalent since the JSON encoding may vary
+func (e *listingETag) String() string {
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(e.hash.Sum(nil))[:32])
+}
+
+// notModified sets the ETag header and returns true when the request's If-None-Match already matches it
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match uses the weak comparison
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
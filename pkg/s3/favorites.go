@@ -0,0 +1,184 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// AddFavorite stars a file or folder for the user.
+// The path is resolved against the drive, folders are stored with a trailing slash
+func (c *controller) AddFavorite(scope *Scope, path string) (*types.Favorite, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireFavorites(); err != nil {
+		return nil, err
+	}
+	if strings.Trim(path, "/") == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "path must not be empty", c.logger)
+	}
+	key, err := scope.Key(path)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := c.describePath(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || !c.canRead(ctx, scope.User, item.Path) {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file or folder not found", c.logger)
+	}
+
+	favorite, err := c.favorites.Add(ctx, scope.User.ID, item.Path)
+	if err != nil {
+		return nil, err
+	}
+	favorite.Path, _ = scope.Path(favorite.Path)
+	favorite.Size = item.Size
+	favorite.LastModified = item.LastModified
+	return favorite, nil
+}
+
+// RemoveFavorite unstars a file or folder for the user
+func (c *controller) RemoveFavorite(scope *Scope, path string) *error.RequestError {
+	ctx := context.TODO()
+	if err := c.requireFavorites(); err != nil {
+		return err
+	}
+	key, err := scope.Key(path)
+	if err != nil {
+		return err
+	}
+
+	// The folder of a path given without the trailing slash is starred with it
+	for _, candidate := range []string{key, strings.TrimSuffix(key, "/") + "/"} {
+		removed, err := c.favorites.Remove(ctx, scope.User.ID, candidate)
+		if err != nil {
+			return err
+		}
+		if removed {
+			return nil
+		}
+	}
+	return error.NewRequestError(nil, error.NotFoundError, "favorite not found", c.logger)
+}
+
+// ListFavorites returns the files and folders of the space the user starred that still exist
+func (c *controller) ListFavorites(scope *Scope) ([]types.Favorite, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireFavorites(); err != nil {
+		return nil, err
+	}
+
+	starred, err := c.favorites.List(ctx, scope.User.ID, scope.Root)
+	if err != nil {
+		return nil, err
+	}
+	favorites := make([]types.Favorite, 0, len(starred))
+	for _, favorite := range starred {
+		item, err := c.describePath(ctx, favorite.Path)
+		if err != nil {
+			return nil, err
+		}
+		// Deleted items keep their star in case they come back
+		if item == nil || item.Path != favorite.Path || !c.canRead(ctx, scope.User, favorite.Path) {
+			continue
+		}
+		favorite.Path, _ = scope.Path(favorite.Path)
+		favorite.Size = item.Size
+		favorite.LastModified = item.LastModified
+		favorites = append(favorites, favorite)
+	}
+	return favorites, nil
+}
+
+// attachFavorites flags the items of a listing of prefix starred by the user.
+// The favorites are added to the entity tag so starring an item changes the listing
+func (c *controller) attachFavorites(ctx context.Context, user *types.User, folder *types.Folder, prefix string, etag *listingETag) *error.RequestError {
+	if c.favorites == nil || user == nil {
+		return nil
+	}
+	starred, err := c.favorites.List(ctx, user.ID, prefix)
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool, len(starred))
+	for _, favorite := range starred {
+		paths[favorite.Path] = true
+		etag.add("favorite:"+favorite.Path, "", 0)
+	}
+	for _, item := range folder.Items {
+		switch v := item.(type) {
+		case *types.File:
+			v.IsFavorite = paths[prefix+v.Name]
+		case *types.Folder:
+			v.IsFavorite = paths[prefix+v.Name+"/"]
+		}
+	}
+	return nil
+}
+
+// describePath looks a path up as a file and then as a folder. It returns nil if neither exists.
+// Folder paths are returned with a trailing slash
+func (c *controller) describePath(ctx context.Context, path string) (*types.Favorite, *error.RequestError) {
+	bucket := api_aws.BucketName
+	key := strings.TrimSuffix(path, "/")
+	if key == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "path must not be empty", c.logger)
+	}
+
+	if !strings.HasSuffix(path, "/") {
+		var object *types.Object
+		var err *error.RequestError
+		if c.metadataReady(ctx) {
+			object, err = c.metadata.Get(ctx, key)
+		} else {
+			object, err = c.headObject(ctx, bucket, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if object != nil {
+			return &types.Favorite{Path: key, Size: object.Size, LastModified: object.LastModified}, nil
+		}
+	}
+
+	prefix := key + "/"
+	if c.metadataReady(ctx) {
+		stats, err := c.metadata.FolderStats(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if stats.Objects == 0 {
+			return nil, nil
+		}
+		return &types.Favorite{Path: prefix, IsDir: true, Size: stats.Size, LastModified: stats.LastModified}, nil
+	}
+
+	res, err := c.s3Client.ListObjects(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Contents) == 0 {
+		return nil, nil
+	}
+	return &types.Favorite{Path: prefix, IsDir: true}, nil
+}
+
+func (c *controller) requireFavorites() *error.RequestError {
+	if c.favorites == nil {
+		return error.NewRequestError(fmt.Errorf("favorites store is not configured"), error.InternalServerError, "favorites are not available", c.logger)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	// FilterTypeFile only keeps files in a listing
+	FilterTypeFile = "file"
+	// FilterTypeFolder only keeps folders in a listing
+	FilterTypeFolder = "folder"
+)
+
+// Filter narrows down the items returned by a listing.
+// Extension, category, size and date criteria are applied to files, folders
+// are only matched by Type
+type Filter struct {
+	Type           string
+	Extensions     []string
+	Categories     []types.Category
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  *time.Time
+	ModifiedBefore *time.Time
+}
+
+// NewFilterFromQuery builds a filter from the query parameters of a listing request:
+// type (file or folder), ext and category (comma separated lists), minSize and maxSize
+// in bytes, modifiedAfter and modifiedBefore as RFC3339 timestamps or YYYY-MM-DD dates.
+// It returns nil when no filter parameters are present
+func NewFilterFromQuery(query url.Values) (*Filter, *error.RequestError) {
+	filter := &Filter{}
+	empty := true
+
+	if t := query.Get("type"); t != "" {
+		if t != FilterTypeFile && t != FilterTypeFolder {
+			return nil, error.NewRequestError(nil, error.BadRequestError, "type must be either file or folder", nil)
+		}
+		filter.Type = t
+		empty = false
+	}
+
+	for _, ext := range splitList(query.Get("ext")) {
+		filter.Extensions = append(filter.Extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+		empty = false
+	}
+
+	for _, name := range splitList(query.Get("category")) {
+		category, ok := types.ParseCategory(name)
+		if !ok {
+			return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("unknown category: %s", name), nil)
+		}
+		filter.Categories = append(filter.Categories, category)
+		empty = false
+	}
+
+	var err *error.RequestError
+	if filter.MinSize, err = parseSize(query, "minSize"); err != nil {
+		return nil, err
+	}
+	if filter.MaxSize, err = parseSize(query, "maxSize"); err != nil {
+		return nil, err
+	}
+	if filter.ModifiedAfter, err = parseDate(query, "modifiedAfter"); err != nil {
+		return nil, err
+	}
+	if filter.ModifiedBefore, err = parseDate(query, "modifiedBefore"); err != nil {
+		return nil, err
+	}
+	if filter.MinSize != nil || filter.MaxSize != nil || filter.ModifiedAfter != nil || filter.ModifiedBefore != nil {
+		empty = false
+	}
+
+	if empty {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// MatchFile returns true if a file with the given name, size and modification date passes the filter
+func (f *Filter) MatchFile(name string, size int64, lastModified time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if f.Type == FilterTypeFolder {
+		return false
+	}
+	if len(f.Extensions) > 0 && !contains(f.Extensions, types.Extension(name)) {
+		return false
+	}
+	if len(f.Categories) > 0 && !contains(f.Categories, types.CategoryOf(name)) {
+		return false
+	}
+	if f.MinSize != nil && size < *f.MinSize {
+		return false
+	}
+	if f.MaxSize != nil && size > *f.MaxSize {
+		return false
+	}
+	if f.ModifiedAfter != nil && lastModified.Before(*f.ModifiedAfter) {
+		return false
+	}
+	if f.ModifiedBefore != nil && !lastModified.Before(*f.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// MatchFolders returns true if folders are allowed by the filter
+func (f *Filter) MatchFolders() bool {
+	return f == nil || f.Type != FilterTypeFile
+}
+
+// Apply removes the items of the folder that do not pass the filter.
+// Sub folders are filtered recursively and kept when they still contain matching
+// items, so files deep in a tree stay reachable. Folder sizes are left untouched
+func (f *Filter) Apply(folder *types.Folder) {
+	if f == nil {
+		return
+	}
+	items := folder.Items[:0]
+	for _, item := range folder.Items {
+		switch v := item.(type) {
+		case *types.File:
+			if f.MatchFile(v.Name, v.Size, v.LastModified) {
+				items = append(items, v)
+			}
+		case *types.Folder:
+			f.Apply(v)
+			if f.Type == FilterTypeFolder || len(v.Items) > 0 {
+				items = append(items, v)
+			}
+		}
+	}
+	folder.Items = items
+}
+
+func parseSize(query url.Values, key string) (*int64, *error.RequestError) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, error.NewRequestError(err, error.BadRequestError, fmt.Sprintf("%s must be a positive number of bytes", key), nil)
+	}
+	return &size, nil
+}
+
+func parseDate(query url.Values, key string) (*time.Time, *error.RequestError) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return &date, nil
+		}
+	}
+	return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("%s must be a RFC3339 timestamp or a YYYY-MM-DD date", key), nil)
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+func contains[T comparable](list []T, value T) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// folderSizeWorkers is the number of sub folders summed at the same time in parallel mode
+const folderSizeWorkers = 8
+
+func (c *controller) GetFolderSize(ctx context.Context, prefix string, parallel bool) (*types.FolderSize, *error.RequestError) {
+	bucket := api_aws.BucketName
+
+	if prefix != "" {
+		prefix = fmt.Sprintf("%s/", prefix)
+	}
+
+	// The index keeps pre-aggregated folder sizes
+	if c.metadataReady(ctx) {
+		stats, err := c.metadata.FolderStats(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &types.FolderSize{Size: stats.Size}, nil
+	}
+
+	if parallel {
+		return c.calculateFolderSizeParallel(ctx, bucket, prefix)
+	}
+
+	size, err := c.calculateFolderSize(ctx, bucket, prefix)
+	if err != nil {
+		// Return what was counted so far when the request ran out of time
+		if ctx.Err() != nil {
+			return &types.FolderSize{Size: size, Approximate: true}, nil
+		}
+		return nil, err
+	}
+
+	return &types.FolderSize{Size: size}, nil
+}
+
+// calculateFolderSize pages through every object under the prefix and sums their sizes.
+// On error the size counted up to that point is returned along with the error
+func (c *controller) calculateFolderSize(ctx context.Context, bucket string, prefix string) (int64, *error.RequestError) {
+	var continuationToken *string
+
+	var size int64
+	for {
+		res, err := c.s3Client.ListObjects(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			Prefix:            &prefix,
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return size, err
+		}
+
+		// Get the files in this folder
+		for _, item := range res.Contents {
+			if item.Key == nil {
+				continue
+			}
+			size += item.Size
+		}
+
+		if !res.IsTruncated {
+			break
+		} else {
+			continuationToken = res.NextContinuationToken
+		}
+	}
+
+	return size, nil
+}
+
+// calculateFolderSizeParallel lists the direct children of the prefix using a delimiter,
+// then sums every sub folder with a bounded pool of workers.
+// When ctx is done before every sub folder is summed the partial size is returned as approximate
+func (c *controller) calculateFolderSizeParallel(ctx context.Context, bucket string, prefix string) (*types.FolderSize, *error.RequestError) {
+	result := &types.FolderSize{}
+
+	// Discover the files and sub folders directly under the prefix
+	var prefixes []string
+	var continuationToken *string
+	for {
+		res, err := c.s3Client.ListObjects(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			Prefix:            &prefix,
+			Delimiter:         aws.String("/"),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				result.Approximate = true
+				return result, nil
+			}
+			return nil, err
+		}
+
+		for _, item := range res.Contents {
+			if item.Key == nil {
+				continue
+			}
+			result.Size += item.Size
+		}
+		for _, item := range res.CommonPrefixes {
+			if item.Prefix == nil {
+				continue
+			}
+			prefixes = append(prefixes, *item.Prefix)
+		}
+
+		if !res.IsTruncated {
+			break
+		}
+		continuationToken = res.NextContinuationToken
+	}
+
+	// Stop the other workers as soon as one of them fails
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr *error.RequestError
+		jobs     = make(chan string)
+	)
+	for i := 0; i < folderSizeWorkers && i < len(prefixes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				size, err := c.calculateFolderSize(workCtx, bucket, p)
+
+				mu.Lock()
+				result.Size += size
+				if err != nil && ctx.Err() == nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, p := range prefixes {
+		select {
+		case jobs <- p:
+		case <-workCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	result.Approximate = ctx.Err() != nil
+	return result, nil
+}
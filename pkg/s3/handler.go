@@ -2,17 +2,32 @@ package s3
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
 	"github.com/JosueMolinaMorales/family-cloud-api/internal/middleware"
 	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
+const (
+	defaultChangesLimit = 500
+	maxChangesLimit     = 1000
+
+	// ScopeKey is the key for the scope of the request in the context
+	ScopeKey middleware.ContextKey = "scope"
+
+	// SharePasswordHeader carries the password of a share link
+	SharePasswordHeader = "X-Share-Password"
+)
+
 // Routes returns the routes for the s3 package
 func Routes(controller Controller) *chi.Mux {
 	r := chi.NewRouter()
@@ -23,57 +38,187 @@ func Routes(controller Controller) *chi.Mux {
 	}
 
 	r.Use(middleware.AuthMiddlware)
-	r.Get("/list", h.ListObjects)
-	r.Get("/folder", h.ListFolder)
-	r.Get("/folder/size", h.GetFolderSize)
-	r.Post("/upload", h.UploadObject)
-	r.Get("/download", h.GetObject)
+	r.Use(h.ResolveScope)
+
+	browse := middleware.RequirePermission(types.ActionBrowse)
+	upload := middleware.RequirePermission(types.ActionUpload)
+	share := middleware.RequirePermission(types.ActionShare)
+	manageAccess := middleware.RequirePermission(types.ActionManageAccess)
+	administer := middleware.RequirePermission(types.ActionAdminister)
+	r.With(browse).Get("/list", h.ListObjects)
+	r.With(browse).Get("/folder", h.ListFolder)
+	r.With(browse).Post("/folder/size", h.StartFolderSizeJob)
+	r.With(browse).Get("/folder/size/{id}", h.GetFolderSizeJob)
+	r.With(upload).Post("/upload", h.UploadObject)
+	r.With(browse).Get("/lock", h.GetLock)
+	r.With(upload).Post("/lock", h.LockObject)
+	r.With(upload).Delete("/lock", h.UnlockObject)
+	r.With(browse).Get("/favorites", h.ListFavorites)
+	r.With(browse).Post("/favorites", h.AddFavorite)
+	r.With(browse).Delete("/favorites", h.RemoveFavorite)
+	r.With(browse).Get("/acl", h.GetACL)
+	r.With(manageAccess).Put("/acl", h.PutGrant)
+	r.With(manageAccess).Delete("/acl", h.DeleteGrant)
+	r.With(browse).Get("/kids/{id}/activity", h.GetKidActivity)
+	r.With(browse).Get("/usage", h.GetUsage)
+	r.With(administer).Put("/quotas/{subject}", h.SetQuota)
+	r.With(administer).Delete("/quotas/{subject}", h.ResetQuota)
+	r.With(administer).Get("/reports/usage", h.GetUsageReport)
+	r.With(share).Post("/shares", h.CreateShare)
+	r.With(share).Get("/shares", h.ListShares)
+	r.With(share).Delete("/shares/{id}", h.RevokeShare)
+	r.With(share).Post("/dropboxes", h.CreateDropBox)
+	r.With(share).Get("/dropboxes", h.ListDropBoxes)
+	r.With(share).Delete("/dropboxes/{id}", h.RevokeDropBox)
+	r.With(share).Get("/dropboxes/{id}/uploads", h.ListDropUploads)
+	r.With(browse).Get("/notifications", h.ListNotifications)
+	r.With(browse).Post("/notifications/read", h.ReadNotifications)
+	r.With(browse).Get("/download", h.GetObject)
+	r.With(browse).Get("/changes", h.GetChanges)
+	r.With(browse).Get("/recent", h.GetRecent)
+	r.With(browse).Get("/search", h.Search)
+	r.With(browse).Get("/search/content", h.SearchContent)
 
 	// Set middleware for error handling
 	return r
 }
 
+// ShareRoutes returns the public routes opening share links, they do not need an account
+func ShareRoutes(controller Controller) *chi.Mux {
+	r := chi.NewRouter()
+
+	h := &handler{
+		controller: controller,
+		logger:     log.NewLogger().With(context.Background(), "Version", "1.0.0"),
+	}
+
+	r.Use(noStore)
+	r.Get("/{token}", h.OpenShare)
+	r.Post("/{token}/download", h.DownloadShare)
+
+	return r
+}
+
+// DropBoxRoutes returns the public routes of drop boxes, they do not need an account
+func DropBoxRoutes(controller Controller) *chi.Mux {
+	r := chi.NewRouter()
+
+	h := &handler{
+		controller: controller,
+		logger:     log.NewLogger().With(context.Background(), "Version", "1.0.0"),
+	}
+
+	r.Use(noStore)
+	r.Get("/{token}", h.OpenDropBox)
+	r.Post("/{token}/upload", h.DropFile)
+
+	return r
+}
+
 type handler struct {
 	controller Controller
 	logger     log.Logger
 }
 
+// ResolveScope resolves the space given by the space parameter, the caller's home by default.
+// Every path of the request is relative to it. Whether the caller is a child account is recorded on the way
+func (h *handler) ResolveScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.UserFromContext(r.Context())
+		h.controller.RecordAccount(r.Context(), user)
+		scope, err := NewScope(user, types.Space(r.URL.Query().Get("space")))
+		if err != nil {
+			error.HandleError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ScopeKey, scope)))
+	})
+}
+
+// scopeFrom returns the scope set by ResolveScope
+func scopeFrom(r *http.Request) *Scope {
+	scope, _ := r.Context().Value(ScopeKey).(*Scope)
+	return scope
+}
+
+// bodyScope returns the scope of a path sent in the body, the space of the body wins over the space parameter
+func bodyScope(r *http.Request, space types.Space) (*Scope, *error.RequestError) {
+	scope := scopeFrom(r)
+	if space == "" || space == scope.Space {
+		return scope, nil
+	}
+	return NewScope(scope.User, space)
+}
+
+// noStore keeps browsers and proxies from caching responses carrying presigned urls
+func noStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UploadObject returns a presigned url to upload a file.
+// The expected version can be given with ifMatch and ifNoneMatch in the body or the If-Match
+// and If-None-Match headers. A conflicting upload gets a 409 or 412 with the current version,
+// an upload to a file locked by someone else gets a 423 with the lock
 func (h *handler) UploadObject(w http.ResponseWriter, r *http.Request) {
-	// TODO: Look into DTOs
 	// Get the body of the request
-	var body struct {
-		File string `json:"file"`
-	}
+	var body types.UploadRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
 		return
 	}
+	if body.IfMatch == "" {
+		body.IfMatch = r.Header.Get("If-Match")
+	}
+	if body.IfNoneMatch == "" {
+		body.IfNoneMatch = r.Header.Get("If-None-Match")
+	}
+	scope, err := bodyScope(r, body.Space)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
 
 	// Get the presigned url
-	url, err := h.controller.UploadObject(body.File)
+	url, err := h.controller.UploadObject(scope, &body)
 	if err != nil {
 		error.HandleError(w, r, err)
 		return
 	}
 
 	// Return the url
-	render.JSON(w, r, struct {
-		URL string `json:"url"`
-	}{
-		URL: url,
-	})
+	render.JSON(w, r, url)
 }
 
 // listObjects lists all the objects in the bucket
 // This method gets a list of all the objects in the bucket, then builds a file tree
-// based on the keys of the objects. This method allows for collection of size of folders
+// based on the keys of the objects. This method allows for collection of size of folders.
+// The tree can be limited to a prefix and to a number of levels with the prefix and depth parameters
 func (h *handler) ListObjects(w http.ResponseWriter, r *http.Request) {
-	tree, err := h.controller.ListObjects()
+	filter, err := NewFilterFromQuery(r.URL.Query())
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	depth, err := parseDepth(r.URL.Query().Get("depth"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	tree, etag, err := h.controller.ListObjects(scopeFrom(r), r.URL.Query().Get("prefix"), depth, filter)
 	if err != nil {
 		error.HandleError(w, r, err)
 		return
 	}
+	if notModified(w, r, etag) {
+		return
+	}
 
 	render.JSON(w, r, tree)
 }
@@ -81,50 +226,64 @@ func (h *handler) ListObjects(w http.ResponseWriter, r *http.Request) {
 // listFolder lists all the items within a prefix in the bucket
 // this method returns a file tree of the items within the prefix
 // including files and folders. This method does not allow for collection
-// of folder sizes
+// of folder sizes.
+// Both listings carry an ETag, polling with If-None-Match returns 304 Not Modified while nothing changed
 func (h *handler) ListFolder(w http.ResponseWriter, r *http.Request) {
-	folder, err := h.controller.ListFolder(r.URL.Query().Get("prefix"))
+	filter, err := NewFilterFromQuery(r.URL.Query())
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	folder, etag, err := h.controller.ListFolder(scopeFrom(r), r.URL.Query().Get("prefix"), filter)
 	if err != nil {
 		error.HandleError(w, r, err)
 		return
 	}
+	if notModified(w, r, etag) {
+		return
+	}
 	render.JSON(w, r, folder)
 }
 
-// GetFolderSize returns the size of a folder
-func (h *handler) GetFolderSize(w http.ResponseWriter, r *http.Request) {
-	// Set a timeout for the request
-	ctx, cancel := context.WithTimeout(r.Context(), time.Millisecond*500)
-	defer cancel()
+// StartFolderSizeJob starts calculating the size of a folder in the background
+// and returns the job, which can be polled with GetFolderSizeJob.
+// Results are cached per prefix, set refresh to force a new calculation
+func (h *handler) StartFolderSizeJob(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Prefix  string `json:"prefix"`
+		Refresh bool   `json:"refresh"`
+	}
 
-	ch := make(chan int64)
-	go func() {
-		size, err := h.controller.GetFolderSize(r.URL.Query().Get("prefix"))
-		if err != nil {
-			error.HandleError(w, r, err)
-			return
-		}
-		ch <- size
-	}()
-
-	for {
-		select {
-		case <-ctx.Done():
-			// Timeout
-			error.HandleError(w, r, error.NewRequestError(ctx.Err(), error.BadRequestError, "Timeout", h.logger))
-			return
-		case size := <-ch:
-			render.JSON(w, r, struct {
-				Size int64 `json:"size"`
-			}{Size: size})
-			return
-		}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	job, err := h.controller.StartFolderSizeJob(scopeFrom(r), body.Prefix, body.Refresh)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
 	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, job)
+}
+
+// GetFolderSizeJob returns the status of a folder size job and its result once it is done
+func (h *handler) GetFolderSizeJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.controller.GetFolderSizeJob(scopeFrom(r), chi.URLParam(r, "id"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, job)
 }
 
 func (h *handler) GetObject(w http.ResponseWriter, r *http.Request) {
 	// Get the presigned url
-	url, err := h.controller.GetObject(r.URL.Query().Get("key"))
+	url, err := h.controller.GetObject(scopeFrom(r), r.URL.Query().Get("key"))
 	if err != nil {
 		error.HandleError(w, r, err)
 		return
@@ -138,8 +297,523 @@ func (h *handler) GetObject(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetChanges returns the create, modify, delete and move events since the cursor.
+// Calling it without a cursor returns the cursor to start syncing from. A page can be short, or empty,
+// while hasMore is set, the client follows the cursor until it is not. When resetRequired
+// is set the history since the cursor is gone and the client has to list the drive again
+func (h *handler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultChangesLimit, maxChangesLimit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	feed, err := h.controller.GetChanges(scopeFrom(r), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, feed)
+}
+
+// GetLock returns the lock held on the file given by the key parameter
+func (h *handler) GetLock(w http.ResponseWriter, r *http.Request) {
+	lock, err := h.controller.GetLock(scopeFrom(r), r.URL.Query().Get("key"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, lock)
+}
+
+// LockObject checks a file out so other users cannot upload over it until it is unlocked or the lock expires.
+// Locking a file again renews the lock
+func (h *handler) LockObject(w http.ResponseWriter, r *http.Request) {
+	var body types.LockRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	lock, err := h.controller.LockObject(scopeFrom(r), &body)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, lock)
+}
+
+// UnlockObject releases the lock on the file given by the key parameter.
+// Admins can break the lock of another user with force=true
+func (h *handler) UnlockObject(w http.ResponseWriter, r *http.Request) {
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if err := h.controller.UnlockObject(scopeFrom(r), r.URL.Query().Get("key"), force); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Search finds files and folders by name anywhere in the drive.
+// Results carry their full path and are ranked from the best match, limit caps how many are returned
+func (h *handler) Search(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	results, err := h.controller.Search(scopeFrom(r), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, results)
+}
+
+// SearchContent finds text documents (txt, md, csv, json and PDFs with a text layer) by the words inside them.
+// Every word of q has to match, results carry a snippet of the text with the matches highlighted
+func (h *handler) SearchContent(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	results, err := h.controller.SearchContent(scopeFrom(r), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, results)
+}
+
+// GetRecent returns the files modified most recently across the drive along with the files
+// the caller downloaded recently, grouped by day. Days follow the tz time zone (e.g. America/Chicago),
+// UTC by default. Pass the returned cursor to get the next page
+func (h *handler) GetRecent(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultRecentLimit, maxRecentLimit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+	location := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		loaded, loadErr := time.LoadLocation(tz)
+		if loadErr != nil {
+			error.HandleError(w, r, error.NewRequestError(loadErr, error.BadRequestError, "tz must be a time zone name", h.logger))
+			return
+		}
+		location = loaded
+	}
+
+	feed, err := h.controller.GetRecent(scopeFrom(r), r.URL.Query().Get("cursor"), limit, location)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, feed)
+}
+
+// ListFavorites returns the files and folders the caller starred
+func (h *handler) ListFavorites(w http.ResponseWriter, r *http.Request) {
+	favorites, err := h.controller.ListFavorites(scopeFrom(r))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, favorites)
+}
+
+// AddFavorite stars the file or folder at path for the caller
+func (h *handler) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	favorite, err := h.controller.AddFavorite(scopeFrom(r), body.Path)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, favorite)
+}
+
+// RemoveFavorite unstars the file or folder given by the path parameter
+func (h *handler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	if err := h.controller.RemoveFavorite(scopeFrom(r), r.URL.Query().Get("path")); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetACL returns the grants on the folder given by the path parameter
+func (h *handler) GetACL(w http.ResponseWriter, r *http.Request) {
+	acl, err := h.controller.GetACL(scopeFrom(r), r.URL.Query().Get("path"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, acl)
+}
+
+// PutGrant sets the grant of a user or group on a folder
+func (h *handler) PutGrant(w http.ResponseWriter, r *http.Request) {
+	var body types.GrantRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	grant, err := h.controller.PutGrant(scopeFrom(r), &body)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, grant)
+}
+
+// DeleteGrant removes the grant of the principal given by the principalType and principal parameters
+// on the folder given by the path parameter
+func (h *handler) DeleteGrant(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := h.controller.DeleteGrant(scopeFrom(r), query.Get("path"), types.PrincipalType(query.Get("principalType")), query.Get("principal")); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetKidActivity returns what the child account given by id did since the since parameter,
+// a RFC3339 timestamp or a YYYY-MM-DD date. Any other user gets a 404
+func (h *handler) GetKidActivity(w http.ResponseWriter, r *http.Request) {
+	since, err := parseDate(r.URL.Query(), "since")
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+	var from time.Time
+	if since != nil {
+		from = *since
+	}
+
+	summary, err := h.controller.GetKidActivity(scopeFrom(r), chi.URLParam(r, "id"), from)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, summary)
+}
+
+// GetUsage returns the storage used by the caller, or by the user given by the user parameter, and the household
+func (h *handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.controller.GetUsage(scopeFrom(r), r.URL.Query().Get("user"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, usage)
+}
+
+// SetQuota sets the quota of the user given by subject, or of the whole drive when it is "household"
+func (h *handler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	var body types.Quota
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	if err := h.controller.SetQuota(scopeFrom(r), chi.URLParam(r, "subject"), body); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetQuota puts the user given by subject, or the household, back on the default quota
+func (h *handler) ResetQuota(w http.ResponseWriter, r *http.Request) {
+	if err := h.controller.ResetQuota(scopeFrom(r), chi.URLParam(r, "subject")); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUsageReport returns the storage usage of the whole drive, as a CSV file with format=csv
+func (h *handler) GetUsageReport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		error.HandleError(w, r, error.NewRequestError(nil, error.BadRequestError, "format must be either json or csv", h.logger))
+		return
+	}
+
+	report, err := h.controller.GetUsageReport(r.Context())
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	if format != "csv" {
+		render.JSON(w, r, report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s.csv"`, report.GeneratedAt.Format("2006-01-02")))
+	out := csv.NewWriter(w)
+	writeUsageReportCSV(out, report)
+	out.Flush()
+	if err := out.Error(); err != nil {
+		h.logger.Error("Error while writing usage report: ", err.Error())
+	}
+}
+
+// CreateShare shares the file or folder at path through a public link. The token of the link
+// is only returned here, a password, an expiry and a number of downloads can be set
+func (h *handler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	var body types.ShareRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+	scope, err := bodyScope(r, body.Space)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	link, err := h.controller.CreateShare(scope, &body)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, link)
+}
+
+// ListShares returns the links shared by the caller
+func (h *handler) ListShares(w http.ResponseWriter, r *http.Request) {
+	links, err := h.controller.ListShares(scopeFrom(r))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, links)
+}
+
+// RevokeShare deletes the share link given by id, it stops working right away
+func (h *handler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	if err := h.controller.RevokeShare(scopeFrom(r), chi.URLParam(r, "id")); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OpenShare opens a share link: the name and size of a shared file, or the listing of a shared folder
+// and of the folders under it given by the path parameter. It never counts as a download.
+// Links with a password need the X-Share-Password header
+func (h *handler) OpenShare(w http.ResponseWriter, r *http.Request) {
+	item, err := h.controller.OpenShare(r.Context(), chi.URLParam(r, "token"), r.Header.Get(SharePasswordHeader), r.URL.Query().Get("path"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, item)
+}
+
+// DownloadShare counts a download of a share link and returns the download url of the shared file,
+// or of the file at the path parameter inside a shared folder
+func (h *handler) DownloadShare(w http.ResponseWriter, r *http.Request) {
+	item, err := h.controller.DownloadShare(r.Context(), chi.URLParam(r, "token"), r.Header.Get(SharePasswordHeader), r.URL.Query().Get("path"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, item)
+}
+
+// CreateDropBox opens the folder at path for uploads from people without an account.
+// The token of the drop box is only returned here
+func (h *handler) CreateDropBox(w http.ResponseWriter, r *http.Request) {
+	var body types.DropBoxRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+	scope, err := bodyScope(r, body.Space)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	box, err := h.controller.CreateDropBox(scope, &body)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, box)
+}
+
+// ListDropBoxes returns the drop boxes of the caller, newUploads counts the files they have not looked at
+func (h *handler) ListDropBoxes(w http.ResponseWriter, r *http.Request) {
+	boxes, err := h.controller.ListDropBoxes(scopeFrom(r))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, boxes)
+}
+
+// RevokeDropBox closes the drop box given by id
+func (h *handler) RevokeDropBox(w http.ResponseWriter, r *http.Request) {
+	if err := h.controller.RevokeDropBox(scopeFrom(r), chi.URLParam(r, "id")); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDropUploads returns the files that arrived in the drop box given by id
+func (h *handler) ListDropUploads(w http.ResponseWriter, r *http.Request) {
+	uploads, err := h.controller.ListDropUploads(scopeFrom(r), chi.URLParam(r, "id"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, uploads)
+}
+
+// ListNotifications returns the newest notifications of the caller, only the unread ones when unread is true
+func (h *handler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultNotificationLimit, maxNotificationLimit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+	unread := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := h.controller.ListNotifications(scopeFrom(r), unread, limit)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, notifications)
+}
+
+// ReadNotifications marks the notifications given by ids as read, all of the caller's when ids is empty
+func (h *handler) ReadNotifications(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	if err := h.controller.ReadNotifications(scopeFrom(r), body.IDs); err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OpenDropBox returns the folder name, message and limits of a drop box
+func (h *handler) OpenDropBox(w http.ResponseWriter, r *http.Request) {
+	info, err := h.controller.OpenDropBox(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, info)
+}
+
+// DropFile returns a presigned url to upload a file into a drop box.
+// The headers returned with it have to be sent with the upload
+func (h *handler) DropFile(w http.ResponseWriter, r *http.Request) {
+	var body types.DropUploadRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		error.HandleError(w, r, error.NewRequestError(err, error.BadRequestError, "invalid request body", h.logger))
+		return
+	}
+
+	url, err := h.controller.DropFile(r.Context(), chi.URLParam(r, "token"), &body)
+	if err != nil {
+		error.HandleError(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, url)
+}
+
 func (h *handler) DeleteObject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) CreateFolder(w http.ResponseWriter, r *http.Request) {
 }
+
+// parseDepth parses the depth query parameter, an empty value means no limit
+func parseDepth(value string) (int, *error.RequestError) {
+	if value == "" {
+		return 0, nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return 0, error.NewRequestError(err, error.BadRequestError, "depth must be a positive number", nil)
+	}
+	return depth, nil
+}
+
+// parseLimit parses a page size query parameter, an empty value means def
+func parseLimit(value string, def int, max int) (int, *error.RequestError) {
+	if value == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 || limit > max {
+		return 0, error.NewRequestError(err, error.BadRequestError, fmt.Sprintf("limit must be between 1 and %d", max), nil)
+	}
+	return limit, nil
+}
@@ -0,0 +1,243 @@
+package s3
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+const (
+	// folderSizeCacheTTL is how long the result of a folder size job is reused for the same prefix
+	folderSizeCacheTTL = time.Minute * 5
+	// folderSizeJobTimeout bounds how long a single folder size job may run
+	folderSizeJobTimeout = time.Minute * 10
+)
+
+// sizeJobStore keeps track of the folder size jobs and caches their results per prefix.
+// Prefixes are normalized with index.NormalizePrefix
+type sizeJobStore struct {
+	mu       sync.Mutex
+	jobs     map[string]*types.FolderSizeJob
+	byPrefix map[string]*types.FolderSizeJob
+	// stale holds the IDs of running jobs whose folder changed after they started
+	stale map[string]bool
+}
+
+func newSizeJobStore() *sizeJobStore {
+	return &sizeJobStore{
+		jobs:     make(map[string]*types.FolderSizeJob),
+		byPrefix: make(map[string]*types.FolderSizeJob),
+		stale:    make(map[string]bool),
+	}
+}
+
+// StartFolderSizeJob starts calculating the size of a folder in the background.
+// A job that is still running or finished recently for the same prefix is returned
+// instead of starting a new one, unless refresh is set
+func (c *controller) StartFolderSizeJob(scope *Scope, prefix string, refresh bool) (*types.FolderSizeJob, *error.RequestError) {
+	key, err := scope.Prefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(context.TODO(), scope, key, types.PermissionRead); err != nil {
+		return nil, err
+	}
+	// The job sums everything under the folder, it would tell the size of what the grants hide
+	rules, err := c.accessRules(context.TODO(), key)
+	if err != nil {
+		return nil, err
+	}
+	if hidesUnder(rules, scope.User, key) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "the folder holds files you cannot read, its size cannot be computed", nil)
+	}
+	prefix = index.NormalizePrefix(key)
+
+	store := c.sizeJobs
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.expire()
+
+	if job, ok := store.byPrefix[prefix]; ok && (!refresh || job.Status == types.JobRunning) {
+		return relativeJob(scope, job), nil
+	}
+
+	job := &types.FolderSizeJob{
+		ID:        uuid.New().String(),
+		Prefix:    strings.TrimSuffix(prefix, "/"),
+		Status:    types.JobRunning,
+		CreatedAt: time.Now(),
+	}
+	store.jobs[job.ID] = job
+	store.byPrefix[prefix] = job
+
+	go c.runFolderSizeJob(job)
+
+	return relativeJob(scope, job), nil
+}
+
+// GetFolderSizeJob returns the state of a folder size job of the space
+func (c *controller) GetFolderSizeJob(scope *Scope, id string) (*types.FolderSizeJob, *error.RequestError) {
+	store := c.sizeJobs
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.expire()
+
+	job, ok := store.jobs[id]
+	if !ok || !scope.Contains(jobPrefix(job)) {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "job not found", c.logger)
+	}
+	return relativeJob(scope, job), nil
+}
+
+// relativeJob returns a snapshot of the job with its prefix relative to the space.
+// The caller must hold the lock
+func relativeJob(scope *Scope, job *types.FolderSizeJob) *types.FolderSizeJob {
+	snapshot := *job
+	path, _ := scope.Path(jobPrefix(job))
+	snapshot.Prefix = strings.TrimSuffix(path, "/")
+	return &snapshot
+}
+
+// jobPrefix returns the bucket prefix of a job with its trailing slash
+func jobPrefix(job *types.FolderSizeJob) string {
+	if job.Prefix == "" {
+		return ""
+	}
+	return job.Prefix + "/"
+}
+
+func (c *controller) runFolderSizeJob(job *types.FolderSizeJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), folderSizeJobTimeout)
+	defer cancel()
+
+	size, err := c.GetFolderSize(ctx, job.Prefix, true)
+
+	store := c.sizeJobs
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	job.CompletedAt = &now
+	stale := store.stale[job.ID]
+	delete(store.stale, job.ID)
+	if err != nil {
+		job.Status = types.JobFailed
+		job.Error = err.Error()
+		return
+	}
+	job.Status = types.JobDone
+	job.Result = size
+	// The job may have counted the folder before it changed, its result is never reused
+	if stale {
+		job.Result.Approximate = true
+		if store.byPrefix[jobPrefix(job)] == job {
+			delete(store.byPrefix, jobPrefix(job))
+		}
+	}
+}
+
+// HandleObjectEvent drops the cached folder sizes of every folder holding the changed object
+// and the lock of a deleted file. Files arriving in a drop box are noticed to its owner
+// and uploads arriving count in the activity of the user who asked for them. The quota room held
+// for an upload is given back once it arrived, the index counts it from then on
+func (c *controller) HandleObjectEvent(ctx context.Context, event types.ObjectEvent) *error.RequestError {
+	metadata, err := c.arrivedMetadata(ctx, event)
+	if err != nil {
+		return err
+	}
+	if err := c.releaseArrivedQuota(ctx, metadata); err != nil {
+		return err
+	}
+	if err := c.releaseRemovedLock(ctx, event); err != nil {
+		return err
+	}
+	if err := c.recordUpload(ctx, event); err != nil {
+		return err
+	}
+	if err := c.noticeDroppedFile(ctx, event, metadata); err != nil {
+		return err
+	}
+
+	store := c.sizeJobs
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for prefix, job := range store.byPrefix {
+		if !strings.HasPrefix(event.Object.Key, prefix) {
+			continue
+		}
+		// A running job is left to finish for the callers waiting on it but the next
+		// request for the folder starts a new one
+		if job.Status == types.JobRunning {
+			store.stale[job.ID] = true
+		}
+		delete(store.byPrefix, prefix)
+	}
+	return nil
+}
+
+// arrivedMetadata reads the metadata signed into the upload an ObjectCreated event reports, which tells the
+// quota reservation and the drop box upload it arrived for. The bucket is only asked while one of them waits
+// for the key. It is nil when none does, or when the file changed again since: the event of the current
+// version brings its own, the reservations of this one are given back once they expire
+func (c *controller) arrivedMetadata(ctx context.Context, event types.ObjectEvent) (map[string]string, *error.RequestError) {
+	if event.Type != types.ObjectCreated {
+		return nil, nil
+	}
+	waiting := false
+	if c.quotas != nil {
+		reserved, err := c.quotas.Reserved(ctx, event.Object.Key)
+		if err != nil {
+			return nil, err
+		}
+		waiting = reserved
+	}
+	if !waiting && c.dropBoxes != nil {
+		dropped, err := c.dropBoxes.Waiting(ctx, event.Object.Key)
+		if err != nil {
+			return nil, err
+		}
+		waiting = dropped
+	}
+	if !waiting {
+		return nil, nil
+	}
+
+	head, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(api_aws.BucketName),
+		Key:    aws.String(event.Object.Key),
+	})
+	if err != nil {
+		if err.Status == error.NotFoundError {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if event.Object.ETag != "" && aws.ToString(head.ETag) != event.Object.ETag {
+		return nil, nil
+	}
+	return head.Metadata, nil
+}
+
+// expire removes the jobs that finished longer than the cache TTL ago.
+// The caller must hold the lock
+func (s *sizeJobStore) expire() {
+	for id, job := range s.jobs {
+		if job.CompletedAt == nil || time.Since(*job.CompletedAt) < folderSizeCacheTTL {
+			continue
+		}
+		delete(s.jobs, id)
+		if s.byPrefix[jobPrefix(job)] == job {
+			delete(s.byPrefix, jobPrefix(job))
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	// defaultActivityPeriod is how far back an activity summary goes when no date is given
+	defaultActivityPeriod = time.Hour * 24 * 7
+	// maxActivityEntries caps the entries of an activity summary
+	maxActivityEntries = 1000
+)
+
+// KidPolicy limits what child accounts can upload
+type KidPolicy struct {
+	// MaxUploadSize is the largest file in bytes a child account can upload
+	MaxUploadSize int64
+	// Categories are the kinds of files child accounts can upload
+	Categories []types.Category
+}
+
+// DefaultKidPolicy allows pictures, videos, audio and documents up to 100MB
+var DefaultKidPolicy = KidPolicy{
+	MaxUploadSize: 100 << 20,
+	Categories:    []types.Category{types.CategoryImages, types.CategoryVideos, types.CategoryAudio, types.CategoryDocuments},
+}
+
+// checkKidUpload enforces the upload limits of child accounts. The size and content type
+// are signed into the upload, so S3 refuses a different file
+func (c *controller) checkKidUpload(scope *Scope, req *types.UploadRequest) *error.RequestError {
+	if !scope.User.IsKid() {
+		return nil
+	}
+	if req.Size <= 0 {
+		return error.NewRequestError(nil, error.BadRequestError, "size is required for uploads from child accounts", c.logger)
+	}
+	if req.Size > c.kids.MaxUploadSize {
+		return error.NewRequestError(nil, error.ForbiddenError, fmt.Sprintf("child accounts can upload files up to %d bytes", c.kids.MaxUploadSize), c.logger)
+	}
+	if category := types.CategoryOf(req.File); !contains(c.kids.Categories, category) {
+		return error.NewRequestError(nil, error.ForbiddenError, fmt.Sprintf("child accounts cannot upload %s files", category), c.logger)
+	}
+	return nil
+}
+
+// GetKidActivity sums up the uploads and downloads of a child account since a point in time,
+// the last week when since is zero. Only parents and admins can see it, and only for a user who was
+// a child account at their latest request: any other user is not found, whatever their history.
+// The activity recorded while the user was not a child account is left out
+func (c *controller) GetKidActivity(scope *Scope, userID string, since time.Time) (*types.ActivitySummary, *error.RequestError) {
+	if !scope.User.IsParent() {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "only parents can see the activity of child accounts", c.logger)
+	}
+	if c.activity == nil {
+		return nil, error.NewRequestError(fmt.Errorf("activity store is not configured"), error.InternalServerError, "activity is not available", c.logger)
+	}
+	if since.IsZero() {
+		since = time.Now().Add(-defaultActivityPeriod)
+	}
+
+	ctx := context.TODO()
+	kid, err := c.activity.IsKid(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !kid {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "no child account with this id", c.logger)
+	}
+	entries, err := c.activity.History(ctx, userID, since, maxActivityEntries)
+	if err != nil {
+		return nil, err
+	}
+	summary := &types.ActivitySummary{
+		UserID:  userID,
+		Since:   since.UTC(),
+		Entries: make([]types.ActivityEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		if !entry.Kid {
+			continue
+		}
+		switch entry.Activity {
+		case types.ActivityUploaded:
+			summary.Uploads++
+			summary.UploadedBytes += entry.Size
+		case types.ActivityDownloaded:
+			summary.Downloads++
+		}
+		space, path := spaceOf(userID, entry.Key)
+		summary.Entries = append(summary.Entries, types.ActivityEntry{
+			Space:    space,
+			Path:     path,
+			Activity: entry.Activity,
+			Size:     entry.Size,
+			At:       entry.At,
+		})
+	}
+	return summary, nil
+}
+
+// RecordAccount remembers whether the user is a child account, so their activity can be told apart
+// from that of other users whatever they did. The store is only written when it changes
+func (c *controller) RecordAccount(ctx context.Context, user *types.User) {
+	if c.activity == nil || user == nil {
+		return
+	}
+	kid := user.IsKid()
+	if last, ok := c.accounts.Load(user.ID); ok && last.(bool) == kid {
+		return
+	}
+	if err := c.activity.RecordAccount(ctx, user.ID, kid); err != nil {
+		c.logger.Error("Error while recording the account of ", user.ID, ": ", err.Error())
+		return
+	}
+	c.accounts.Store(user.ID, kid)
+}
+
+// recordUpload records the arrival of a file uploaded through the API in the activity of the user
+func (c *controller) recordUpload(ctx context.Context, event types.ObjectEvent) *error.RequestError {
+	if c.activity == nil || event.Type != types.ObjectCreated {
+		return nil
+	}
+	at := event.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	_, err := c.activity.UploadArrived(ctx, event.Object.Key, event.Object.Size, at)
+	return err
+}
+
+// spaceOf returns the space of the user a bucket key is in and the path relative to it
+func spaceOf(userID string, key string) (types.Space, string) {
+	switch {
+	case strings.HasPrefix(key, types.FamilyPrefix):
+		return types.SpaceFamily, strings.TrimPrefix(key, types.FamilyPrefix)
+	case strings.HasPrefix(key, types.HomePrefix(userID)):
+		return types.SpaceHome, strings.TrimPrefix(key, types.HomePrefix(userID))
+	}
+	return types.SpaceAll, key
+}
@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	// defaultLockDuration is how long a lock is held when the client does not say
+	defaultLockDuration = time.Hour * 2
+	// maxLockDuration bounds how long a lock can be held before it has to be renewed
+	maxLockDuration = time.Hour * 24 * 7
+)
+
+// LockObject checks a file out for the user. Locking a file the user already holds renews the lock
+func (c *controller) LockObject(scope *Scope, req *types.LockRequest) (*types.Lock, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireLocks(); err != nil {
+		return nil, err
+	}
+	if req.File == "" || strings.HasSuffix(req.File, "/") {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "file must be the path of a file", c.logger)
+	}
+	key, err := scope.Key(req.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(ctx, scope, key, types.PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	duration := defaultLockDuration
+	if req.ExpiresIn != 0 {
+		duration = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if duration <= 0 || duration > maxLockDuration {
+		return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("expiresIn must be between 1 and %d seconds", int64(maxLockDuration.Seconds())), c.logger)
+	}
+
+	current, err := c.headObject(ctx, api_aws.BucketName, key)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file not found", c.logger)
+	}
+
+	now := time.Now()
+	lock, err := c.locks.Acquire(ctx, types.Lock{
+		Key:       key,
+		Owner:     scope.User.ID,
+		OwnerName: scope.User.Username,
+		Note:      req.Note,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	})
+	if err != nil {
+		return nil, relativeLockError(scope, err)
+	}
+	return relativeLock(scope, lock), nil
+}
+
+// UnlockObject checks a file back in. Only the holder can release a lock,
+// administrators can break the lock of another user by setting force
+func (c *controller) UnlockObject(scope *Scope, path string, force bool) *error.RequestError {
+	ctx := context.TODO()
+	if err := c.requireLocks(); err != nil {
+		return err
+	}
+	if force && !administers(scope.User) {
+		return error.NewRequestError(nil, error.ForbiddenError, "the administer permission is required to break a lock", c.logger)
+	}
+	key, err := scope.Key(path)
+	if err != nil {
+		return err
+	}
+	if err := c.authorize(ctx, scope, key, types.PermissionWrite); err != nil {
+		return err
+	}
+
+	owner := scope.User.ID
+	if force {
+		owner = ""
+	}
+	released, err := c.locks.Release(ctx, key, owner)
+	if err != nil {
+		return err
+	}
+	if released {
+		if force {
+			c.logger.Infof("Lock on %s broken by %s", key, scope.User.Username)
+		}
+		return nil
+	}
+
+	lock, err := c.locks.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		return error.NewRequestError(nil, error.ConflictError, "file is locked by "+lock.OwnerName, c.logger).WithDetails(relativeLock(scope, lock))
+	}
+	return error.NewRequestError(nil, error.NotFoundError, "file is not locked", c.logger)
+}
+
+// GetLock returns the lock held on a file
+func (c *controller) GetLock(scope *Scope, path string) (*types.Lock, *error.RequestError) {
+	if c.locks == nil {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file is not locked", c.logger)
+	}
+	key, err := scope.Key(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(context.TODO(), scope, key, types.PermissionRead); err != nil {
+		return nil, err
+	}
+	lock, err := c.locks.Get(context.TODO(), key)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file is not locked", c.logger)
+	}
+	return relativeLock(scope, lock), nil
+}
+
+// checkLock refuses an upload to a file locked by another user
+func (c *controller) checkLock(ctx context.Context, scope *Scope, key string) *error.RequestError {
+	if c.locks == nil {
+		return nil
+	}
+	lock, err := c.locks.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.Owner != scope.User.ID {
+		return error.NewRequestError(nil, error.LockedError, "file is locked by "+lock.OwnerName, c.logger).WithDetails(relativeLock(scope, lock))
+	}
+	return nil
+}
+
+// relativeLock returns a copy of the lock keyed by its path in the space
+func relativeLock(scope *Scope, lock *types.Lock) *types.Lock {
+	relative := *lock
+	relative.Key, _ = scope.Path(lock.Key)
+	return &relative
+}
+
+// relativeLockError rewrites the lock carried by a conflict error
+func relativeLockError(scope *Scope, err *error.RequestError) *error.RequestError {
+	if lock, ok := err.Details.(*types.Lock); ok {
+		err.Details = relativeLock(scope, lock)
+	}
+	return err
+}
+
+// attachLocks sets the lock of every locked file in a listing of prefix.
+// The locks are added to the entity tag so taking or releasing a lock changes the listing
+func (c *controller) attachLocks(ctx context.Context, folder *types.Folder, prefix string, etag *listingETag) *error.RequestError {
+	if c.locks == nil {
+		return nil
+	}
+	locks, err := c.locks.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if len(locks) == 0 {
+		return nil
+	}
+
+	byKey := make(map[string]*types.Lock, len(locks))
+	for i := range locks {
+		byKey[locks[i].Key] = &locks[i]
+		etag.add("lock:"+locks[i].Key, locks[i].Owner, locks[i].ExpiresAt.UnixNano())
+	}
+	setLocks(folder, prefix, byKey)
+	return nil
+}
+
+func setLocks(folder *types.Folder, prefix string, locks map[string]*types.Lock) {
+	for _, item := range folder.Items {
+		switch v := item.(type) {
+		case *types.File:
+			v.Lock = locks[prefix+v.Name]
+		case *types.Folder:
+			setLocks(v, prefix+v.Name+"/", locks)
+		}
+	}
+}
+
+// releaseRemovedLock drops the lock of a file deleted from the bucket
+func (c *controller) releaseRemovedLock(ctx context.Context, event types.ObjectEvent) *error.RequestError {
+	if c.locks == nil || event.Type != types.ObjectRemoved {
+		return nil
+	}
+	_, err := c.locks.Release(ctx, event.Object.Key, "")
+	return err
+}
+
+func (c *controller) requireLocks() *error.RequestError {
+	if c.locks == nil {
+		return error.NewRequestError(fmt.Errorf("lock store is not configured"), error.InternalServerError, "locks are not available", c.logger)
+	}
+	return nil
+}
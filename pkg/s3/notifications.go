@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 200
+)
+
+// ListNotifications returns the newest notifications of the user, only the unread ones when unread is set
+func (c *controller) ListNotifications(scope *Scope, unread bool, limit int) ([]types.Notification, *error.RequestError) {
+	if err := c.requireNotifications(); err != nil {
+		return nil, err
+	}
+	notifications, err := c.notifications.List(context.TODO(), scope.User.ID, unread, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notifications {
+		notifications[i].Space, notifications[i].Path = spaceOf(scope.User.ID, notifications[i].Key)
+	}
+	return notifications, nil
+}
+
+// ReadNotifications marks the notifications of the user with the given IDs as read, all of them when ids is empty
+func (c *controller) ReadNotifications(scope *Scope, ids []string) *error.RequestError {
+	if err := c.requireNotifications(); err != nil {
+		return err
+	}
+	_, err := c.notifications.Read(context.TODO(), scope.User.ID, ids)
+	return err
+}
+
+// notify tells the user about an event in the app. A notification that cannot be saved is only logged,
+// it never fails what it tells about
+func (c *controller) notify(ctx context.Context, userID string, notification types.Notification) {
+	if c.notifications == nil {
+		return
+	}
+	if _, err := c.notifications.Add(ctx, userID, notification); err != nil {
+		c.logger.Error("Error while notifying ", userID, ": ", err.Error())
+	}
+}
+
+func (c *controller) requireNotifications() *error.RequestError {
+	if c.notifications == nil {
+		return error.NewRequestError(fmt.Errorf("notification store is not configured"), error.InternalServerError, "notifications are not available", c.logger)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/quotas"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// reservationHeader signs the ID of the quota reservation of an upload into its metadata
+	reservationHeader = "X-Amz-Meta-Reservation"
+	// reservationMetadata is the name S3 gives back the reservation ID under
+	reservationMetadata = "reservation"
+)
+
+// GetUsage returns the storage used by a user's space and by the household along with their quotas.
+// An empty userID is the caller, only administrators can see the usage of someone else
+func (c *controller) GetUsage(scope *Scope, userID string) (*types.StorageUsage, *error.RequestError) {
+	ctx := context.TODO()
+	if userID == "" {
+		userID = scope.User.ID
+	}
+	if userID != scope.User.ID && !administers(scope.User) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "the administer permission is required to see the usage of another user", nil)
+	}
+	if err := c.requireQuotas(); err != nil {
+		return nil, err
+	}
+	if !c.metadataReady(ctx) {
+		return nil, error.NewRequestError(nil, error.ServiceUnavailableError, "usage is not available until the index is built", c.logger)
+	}
+
+	home, err := c.usage(ctx, userID, types.HomePrefix(userID))
+	if err != nil {
+		return nil, err
+	}
+	household, err := c.usage(ctx, quotas.Household, "")
+	if err != nil {
+		return nil, err
+	}
+	return &types.StorageUsage{UserID: userID, Home: *home, Household: *household}, nil
+}
+
+// SetQuota gives a user, or the household, its own quota
+func (c *controller) SetQuota(scope *Scope, subject string, quota types.Quota) *error.RequestError {
+	if err := c.requireQuotas(); err != nil {
+		return err
+	}
+	if err := c.requireEvents(); err != nil {
+		return err
+	}
+	if subject == "" {
+		return error.NewRequestError(nil, error.BadRequestError, "subject is required", nil)
+	}
+	if quota.MaxBytes < 0 || quota.MaxObjects < 0 {
+		return error.NewRequestError(nil, error.BadRequestError, "maxBytes and maxObjects must not be negative", nil)
+	}
+	if err := c.quotas.Set(context.TODO(), subject, quota); err != nil {
+		return err
+	}
+	c.logger.Infof("Quota of %s set to %d bytes and %d objects by %s", subject, quota.MaxBytes, quota.MaxObjects, scope.User.Username)
+	return nil
+}
+
+// ResetQuota puts a user, or the household, back on the default quota
+func (c *controller) ResetQuota(scope *Scope, subject string) *error.RequestError {
+	if err := c.requireQuotas(); err != nil {
+		return err
+	}
+	reset, err := c.quotas.Reset(context.TODO(), subject)
+	if err != nil {
+		return err
+	}
+	if !reset {
+		return error.NewRequestError(nil, error.NotFoundError, "quota not found", nil)
+	}
+	return nil
+}
+
+// reserveQuota refuses an upload that would take the space it goes to, or the household, over its quota.
+// Replacing a file only counts the difference in size. The room of an upload is held until it arrives or
+// its url expires, so uploads signed at the same time cannot go over the quota together.
+// It returns the ID of the reservation to sign into the upload, empty when no quota applies
+func (c *controller) reserveQuota(ctx context.Context, key string, size int64) (string, *error.RequestError) {
+	if c.quotas == nil {
+		return "", nil
+	}
+
+	type limit struct {
+		subject string
+		prefix  string
+		quota   types.Quota
+	}
+	owner := homeOwner(key)
+	limits := make([]limit, 0, 2)
+	if owner != "" {
+		limits = append(limits, limit{subject: owner, prefix: types.HomePrefix(owner)})
+	}
+	limits = append(limits, limit{subject: quotas.Household})
+
+	limited, needsSize := false, false
+	for i := range limits {
+		quota, err := c.quotas.Get(ctx, limits[i].subject)
+		if err != nil {
+			return "", err
+		}
+		limits[i].quota = quota
+		limited = limited || quota.MaxBytes > 0 || quota.MaxObjects > 0
+		needsSize = needsSize || quota.MaxBytes > 0
+	}
+	if !limited {
+		return "", nil
+	}
+	// Only the arrival of an upload gives back its room, the reconciler could index it after the room expired
+	if err := c.requireEvents(); err != nil {
+		return "", err
+	}
+	if needsSize && size <= 0 {
+		return "", error.NewRequestError(nil, error.BadRequestError, "size is required while a storage quota applies", nil)
+	}
+	if !c.metadataReady(ctx) {
+		return "", error.NewRequestError(nil, error.ServiceUnavailableError, "uploads are paused until the storage usage is known", c.logger)
+	}
+
+	bytes, objects := size, int64(1)
+	current, err := c.metadata.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if current != nil {
+		bytes, objects = size-current.Size, 0
+	}
+
+	usages := make(map[string]types.Usage, len(limits))
+	for _, l := range limits {
+		stats, err := c.metadata.FolderStats(ctx, l.prefix)
+		if err != nil {
+			return "", err
+		}
+		usages[l.subject] = types.NewUsage(stats.Size, stats.Objects, l.quota)
+	}
+	id := uuid.New().String()
+	exceeded, usage, err := c.quotas.Reserve(ctx, quotas.Reservation{
+		ID:      id,
+		Key:     key,
+		Owner:   owner,
+		Bytes:   bytes,
+		Objects: objects,
+		At:      time.Now(),
+	}, usages)
+	if err != nil {
+		return "", err
+	}
+	if exceeded != "" {
+		what := "your space"
+		if exceeded == quotas.Household {
+			what = "the household"
+		}
+		return "", error.NewRequestError(nil, error.ForbiddenError, fmt.Sprintf("the upload would exceed the storage quota of %s", what), nil).WithDetails(usage)
+	}
+	return id, nil
+}
+
+// withReservation signs the quota reservation of an upload into it, so its arrival gives back its room
+func withReservation(headers map[string]string, reservation string) map[string]string {
+	if reservation == "" {
+		return headers
+	}
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[reservationHeader] = reservation
+	return headers
+}
+
+// releaseQuota gives back the room held for an upload that did not go ahead
+func (c *controller) releaseQuota(ctx context.Context, reservation string) {
+	if c.quotas == nil || reservation == "" {
+		return
+	}
+	if err := c.quotas.Release(ctx, reservation); err != nil {
+		c.logger.Error("Error while releasing the quota reservation ", reservation, ": ", err.Error())
+	}
+}
+
+// releaseArrivedQuota gives back the room held for the upload that arrived, found by the reservation
+// signed into its metadata
+func (c *controller) releaseArrivedQuota(ctx context.Context, metadata map[string]string) *error.RequestError {
+	reservation := metadata[reservationMetadata]
+	if c.quotas == nil || reservation == "" {
+		return nil
+	}
+	return c.quotas.Release(ctx, reservation)
+}
+
+// usage returns the storage used under prefix against the quota of subject
+func (c *controller) usage(ctx context.Context, subject string, prefix string) (*types.Usage, *error.RequestError) {
+	quota, err := c.quotas.Get(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := c.metadata.FolderStats(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	usage := types.NewUsage(stats.Size, stats.Objects, quota)
+	return &usage, nil
+}
+
+// homeOwner returns the ID of the user whose home holds key, or an empty string outside of the homes
+func homeOwner(key string) string {
+	if !strings.HasPrefix(key, types.HomesPrefix) {
+		return ""
+	}
+	owner, _, found := strings.Cut(strings.TrimPrefix(key, types.HomesPrefix), "/")
+	if !found {
+		return ""
+	}
+	return owner
+}
+
+// requireEvents refuses to enforce quotas without bucket events, the room of uploads would never be given back
+func (c *controller) requireEvents() *error.RequestError {
+	if !c.events {
+		return error.NewRequestError(fmt.Errorf("bucket events are not configured"), error.ServiceUnavailableError, "storage quotas need bucket events", c.logger)
+	}
+	return nil
+}
+
+func (c *controller) requireQuotas() *error.RequestError {
+	if c.quotas == nil {
+		return error.NewRequestError(fmt.Errorf("quota store is not configured"), error.InternalServerError, "quotas are not available", c.logger)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package s3
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/activity"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	defaultRecentLimit = 50
+	maxRecentLimit     = 200
+)
+
+// GetRecent returns the files modified most recently across the space merged with the files
+// the user downloaded recently, from the latest and grouped by day in location.
+// Pass the cursor of a page to get the next one
+func (c *controller) GetRecent(scope *Scope, cursor string, limit int, location *time.Location) (*types.RecentFeed, *error.RequestError) {
+	ctx := context.TODO()
+	if !c.metadataReady(ctx) {
+		return nil, error.NewRequestError(nil, error.ServiceUnavailableError, "recent files are not available until the index is built", c.logger)
+	}
+	before, beforeKey, err := decodeRecentCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := c.accessRules(ctx, scope.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries the user cannot see are skipped, so both lists are read in batches until the page is full.
+	// A batch holds one item more than the page so the next page is usually known without another read
+	modified := &recentStream[types.Object]{
+		size: limit + 1,
+		next: func(at time.Time, key string, size int) ([]types.Object, *error.RequestError) {
+			return c.metadata.Recent(ctx, scope.Root, at, key, size)
+		},
+		position: func(object types.Object) (time.Time, string) { return object.LastModified, object.Key },
+	}
+	downloads := &recentStream[activity.Download]{
+		size: limit + 1,
+		next: func(at time.Time, key string, size int) ([]activity.Download, *error.RequestError) {
+			if c.activity == nil {
+				return nil, nil
+			}
+			return c.activity.Downloads(ctx, scope.User.ID, at, key, size)
+		},
+		position: func(download activity.Download) (time.Time, string) { return download.At, download.Key },
+	}
+	if err := modified.fill(before, beforeKey); err != nil {
+		return nil, err
+	}
+	if err := downloads.fill(before, beforeKey); err != nil {
+		return nil, err
+	}
+
+	feed := &types.RecentFeed{Days: make([]types.RecentDay, 0)}
+	files := make([]types.RecentFile, 0, limit)
+	for len(files) < limit {
+		if err := modified.refill(); err != nil {
+			return nil, err
+		}
+		if err := downloads.refill(); err != nil {
+			return nil, err
+		}
+		if modified.empty() && downloads.empty() {
+			break
+		}
+
+		// Both lists are sorted by time and key descending, take the latest of the two heads
+		var file types.RecentFile
+		if downloads.empty() || (!modified.empty() && recentAfter(modified.head().LastModified, modified.head().Key, downloads.head().At, downloads.head().Key)) {
+			object := modified.pop()
+			file = newRecentFile(&object, types.ActivityModified, object.LastModified)
+		} else {
+			download := downloads.pop()
+			feed.Cursor = encodeRecentCursor(download.At, download.Key)
+			if !scope.Contains(download.Key) {
+				continue
+			}
+			// Downloaded files may have been deleted since
+			object, err := c.metadata.Get(ctx, download.Key)
+			if err != nil {
+				return nil, err
+			}
+			if object == nil {
+				continue
+			}
+			file = newRecentFile(object, types.ActivityDownloaded, download.At)
+		}
+
+		feed.Cursor = encodeRecentCursor(file.At, file.Path)
+		if allows(rules, scope.User, file.Path, types.PermissionRead) {
+			file.Path, _ = scope.Path(file.Path)
+			files = append(files, file)
+		}
+	}
+	if err := modified.refill(); err != nil {
+		return nil, err
+	}
+	if err := downloads.refill(); err != nil {
+		return nil, err
+	}
+	feed.HasMore = !modified.empty() || !downloads.empty()
+	if !feed.HasMore {
+		feed.Cursor = ""
+	}
+
+	for _, file := range files {
+		date := file.At.In(location).Format("2006-01-02")
+		if len(feed.Days) == 0 || feed.Days[len(feed.Days)-1].Date != date {
+			feed.Days = append(feed.Days, types.RecentDay{Date: date, Files: make([]types.RecentFile, 0)})
+		}
+		day := &feed.Days[len(feed.Days)-1]
+		day.Files = append(day.Files, file)
+	}
+	return feed, nil
+}
+
+// recentStream reads one of the lists of the recent feed in batches of size items
+type recentStream[T any] struct {
+	size int
+	next func(before time.Time, beforeKey string, size int) ([]T, *error.RequestError)
+	// position returns the place of an item in the feed
+	position func(T) (time.Time, string)
+	items    []T
+	// more is set while the last batch was full, so the list may go on after it
+	more bool
+	// last is the item taken last, the next batch starts after it
+	last *T
+}
+
+// fill reads the batch of items after the given entry
+func (s *recentStream[T]) fill(before time.Time, beforeKey string) *error.RequestError {
+	items, err := s.next(before, beforeKey, s.size)
+	if err != nil {
+		return err
+	}
+	s.items = items
+	s.more = len(items) == s.size
+	return nil
+}
+
+// refill reads the next batch once the current one ran out
+func (s *recentStream[T]) refill() *error.RequestError {
+	if len(s.items) > 0 || !s.more || s.last == nil {
+		return nil
+	}
+	at, key := s.position(*s.last)
+	return s.fill(at, key)
+}
+
+func (s *recentStream[T]) empty() bool {
+	return len(s.items) == 0
+}
+
+func (s *recentStream[T]) head() *T {
+	return &s.items[0]
+}
+
+// pop takes the first item of the batch
+func (s *recentStream[T]) pop() T {
+	item := s.items[0]
+	s.items = s.items[1:]
+	s.last = &item
+	return item
+}
+
+func newRecentFile(object *types.Object, activity types.Activity, at time.Time) types.RecentFile {
+	return types.RecentFile{
+		Path:         object.Key,
+		Name:         object.Name(),
+		Size:         object.Size,
+		LastModified: object.LastModified,
+		Activity:     activity,
+		At:           at,
+	}
+}
+
+// recentAfter returns true if the entry (a, aKey) comes before (b, bKey) in the feed
+func recentAfter(a time.Time, aKey string, b time.Time, bKey string) bool {
+	return a.After(b) || (a.Equal(b) && aKey > bKey)
+}
+
+// encodeRecentCursor encodes the position of the last entry of a page
+func encodeRecentCursor(at time.Time, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(at.UnixNano(), 10) + ":" + key))
+}
+
+// decodeRecentCursor decodes a cursor made by encodeRecentCursor, an empty cursor starts from the latest
+func decodeRecentCursor(cursor string) (time.Time, string, *error.RequestError) {
+	if cursor == "" {
+		return time.Time{}, "", nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", error.NewRequestError(err, error.BadRequestError, "invalid cursor", nil)
+	}
+	nanos, key, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return time.Time{}, "", error.NewRequestError(nil, error.BadRequestError, "invalid cursor", nil)
+	}
+	at, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", error.NewRequestError(err, error.BadRequestError, "invalid cursor", nil)
+	}
+	return time.Unix(0, at).UTC(), key, nil
+}
@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"context"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/index"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// GetUsageReport breaks the storage of the whole drive down by owner, top-level folder, category and
+// upload month in a single pass over the objects. The index is used when it is built, so the report
+// does not cost a listing of the bucket, otherwise the bucket is paged through
+func (c *controller) GetUsageReport(ctx context.Context) (*types.UsageReport, *error.RequestError) {
+	report := newReportBuilder()
+	add := func(object types.Object) *error.RequestError {
+		report.add(object)
+		return nil
+	}
+
+	if c.metadataReady(ctx) {
+		objects, err := c.metadata.List(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			add(object)
+		}
+	} else if err := index.Walk(ctx, c.s3Client, api_aws.BucketName, "", add); err != nil {
+		return nil, err
+	}
+
+	return report.build(), nil
+}
+
+// reportBuilder sums objects into the groups of a usage report
+type reportBuilder struct {
+	report     types.UsageReport
+	byOwner    map[string]*types.UsageRow
+	byFolder   map[string]*types.UsageRow
+	byCategory map[types.Category]*types.UsageRow
+	byMonth    map[string]*types.UsageRow
+}
+
+// newReportBuilder returns a builder with a row for every category, so the empty ones are reported with zeros
+func newReportBuilder() *reportBuilder {
+	b := &reportBuilder{
+		byOwner:    make(map[string]*types.UsageRow),
+		byFolder:   make(map[string]*types.UsageRow),
+		byCategory: make(map[types.Category]*types.UsageRow),
+		byMonth:    make(map[string]*types.UsageRow),
+	}
+	for _, category := range types.UsageCategories {
+		b.byCategory[category] = &types.UsageRow{Category: category}
+	}
+	return b
+}
+
+func (b *reportBuilder) add(object types.Object) {
+	if object.IsFolderMarker() {
+		return
+	}
+	b.report.Bytes += object.Size
+	b.report.Objects++
+
+	owner, path := ownerOf(object.Key)
+	folder, _, found := strings.Cut(path, "/")
+	if !found {
+		folder = ""
+	}
+	category := types.UsageCategoryOf(object.Name())
+	month := object.LastModified.UTC().Format("2006-01")
+
+	addTo(b.byOwner, owner, types.UsageRow{Owner: owner}, object.Size)
+	addTo(b.byFolder, owner+"/"+folder, types.UsageRow{Owner: owner, Folder: folder}, object.Size)
+	addTo(b.byCategory, category, types.UsageRow{Category: category}, object.Size)
+	addTo(b.byMonth, month, types.UsageRow{Month: month}, object.Size)
+}
+
+// build sorts the groups: owners and folders from the largest, categories in the order of
+// types.UsageCategories and months from the oldest
+func (b *reportBuilder) build() *types.UsageReport {
+	report := b.report
+	report.GeneratedAt = time.Now().UTC()
+	report.ByOwner = sortedRows(b.byOwner, func(a, b types.UsageRow) bool { return a.Bytes > b.Bytes || a.Bytes == b.Bytes && a.Owner < b.Owner })
+	report.ByFolder = sortedRows(b.byFolder, func(a, b types.UsageRow) bool {
+		return a.Bytes > b.Bytes || a.Bytes == b.Bytes && (a.Owner < b.Owner || a.Owner == b.Owner && a.Folder < b.Folder)
+	})
+	report.ByCategory = make([]types.UsageRow, 0, len(types.UsageCategories))
+	for _, category := range types.UsageCategories {
+		report.ByCategory = append(report.ByCategory, *b.byCategory[category])
+	}
+	report.ByMonth = sortedRows(b.byMonth, func(a, b types.UsageRow) bool { return a.Month < b.Month })
+	return &report
+}
+
+// ownerOf returns who owns a bucket key and its path inside the owner's space
+func ownerOf(key string) (string, string) {
+	if owner := homeOwner(key); owner != "" {
+		return owner, strings.TrimPrefix(key, types.HomePrefix(owner))
+	}
+	if strings.HasPrefix(key, types.FamilyPrefix) {
+		return types.OwnerFamily, strings.TrimPrefix(key, types.FamilyPrefix)
+	}
+	return types.OwnerUnassigned, key
+}
+
+func addTo[K comparable](rows map[K]*types.UsageRow, key K, group types.UsageRow, size int64) {
+	row, ok := rows[key]
+	if !ok {
+		row = &group
+		rows[key] = row
+	}
+	row.Bytes += size
+	row.Objects++
+}
+
+func sortedRows[K comparable](rows map[K]*types.UsageRow, less func(a, b types.UsageRow) bool) []types.UsageRow {
+	sorted := make([]types.UsageRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, *row)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// writeUsageReportCSV writes every group of the report as one table, the dimension column tells
+// which breakdown a row belongs to. Write errors are kept by out until it is flushed
+func writeUsageReportCSV(out *csv.Writer, report *types.UsageReport) {
+	out.Write([]string{"dimension", "owner", "folder", "category", "month", "bytes", "objects"})
+	dimensions := []struct {
+		name string
+		rows []types.UsageRow
+	}{
+		{"total", []types.UsageRow{{Bytes: report.Bytes, Objects: report.Objects}}},
+		{"owner", report.ByOwner},
+		{"folder", report.ByFolder},
+		{"category", report.ByCategory},
+		{"month", report.ByMonth},
+	}
+	for _, dimension := range dimensions {
+		for _, row := range dimension.rows {
+			record := []string{
+				dimension.name, row.Owner, row.Folder, string(row.Category), row.Month,
+				strconv.FormatInt(row.Bytes, 10), strconv.FormatInt(row.Objects, 10),
+			}
+			out.Write(record)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+// Scope is the space of the drive a request works in. Paths sent by clients are relative
+// to the root of the space and bucket keys are turned back into relative paths in responses
+type Scope struct {
+	User  *types.User
+	Space types.Space
+	// Root is the bucket prefix of the space with a trailing slash, empty for the whole bucket
+	Root string
+	// Implicit is set when the client did not pick a space, the root listing then shows every space
+	Implicit bool
+}
+
+// NewScope resolves the space a user asked for, an empty space is the user's home
+func NewScope(user *types.User, space types.Space) (*Scope, *error.RequestError) {
+	if user == nil || user.ID == "" {
+		return nil, error.NewRequestError(nil, error.UnauthorizedError, "unauthorized", nil)
+	}
+
+	scope := &Scope{User: user, Space: space, Implicit: space == ""}
+	switch space {
+	case "", types.SpaceHome:
+		if user.IsKid() {
+			// Child accounts have no private space, everything they do is visible to their parents
+			if space != "" {
+				return nil, error.NewRequestError(nil, error.ForbiddenError, "child accounts only have the family space", nil)
+			}
+			scope.Space = types.SpaceFamily
+			scope.Root = types.FamilyPrefix
+			break
+		}
+		scope.Space = types.SpaceHome
+		scope.Root = types.HomePrefix(user.ID)
+	case types.SpaceFamily:
+		scope.Root = types.FamilyPrefix
+	case types.SpaceAll:
+		if !administers(user) {
+			return nil, error.NewRequestError(nil, error.ForbiddenError, "the administer permission is required to browse the whole drive", nil)
+		}
+	default:
+		return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("unknown space: %s", space), nil)
+	}
+	return scope, nil
+}
+
+// Key turns a path relative to the space into a bucket key.
+// Paths trying to climb out of the space are rejected
+func (s *Scope) Key(path string) (string, *error.RequestError) {
+	path = strings.TrimPrefix(path, "/")
+	for _, segment := range strings.Split(path, "/") {
+		if segment == ".." || segment == "." {
+			return "", error.NewRequestError(nil, error.BadRequestError, "paths must not contain . or .. segments", nil)
+		}
+	}
+	return s.Root + path, nil
+}
+
+// Prefix turns a folder path relative to the space into a bucket prefix with a trailing slash.
+// The root of the space is an empty path
+func (s *Scope) Prefix(path string) (string, *error.RequestError) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return s.Root, nil
+	}
+	return s.Key(path + "/")
+}
+
+// Path turns a bucket key into a path relative to the space, it returns false for keys outside of it
+func (s *Scope) Path(key string) (string, bool) {
+	if !strings.HasPrefix(key, s.Root) {
+		return "", false
+	}
+	return strings.TrimPrefix(key, s.Root), true
+}
+
+// spacesOf returns the spaces shown at the root of the drive of the user
+func spacesOf(user *types.User) []types.Space {
+	if user.IsKid() {
+		return []types.Space{types.SpaceFamily}
+	}
+	return types.Spaces
+}
+
+// Contains returns true if the bucket key is inside the space
+func (s *Scope) Contains(key string) bool {
+	return strings.HasPrefix(key, s.Root)
+}
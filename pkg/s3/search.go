@@ -0,0 +1,113 @@
+package s3
+
+import (
+	"context"
+	"strings"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// Search finds files and folders anywhere in the space by name, leaving out the ones the user cannot read.
+// It is answered from the metadata index, so it is unavailable until the index is built
+func (c *controller) Search(scope *Scope, query string, limit int) (*types.SearchResults, *error.RequestError) {
+	ctx := context.TODO()
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "q must not be empty", c.logger)
+	}
+	if !c.metadataReady(ctx) {
+		return nil, error.NewRequestError(nil, error.ServiceUnavailableError, "search is not available until the index is built", c.logger)
+	}
+
+	rules, err := c.accessRules(ctx, scope.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results the user cannot read are left out after the index ranked them, fetch more
+	// until the page is full or there are no more matches
+	readable := make([]types.SearchResult, 0, limit)
+	for fetch := limit; ; fetch *= 4 {
+		results, err := c.metadata.Search(ctx, scope.Root, query, fetch)
+		if err != nil {
+			return nil, err
+		}
+		readable = readable[:0]
+		for _, result := range results {
+			if !allows(rules, scope.User, result.Path, types.PermissionRead) {
+				continue
+			}
+			result.Path, _ = scope.Path(result.Path)
+			readable = append(readable, result)
+			if len(readable) == limit {
+				break
+			}
+		}
+		if len(readable) == limit || len(results) < fetch {
+			break
+		}
+	}
+	return &types.SearchResults{Query: query, Results: readable}, nil
+}
+
+// SearchContent finds text documents by the words inside them.
+// Results the user is not allowed to read are left out
+func (c *controller) SearchContent(scope *Scope, query string, limit int) (*types.ContentSearchResults, *error.RequestError) {
+	ctx := context.TODO()
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "q must not be empty", c.logger)
+	}
+	if c.fulltext == nil || !c.metadataReady(ctx) {
+		return nil, error.NewRequestError(nil, error.ServiceUnavailableError, "search is not available until the index is built", c.logger)
+	}
+
+	rules, err := c.accessRules(ctx, scope.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	// As for names, fetch more matches until the page is full of results the user can read
+	results := make([]types.ContentSearchResult, 0, limit)
+	for fetch := limit; ; fetch *= 4 {
+		matches, err := c.fulltext.Search(ctx, scope.Root, query, fetch)
+		if err != nil {
+			return nil, err
+		}
+		results = results[:0]
+		for _, match := range matches {
+			if len(results) == limit {
+				break
+			}
+			if !allows(rules, scope.User, match.Key, types.PermissionRead) {
+				continue
+			}
+			// The full-text index can lag behind a deletion
+			object, err := c.metadata.Get(ctx, match.Key)
+			if err != nil {
+				return nil, err
+			}
+			if object == nil {
+				continue
+			}
+			path, _ := scope.Path(object.Key)
+			results = append(results, types.ContentSearchResult{
+				Path:         path,
+				Name:         object.Name(),
+				Size:         object.Size,
+				LastModified: object.LastModified,
+				Snippet:      match.Snippet,
+			})
+		}
+		if len(results) == limit || len(matches) < fetch {
+			break
+		}
+	}
+	return &types.ContentSearchResults{Query: query, Results: results}, nil
+}
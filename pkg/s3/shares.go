@@ -0,0 +1,299 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	api_aws "github.com/JosueMolinaMorales/family-cloud-api/internal/config/aws"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// defaultShareDuration is how long a share link works when the owner does not say
+	defaultShareDuration = time.Hour * 24 * 7
+	// maxShareDuration bounds how long a share link can work
+	maxShareDuration = time.Hour * 24 * 90
+)
+
+// CreateShare shares a file or folder the user can read through a public link.
+// The user has to be able to read it without their groups, as the link does
+func (c *controller) CreateShare(scope *Scope, req *types.ShareRequest) (*types.ShareLink, *error.RequestError) {
+	ctx := context.TODO()
+	if err := c.requireShares(); err != nil {
+		return nil, err
+	}
+	// A link opens without the groups of its owner, which are what keeps a child account in its folder
+	if scope.User.IsKid() {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "child accounts cannot share links", c.logger)
+	}
+	if strings.Trim(req.Path, "/") == "" {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "path must not be empty", c.logger)
+	}
+	key, err := scope.Key(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := defaultShareDuration
+	if req.ExpiresIn != 0 {
+		duration = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if duration <= 0 || duration > maxShareDuration {
+		return nil, error.NewRequestError(nil, error.BadRequestError, fmt.Sprintf("expiresIn must be between 1 and %d seconds", int64(maxShareDuration.Seconds())), c.logger)
+	}
+	if req.MaxDownloads < 0 {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "maxDownloads must not be negative", c.logger)
+	}
+
+	item, err := c.describePath(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || !c.canRead(ctx, scope.User, item.Path) {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file or folder not found", c.logger)
+	}
+
+	now := time.Now()
+	link := &types.ShareLink{
+		Key:          item.Path,
+		Owner:        scope.User.ID,
+		OwnerName:    scope.User.Username,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(duration),
+		MaxDownloads: req.MaxDownloads,
+	}
+	// The link opens with the grants of its owner without their groups, a link that could never open is refused
+	rules, err := c.accessRules(ctx, link.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !rules.Allows(link.OwnerUser(), link.Key, types.PermissionRead) {
+		return nil, error.NewRequestError(nil, error.ForbiddenError, "a link can only share what you can read yourself, not through your groups", c.logger)
+	}
+	link, err = c.shares.Create(ctx, *link, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Infof("%s shared %s until %s", scope.User.Username, link.Key, link.ExpiresAt.Format(time.RFC3339))
+	return relativeShare(link), nil
+}
+
+// ListShares returns the links shared by the user, including the ones that expired
+func (c *controller) ListShares(scope *Scope) ([]types.ShareLink, *error.RequestError) {
+	if err := c.requireShares(); err != nil {
+		return nil, err
+	}
+	links, err := c.shares.List(context.TODO(), scope.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		links[i] = *relativeShare(&links[i])
+	}
+	return links, nil
+}
+
+// RevokeShare deletes a link shared by the user, administrators can revoke the links of anyone
+func (c *controller) RevokeShare(scope *Scope, id string) *error.RequestError {
+	if err := c.requireShares(); err != nil {
+		return err
+	}
+	owner := scope.User.ID
+	if administers(scope.User) {
+		owner = ""
+	}
+	revoked, err := c.shares.Revoke(context.TODO(), id, owner)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return error.NewRequestError(nil, error.NotFoundError, "share link not found", c.logger)
+	}
+	return nil
+}
+
+// OpenShare resolves a share link without an account. A shared file is described, a shared folder is
+// listed, or the folder under it given by path. Nothing is downloaded so the link is not used
+func (c *controller) OpenShare(ctx context.Context, token string, password string, path string) (*types.SharedItem, *error.RequestError) {
+	if err := c.requireShares(); err != nil {
+		return nil, err
+	}
+	link, err := c.shares.Open(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+	if !link.IsDir {
+		if strings.Trim(path, "/") != "" {
+			return nil, error.NewRequestError(nil, error.BadRequestError, "path only applies to shared folders", c.logger)
+		}
+		item, err := c.sharedFile(ctx, link, link.Key)
+		if err != nil {
+			return nil, err
+		}
+		return &types.SharedItem{
+			Name:          shareName(link.Key),
+			Size:          item.Size,
+			LastModified:  item.LastModified,
+			ExpiresAt:     link.ExpiresAt,
+			DownloadsLeft: downloadsLeft(link),
+		}, nil
+	}
+
+	owner := link.OwnerUser()
+	shared := &Scope{User: owner, Root: link.Key}
+	prefix, err := shared.Prefix(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := c.accessRules(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	item, err := c.describePath(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || !rules.Allows(owner, prefix, types.PermissionRead) {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "folder not found", c.logger)
+	}
+
+	var folder *types.Folder
+	ready := c.metadataReady(ctx)
+	if ready {
+		folder, _, err = c.listFolderFromIndex(prefix, nil)
+	} else {
+		folder, _, err = c.listFolderFromBucket(prefix, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pruneUnreadable(rules, owner, folder, prefix)
+	if ready {
+		if err := c.readableTotals(ctx, rules, owner, folder, prefix); err != nil {
+			return nil, err
+		}
+	}
+	if folder.Name, _ = shared.Path(prefix); folder.Name == "" {
+		folder.Name = "/"
+	}
+
+	return &types.SharedItem{
+		Name:          shareName(link.Key),
+		IsDir:         true,
+		Size:          folder.Size,
+		LastModified:  folder.LastModified,
+		Folder:        folder,
+		ExpiresAt:     link.ExpiresAt,
+		DownloadsLeft: downloadsLeft(link),
+	}, nil
+}
+
+// DownloadShare downloads the shared file, or a file inside a shared folder given by path relative to it.
+// Each download counts against the limit of the link
+func (c *controller) DownloadShare(ctx context.Context, token string, password string, path string) (*types.SharedItem, *error.RequestError) {
+	if err := c.requireShares(); err != nil {
+		return nil, err
+	}
+	link, err := c.shares.Open(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+	if !link.IsDir {
+		if strings.Trim(path, "/") != "" {
+			return nil, error.NewRequestError(nil, error.BadRequestError, "path only applies to shared folders", c.logger)
+		}
+		return c.downloadShared(ctx, link, link.Key)
+	}
+	if strings.Trim(path, "/") == "" || strings.HasSuffix(path, "/") {
+		return nil, error.NewRequestError(nil, error.BadRequestError, "path must be the path of a file in the shared folder", c.logger)
+	}
+	key, err := (&Scope{Root: link.Key}).Key(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.downloadShared(ctx, link, key)
+}
+
+// sharedFile describes the file at key opened through the link. The link only opens what its owner
+// can still read, checked against the grants without the owner's groups
+func (c *controller) sharedFile(ctx context.Context, link *types.ShareLink, key string) (*types.Favorite, *error.RequestError) {
+	item, err := c.describePath(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.IsDir {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file not found", c.logger)
+	}
+	rules, err := c.accessRules(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !rules.Allows(link.OwnerUser(), key, types.PermissionRead) {
+		return nil, error.NewRequestError(nil, error.NotFoundError, "file not found", c.logger)
+	}
+	return item, nil
+}
+
+// downloadShared counts a download of the link and presigns the file at key
+func (c *controller) downloadShared(ctx context.Context, link *types.ShareLink, key string) (*types.SharedItem, *error.RequestError) {
+	item, err := c.sharedFile(ctx, link, key)
+	if err != nil {
+		return nil, err
+	}
+
+	name := shareName(key)
+	url, err := c.s3Client.DownloadObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(api_aws.BucketName),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": name})),
+	})
+	if err != nil {
+		return nil, err
+	}
+	used, err := c.shares.Use(ctx, link.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.SharedItem{
+		Name:          name,
+		Size:          item.Size,
+		LastModified:  item.LastModified,
+		URL:           url,
+		ExpiresAt:     used.ExpiresAt,
+		DownloadsLeft: downloadsLeft(used),
+	}, nil
+}
+
+// relativeShare shows the key of a link as a path in the space of its owner
+func relativeShare(link *types.ShareLink) *types.ShareLink {
+	link.Space, link.Path = spaceOf(link.Owner, link.Key)
+	return link
+}
+
+// shareName returns the name of the shared file or folder at key
+func shareName(key string) string {
+	key = strings.TrimSuffix(key, "/")
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+func downloadsLeft(link *types.ShareLink) *int64 {
+	if link.MaxDownloads == 0 {
+		return nil
+	}
+	left := max(link.MaxDownloads-link.Downloads, 0)
+	return &left
+}
+
+func (c *controller) requireShares() *error.RequestError {
+	if c.shares == nil {
+		return error.NewRequestError(fmt.Errorf("share store is not configured"), error.InternalServerError, "share links are not available", c.logger)
+	}
+	return nil
+}
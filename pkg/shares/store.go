@@ -0,0 +1,223 @@
+// Package shares keeps the public links users share files and folders with.
+package shares
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	"github.com/google/uuid"
+)
+
+// Store is the interface for the share link store
+type Store interface {
+	// Create saves a new link and returns it along with its token, the only time the token is known
+	Create(ctx context.Context, link types.ShareLink, password string) (*types.ShareLink, *api_error.RequestError)
+	// Open returns the link of a token. Unknown tokens are not found, expired and used up links are gone
+	// and a missing or wrong password is unauthorized
+	Open(ctx context.Context, token string, password string) (*types.ShareLink, *api_error.RequestError)
+	// Use counts a download of the link, a link used up in the meantime is gone
+	Use(ctx context.Context, id string) (*types.ShareLink, *api_error.RequestError)
+	// List returns the links shared by owner, the newest first
+	List(ctx context.Context, owner string) ([]types.ShareLink, *api_error.RequestError)
+	// Revoke deletes the link shared by owner, an empty owner revokes the link whoever shared it.
+	// It returns false if there was no such link
+	Revoke(ctx context.Context, id string, owner string) (bool, *api_error.RequestError)
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS share_links (
+	id            TEXT PRIMARY KEY,
+	token_hash    TEXT NOT NULL UNIQUE,
+	key           TEXT NOT NULL,
+	owner         TEXT NOT NULL,
+	owner_name    TEXT NOT NULL,
+	password_salt TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at    INTEGER NOT NULL,
+	expires_at    INTEGER NOT NULL,
+	max_downloads INTEGER NOT NULL,
+	downloads     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS share_links_owner ON share_links(owner);
+`
+
+const columns = `id, key, owner, owner_name, password_hash != '', created_at, expires_at, max_downloads, downloads`
+
+// NewStore creates the share link table if needed and returns the store
+func NewStore(logger log.Logger, db *sql.DB) Store {
+	if _, err := db.Exec(schema); err != nil {
+		panic(err)
+	}
+
+	return &sqlStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	logger log.Logger
+}
+
+func (s *sqlStore) Create(ctx context.Context, link types.ShareLink, password string) (*types.ShareLink, *api_error.RequestError) {
+	token, err := NewToken()
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to create share link", s.logger)
+	}
+	var salt, hash string
+	if password != "" {
+		if salt, err = randomString(16); err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to create share link", s.logger)
+		}
+		hash = hashPassword(password, salt)
+	}
+
+	link.ID = uuid.New().String()
+	link.Token = token
+	link.IsDir = strings.HasSuffix(link.Key, "/")
+	link.HasPassword = password != ""
+	link.Downloads = 0
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO share_links (id, token_hash, key, owner, owner_name, password_salt, password_hash, created_at, expires_at, max_downloads, downloads)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)`,
+		link.ID, HashToken(token), link.Key, link.Owner, link.OwnerName, salt, hash, link.CreatedAt.UnixNano(), link.ExpiresAt.UnixNano(), link.MaxDownloads,
+	); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to create share link", s.logger)
+	}
+	return &link, nil
+}
+
+func (s *sqlStore) Open(ctx context.Context, token string, password string) (*types.ShareLink, *api_error.RequestError) {
+	var salt, hash string
+	row := s.db.QueryRowContext(ctx, `SELECT `+columns+`, password_salt, password_hash FROM share_links WHERE token_hash = ?`, HashToken(token))
+	link, err := scanLink(row, &salt, &hash)
+	if err == sql.ErrNoRows {
+		return nil, api_error.NewRequestError(nil, api_error.NotFoundError, "share link not found", s.logger)
+	}
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to open share link", s.logger)
+	}
+
+	if err := gone(link); err != nil {
+		return nil, err
+	}
+	if hash != "" {
+		if password == "" {
+			return nil, api_error.NewRequestError(nil, api_error.UnauthorizedError, "the share link needs a password", s.logger).WithDetails(map[string]bool{"passwordRequired": true})
+		}
+		if !checkPassword(password, salt, hash) {
+			return nil, api_error.NewRequestError(nil, api_error.UnauthorizedError, "wrong password", s.logger).WithDetails(map[string]bool{"passwordRequired": true})
+		}
+	}
+	return link, nil
+}
+
+func (s *sqlStore) Use(ctx context.Context, id string) (*types.ShareLink, *api_error.RequestError) {
+	// The limit is checked by the update so concurrent downloads cannot go over it
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE share_links SET downloads = downloads + 1
+		WHERE id = ? AND expires_at > ? AND (max_downloads = 0 OR downloads < max_downloads)`,
+		id, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to count download", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to count download", s.logger)
+	}
+
+	link, err := scanLink(s.db.QueryRowContext(ctx, `SELECT `+columns+` FROM share_links WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, api_error.NewRequestError(nil, api_error.NotFoundError, "share link not found", s.logger)
+	}
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to count download", s.logger)
+	}
+	if affected == 0 {
+		if err := gone(link); err != nil {
+			return nil, err
+		}
+		return nil, api_error.NewRequestError(nil, api_error.GoneError, "the share link was used up", s.logger)
+	}
+	return link, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, owner string) ([]types.ShareLink, *api_error.RequestError) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+columns+` FROM share_links WHERE owner = ? ORDER BY created_at DESC`, owner)
+	if err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list share links", s.logger)
+	}
+	defer rows.Close()
+
+	links := make([]types.ShareLink, 0)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list share links", s.logger)
+		}
+		links = append(links, *link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, api_error.NewRequestError(err, api_error.InternalServerError, "failed to list share links", s.logger)
+	}
+	return links, nil
+}
+
+func (s *sqlStore) Revoke(ctx context.Context, id string, owner string) (bool, *api_error.RequestError) {
+	query := `DELETE FROM share_links WHERE id = ?`
+	args := []interface{}{id}
+	if owner != "" {
+		query += ` AND owner = ?`
+		args = append(args, owner)
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to revoke share link", s.logger)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, api_error.NewRequestError(err, api_error.InternalServerError, "failed to revoke share link", s.logger)
+	}
+	return affected > 0, nil
+}
+
+// gone returns the error of a link that can no longer be opened
+func gone(link *types.ShareLink) *api_error.RequestError {
+	if link.Expired(time.Now()) {
+		return api_error.NewRequestError(nil, api_error.GoneError, fmt.Sprintf("the share link expired on %s", link.ExpiresAt.Format(time.RFC1123)), nil)
+	}
+	if link.UsedUp() {
+		return api_error.NewRequestError(nil, api_error.GoneError, "the share link was used up", nil)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLink reads a row of columns, followed by extra columns when given
+func scanLink(row scanner, extra ...interface{}) (*types.ShareLink, error) {
+	var link types.ShareLink
+	var createdAt, expiresAt int64
+	dest := []interface{}{
+		&link.ID, &link.Key, &link.Owner, &link.OwnerName, &link.HasPassword,
+		&createdAt, &expiresAt, &link.MaxDownloads, &link.Downloads,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	link.IsDir = strings.HasSuffix(link.Key, "/")
+	link.CreatedAt = time.Unix(0, createdAt).UTC()
+	link.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return &link, nil
+}
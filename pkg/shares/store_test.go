@@ -0,0 +1,229 @@
+package shares
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JosueMolinaMorales/family-cloud-api/internal/config/log"
+	api_error "github.com/JosueMolinaMorales/family-cloud-api/pkg/error"
+	"github.com/JosueMolinaMorales/family-cloud-api/pkg/types"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) (Store, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens its own database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db), db
+}
+
+// newFileStore opens a database file the way the server does, so several connections write at the same time
+func newFileStore(t *testing.T) Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "shares.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	logger, _ := log.NewLogerForTest()
+	return NewStore(logger, db)
+}
+
+func newLink(key string, expiresIn time.Duration, maxDownloads int64) types.ShareLink {
+	now := time.Now()
+	return types.ShareLink{
+		Key:          key,
+		Owner:        "owner",
+		OwnerName:    "owner",
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(expiresIn),
+		MaxDownloads: maxDownloads,
+	}
+}
+
+func checkStatus(t *testing.T, what string, err *api_error.RequestError, want api_error.Type) {
+	t.Helper()
+	if err == nil || err.Status != want {
+		t.Errorf("%s returned %v, want a %d", what, err, want)
+	}
+}
+
+func TestCreateStoresTokenHash(t *testing.T) {
+	ctx := context.Background()
+	store, db := newTestStore(t)
+
+	link, err := store.Create(ctx, newLink("home/a/Photos/", time.Hour, 0), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Token == "" || !link.IsDir {
+		t.Fatalf("Create() = %+v", link)
+	}
+
+	var stored string
+	if err := db.QueryRow(`SELECT token_hash FROM share_links WHERE id = ?`, link.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored == link.Token || stored != HashToken(link.Token) {
+		t.Errorf("the link is stored under %q, want the hash of its token", stored)
+	}
+
+	// The token is only known when the link is created
+	opened, err := store.Open(ctx, link.Token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.ID != link.ID || opened.Token != "" {
+		t.Errorf("Open() = %+v", opened)
+	}
+	_, err = store.Open(ctx, HashToken(link.Token), "")
+	checkStatus(t, "opening with the stored hash", err, api_error.NotFoundError)
+}
+
+func TestOpenPassword(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	link, err := store.Create(ctx, newLink("home/a/report.pdf", time.Hour, 0), "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.HasPassword {
+		t.Error("the link should have a password")
+	}
+
+	_, err = store.Open(ctx, link.Token, "")
+	checkStatus(t, "opening without the password", err, api_error.UnauthorizedError)
+	_, err = store.Open(ctx, link.Token, "hunter3")
+	checkStatus(t, "opening with a wrong password", err, api_error.UnauthorizedError)
+	if _, err := store.Open(ctx, link.Token, "hunter2"); err != nil {
+		t.Errorf("opening with the password returned %v", err)
+	}
+}
+
+func TestOpenDoesNotCount(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	link, err := store.Create(ctx, newLink("home/a/report.pdf", time.Hour, 1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		opened, err := store.Open(ctx, link.Token, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened.Downloads != 0 {
+			t.Fatalf("opening the link counted %d downloads", opened.Downloads)
+		}
+	}
+
+	used, err := store.Use(ctx, link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.Downloads != 1 {
+		t.Errorf("Use() counted %d downloads, want 1", used.Downloads)
+	}
+	_, err = store.Open(ctx, link.Token, "")
+	checkStatus(t, "opening a used up link", err, api_error.GoneError)
+}
+
+func TestUseLimitConcurrently(t *testing.T) {
+	ctx := context.Background()
+	store := newFileStore(t)
+
+	link, err := store.Create(ctx, newLink("home/a/report.pdf", time.Hour, 3), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counted, gone := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Use(ctx, link.ID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				counted++
+			case err.Status == api_error.GoneError:
+				gone++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if counted != 3 || gone != 7 {
+		t.Errorf("%d downloads were counted and %d refused, want 3 and 7", counted, gone)
+	}
+}
+
+func TestExpiredLink(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	link, err := store.Create(ctx, newLink("home/a/report.pdf", -time.Minute, 0), "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An expired link is gone whatever the password
+	_, err = store.Open(ctx, link.Token, "")
+	checkStatus(t, "opening an expired link", err, api_error.GoneError)
+	_, err = store.Use(ctx, link.ID)
+	checkStatus(t, "counting a download of an expired link", err, api_error.GoneError)
+
+	_, err = store.Use(ctx, "missing")
+	checkStatus(t, "counting a download of an unknown link", err, api_error.NotFoundError)
+}
+
+func TestListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	first, err := store.Create(ctx, newLink("home/a/1.txt", time.Hour, 0), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := newLink("home/a/2.txt", time.Hour, 0)
+	second.CreatedAt = second.CreatedAt.Add(time.Second)
+	if _, err := store.Create(ctx, second, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := store.List(ctx, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].Key != "home/a/2.txt" {
+		t.Fatalf("List() = %+v, want the newest first", links)
+	}
+
+	if revoked, err := store.Revoke(ctx, first.ID, "someone else"); err != nil || revoked {
+		t.Errorf("someone else revoked the link: %v, %v", revoked, err)
+	}
+	if revoked, err := store.Revoke(ctx, first.ID, "owner"); err != nil || !revoked {
+		t.Errorf("the owner could not revoke the link: %v, %v", revoked, err)
+	}
+	_, err = store.Open(ctx, first.Token, "")
+	checkStatus(t, "opening a revoked link", err, api_error.NotFoundError)
+}
@@ -0,0 +1,67 @@
+package shares
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+const (
+	// tokenBytes is the entropy of a link token
+	tokenBytes = 32
+	// passwordIterations is the PBKDF2 work factor of link passwords
+	passwordIterations = 100_000
+)
+
+// NewToken returns a random url safe token for a public link
+func NewToken() (string, error) {
+	return randomString(tokenBytes)
+}
+
+// HashToken is how the token of a link is stored, a leaked table does not give working links away
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashPassword derives the stored hash of a link password with PBKDF2-HMAC-SHA256
+func hashPassword(password string, salt string) string {
+	return hex.EncodeToString(pbkdf2([]byte(password), []byte(salt), passwordIterations))
+}
+
+// pbkdf2 derives a key the length of a SHA-256 sum, a single block of PBKDF2-HMAC-SHA256
+func pbkdf2(password []byte, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	block := make([]byte, 4)
+	binary.BigEndian.PutUint32(block, 1)
+	mac.Write(block)
+	u := mac.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// checkPassword compares a password with its stored hash in constant time
+func checkPassword(password string, salt string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashPassword(password, salt)), []byte(hash)) == 1
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
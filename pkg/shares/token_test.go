@@ -0,0 +1,72 @@
+package shares
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestNewToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := NewToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 32 bytes of base64 without padding
+		if len(token) != 43 || strings.ContainsAny(token, "+/=") {
+			t.Fatalf("NewToken() = %q, want 43 url safe characters", token)
+		}
+		if seen[token] {
+			t.Fatalf("NewToken() returned %q twice", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc"
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashToken("abc"); got != want {
+		t.Errorf("HashToken(abc) = %s, want %s", got, want)
+	}
+	if HashToken("abc") == HashToken("abd") {
+		t.Error("different tokens hash the same")
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors of PBKDF2-HMAC-SHA256 with a 32 byte key
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{password: "password", salt: "salt", iterations: 1, want: "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{password: "password", salt: "salt", iterations: 2, want: "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{password: "password", salt: "salt", iterations: 4096, want: "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations)); got != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash := hashPassword("correct horse", "salt")
+	if !checkPassword("correct horse", "salt", hash) {
+		t.Error("the right password was refused")
+	}
+	for _, tt := range []struct{ password, salt string }{
+		{password: "correct hors", salt: "salt"},
+		{password: "Correct horse", salt: "salt"},
+		{password: "correct horse", salt: "other salt"},
+		{password: "", salt: "salt"},
+	} {
+		if checkPassword(tt.password, tt.salt, hash) {
+			t.Errorf("password %q with salt %q was accepted", tt.password, tt.salt)
+		}
+	}
+}
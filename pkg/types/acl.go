@@ -0,0 +1,85 @@
+package types
+
+import "time"
+
+// Permission is what a grant allows on a folder. Every permission includes the ones before it
+type Permission string
+
+const (
+	// PermissionRead allows listing the folder and downloading its files
+	PermissionRead Permission = "read"
+	// PermissionWrite allows uploading and locking files in the folder
+	PermissionWrite Permission = "write"
+	// PermissionManage allows editing the grants of the folder
+	PermissionManage Permission = "manage"
+)
+
+var permissionLevels = map[Permission]int{
+	PermissionRead:   1,
+	PermissionWrite:  2,
+	PermissionManage: 3,
+}
+
+// Valid returns true for a known permission
+func (p Permission) Valid() bool {
+	_, ok := permissionLevels[p]
+	return ok
+}
+
+// Includes returns true if holding p also gives other
+func (p Permission) Includes(other Permission) bool {
+	return permissionLevels[p] >= permissionLevels[other]
+}
+
+// PrincipalType is the kind of principal a grant is given to
+type PrincipalType string
+
+const (
+	// PrincipalUser is a single user, identified by their Cognito sub
+	PrincipalUser PrincipalType = "user"
+	// PrincipalGroup is every member of a Cognito group
+	PrincipalGroup PrincipalType = "group"
+)
+
+// Grant gives or denies a permission on a folder and everything under it.
+// Grants are set in the family space only, homes are private to their owner
+type Grant struct {
+	// Path is the folder the grant is set on, with a trailing slash
+	Path          string        `json:"path"`
+	PrincipalType PrincipalType `json:"principalType"`
+	Principal     string        `json:"principal"`
+	Permission    Permission    `json:"permission"`
+	// Deny takes the permission, and every permission including it, away instead of giving it
+	Deny      bool      `json:"deny"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AppliesTo returns true if the grant is given to the user or to one of their groups
+func (g *Grant) AppliesTo(user *User) bool {
+	switch g.PrincipalType {
+	case PrincipalUser:
+		return user.ID == g.Principal
+	case PrincipalGroup:
+		return user.InGroup(g.Principal)
+	}
+	return false
+}
+
+// ACL are the grants set on a folder and the ones it inherits from its parents
+type ACL struct {
+	Path      string  `json:"path"`
+	Grants    []Grant `json:"grants"`
+	Inherited []Grant `json:"inherited"`
+	// Permissions are what the caller holds on the folder
+	Permissions []Permission `json:"permissions"`
+}
+
+// GrantRequest describes a grant a client wants to set on a folder
+type GrantRequest struct {
+	Path          string        `json:"path"`
+	PrincipalType PrincipalType `json:"principalType"`
+	Principal     string        `json:"principal"`
+	Permission    Permission    `json:"permission"`
+	Deny          bool          `json:"deny"`
+}
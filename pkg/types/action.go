@@ -0,0 +1,21 @@
+package types
+
+// Action is an API operation a Cognito group can be allowed to perform.
+// Folder grants then decide where in the drive it applies
+type Action string
+
+const (
+	// ActionBrowse allows listing, searching and downloading files
+	ActionBrowse Action = "browse"
+	// ActionUpload allows uploading and locking files
+	ActionUpload Action = "upload"
+	// ActionShare allows sharing files outside of the household
+	ActionShare Action = "share"
+	// ActionManageAccess allows editing the grants of folders
+	ActionManageAccess Action = "manage-access"
+	// ActionAdminister allows running maintenance and breaking the locks of others
+	ActionAdminister Action = "administer"
+)
+
+// Actions are every action, in the order they are listed
+var Actions = []Action{ActionBrowse, ActionUpload, ActionShare, ActionManageAccess, ActionAdminister}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"path"
+	"strings"
+)
+
+// Category is a broad content family a file belongs to, derived from its extension
+type Category string
+
+const (
+	// CategoryImages is for photos and other pictures
+	CategoryImages Category = "images"
+	// CategoryVideos is for video files
+	CategoryVideos Category = "videos"
+	// CategoryAudio is for music and voice recordings
+	CategoryAudio Category = "audio"
+	// CategoryDocuments is for text, office and pdf documents
+	CategoryDocuments Category = "documents"
+	// CategoryOther is for everything that is not recognised
+	CategoryOther Category = "other"
+)
+
+var categoryExtensions = map[Category][]string{
+	CategoryImages:    {"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "webp", "heic", "heif", "svg", "raw", "cr2", "nef", "dng"},
+	CategoryVideos:    {"mp4", "mov", "m4v", "avi", "mkv", "wmv", "webm", "mpg", "mpeg", "3gp"},
+	CategoryAudio:     {"mp3", "m4a", "wav", "aac", "flac", "ogg", "wma", "aiff"},
+	CategoryDocuments: {"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "odt", "ods", "odp", "rtf", "txt", "md", "csv", "json", "pages", "numbers", "key"},
+}
+
+var extensionCategory = func() map[string]Category {
+	m := make(map[string]Category)
+	for category, exts := range categoryExtensions {
+		for _, ext := range exts {
+			m[ext] = category
+		}
+	}
+	return m
+}()
+
+// ParseCategory returns the category with the given name, it also accepts the
+// singular and MIME family spelling (e.g. "image" or "video")
+func ParseCategory(name string) (Category, bool) {
+	switch strings.ToLower(name) {
+	case "images", "image", "photos", "photo":
+		return CategoryImages, true
+	case "videos", "video":
+		return CategoryVideos, true
+	case "audio":
+		return CategoryAudio, true
+	case "documents", "document", "docs", "text", "application":
+		return CategoryDocuments, true
+	case "other":
+		return CategoryOther, true
+	}
+	return "", false
+}
+
+// Extension returns the lower cased extension of a file name without the leading dot
+func Extension(name string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+}
+
+// CategoryOf returns the category of a file based on its name
+func CategoryOf(name string) Category {
+	if category, ok := extensionCategory[Extension(name)]; ok {
+		return category
+	}
+	return CategoryOther
+}
@@ -0,0 +1,39 @@
+package types
+
+import "time"
+
+// ChangeType is the kind of change reported by the change feed
+type ChangeType string
+
+const (
+	// ChangeCreated is a new object
+	ChangeCreated ChangeType = "create"
+	// ChangeModified is an object that was overwritten
+	ChangeModified ChangeType = "modify"
+	// ChangeDeleted is an object that was removed
+	ChangeDeleted ChangeType = "delete"
+	// ChangeMoved is an object the API moved to another key
+	ChangeMoved ChangeType = "move"
+)
+
+// Change is a single entry of the change feed
+type Change struct {
+	Type ChangeType `json:"type"`
+	Key  string     `json:"key"`
+	// From is the previous key of a moved object
+	From string    `json:"from,omitempty"`
+	Size int64     `json:"size"`
+	ETag string    `json:"etag"`
+	Time time.Time `json:"time"`
+}
+
+// ChangeFeed is a page of changes made to the bucket since a cursor
+type ChangeFeed struct {
+	Changes []Change `json:"changes"`
+	// Cursor is passed back to get the changes that happen next
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"hasMore"`
+	// ResetRequired is set when the changes since the cursor are no longer known
+	// and the client has to list the whole drive again
+	ResetRequired bool `json:"resetRequired"`
+}
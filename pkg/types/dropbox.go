@@ -0,0 +1,90 @@
+package types
+
+import "time"
+
+// DropBox lets people without an account upload into a folder without seeing what it holds
+type DropBox struct {
+	ID string `json:"id"`
+	// Token is the secret part of the link, it is only returned when the drop box is created
+	Token string `json:"token,omitempty"`
+	// Key is the prefix of the folder including the trailing slash
+	Key   string `json:"-"`
+	Space Space  `json:"space,omitempty"`
+	// Path is relative to Space
+	Path string `json:"path"`
+	// Owner is the ID of the user who created the drop box, uploads need their write permission on the folder
+	Owner     string `json:"owner"`
+	OwnerName string `json:"ownerName"`
+	// Message is shown to the people uploading
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxFiles is the number of files the drop box takes, zero is unlimited
+	MaxFiles int64 `json:"maxFiles,omitempty"`
+	// MaxFileSize is the largest file in bytes the drop box takes, zero is unlimited
+	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+	// Categories are the kinds of files the drop box takes, every kind when empty
+	Categories []Category `json:"categories,omitempty"`
+	// Uploads is the number of files that arrived, NewUploads the ones the owner has not looked at yet
+	Uploads      int64      `json:"uploads"`
+	NewUploads   int64      `json:"newUploads"`
+	LastUploadAt *time.Time `json:"lastUploadAt,omitempty"`
+}
+
+// Expired returns true once the drop box no longer takes files
+func (d *DropBox) Expired(now time.Time) bool {
+	return !now.Before(d.ExpiresAt)
+}
+
+// OwnerUser returns the owner of the drop box as the user whose permissions it carries. The owner has no
+// groups: the drop box writes where the grants and the owner's home let them, never where a role does
+func (d *DropBox) OwnerUser() *User {
+	return &User{ID: d.Owner, Username: d.OwnerName}
+}
+
+// DropBoxRequest describes a drop box a user wants to open on a folder
+type DropBoxRequest struct {
+	// Path is the folder the files go to
+	Path    string `json:"path"`
+	Space   Space  `json:"space,omitempty"`
+	Message string `json:"message,omitempty"`
+	// ExpiresIn is the number of seconds the drop box takes files for, zero means the default
+	ExpiresIn   int64      `json:"expiresIn"`
+	MaxFiles    int64      `json:"maxFiles"`
+	MaxFileSize int64      `json:"maxFileSize"`
+	Categories  []Category `json:"categories,omitempty"`
+}
+
+// DropBoxInfo is what the people uploading see of a drop box
+type DropBoxInfo struct {
+	// Folder is the name of the folder the files go to
+	Folder      string     `json:"folder"`
+	OwnerName   string     `json:"ownerName"`
+	Message     string     `json:"message,omitempty"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	MaxFileSize int64      `json:"maxFileSize,omitempty"`
+	Categories  []Category `json:"categories,omitempty"`
+	// FilesLeft is set when the number of files is limited
+	FilesLeft *int64 `json:"filesLeft,omitempty"`
+}
+
+// DropUploadRequest describes a file someone wants to drop
+type DropUploadRequest struct {
+	// File is the name of the file, it cannot contain folders
+	File        string `json:"file"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	// From is who the file comes from, shown to the owner
+	From string `json:"from,omitempty"`
+}
+
+// DropUpload is a file dropped into a drop box
+type DropUpload struct {
+	// Key is the bucket key of the file, Path is relative to the folder of the drop box
+	Key         string     `json:"-"`
+	Path        string     `json:"path"`
+	Size        int64      `json:"size"`
+	From        string     `json:"from,omitempty"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	ArrivedAt   *time.Time `json:"arrivedAt,omitempty"`
+}
@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+// EventType is the kind of change made to an object
+type EventType string
+
+const (
+	// ObjectCreated is sent when an object is uploaded or overwritten
+	ObjectCreated EventType = "created"
+	// ObjectRemoved is sent when an object is deleted
+	ObjectRemoved EventType = "removed"
+)
+
+// ObjectEvent is a change made to an object in the bucket
+type ObjectEvent struct {
+	Type EventType `json:"type"`
+	// Object always has a key, the size and etag are only known for created objects
+	Object Object    `json:"object"`
+	Time   time.Time `json:"time"`
+	// Sequencer orders the events of a single key, as sent by S3
+	Sequencer string `json:"sequencer,omitempty"`
+}
+
+// QueueMessage is a message received from a queue
+type QueueMessage struct {
+	ID            string
+	ReceiptHandle string
+	Body          string
+}
@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// Favorite is a file or folder starred by a user
+type Favorite struct {
+	// Path is the key of the file, or the prefix of the folder including the trailing slash
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	IsDir        bool      `json:"isDir"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	StarredAt    time.Time `json:"starredAt"`
+}
@@ -18,6 +18,12 @@ type Folder struct {
 	Items        []FileItem `json:"items"`
 	LastModified time.Time  `json:"lastModified"`
 	IsDir        bool       `json:"isDir"`
+	// Truncated is set when the items of the folder were left out of a depth limited listing
+	Truncated bool `json:"truncated,omitempty"`
+	// IsFavorite is set when the user listing the folder starred it
+	IsFavorite bool `json:"isFavorite"`
+	// Space is the space the folder belongs to
+	Space Space `json:"space,omitempty"`
 }
 
 // GetName returns the name of the folder
@@ -57,12 +63,26 @@ func (f *Folder) IsDirectory() bool {
 	return true
 }
 
+// FolderSize is the total size of the objects under a folder
+type FolderSize struct {
+	Size int64 `json:"size"`
+	// Approximate is set when the calculation was cut short and Size only covers part of the folder,
+	// or when the folder changed while it was calculated
+	Approximate bool `json:"approximate"`
+}
+
 // File is a file
 type File struct {
 	Name         string    `json:"name"`
 	Size         int64     `json:"size"`
 	LastModified time.Time `json:"lastModified"`
 	IsDir        bool      `json:"isDir"`
+	// Lock is set while the file is checked out
+	Lock *Lock `json:"lock,omitempty"`
+	// IsFavorite is set when the user listing the file starred it
+	IsFavorite bool `json:"isFavorite"`
+	// Space is the space the file belongs to
+	Space Space `json:"space,omitempty"`
 }
 
 // GetName returns the name of the file
@@ -0,0 +1,26 @@
+package types
+
+import "time"
+
+// JobStatus is the state of a background job
+type JobStatus string
+
+const (
+	// JobRunning is a job that has not finished yet
+	JobRunning JobStatus = "running"
+	// JobDone is a job that finished successfully
+	JobDone JobStatus = "done"
+	// JobFailed is a job that finished with an error
+	JobFailed JobStatus = "failed"
+)
+
+// FolderSizeJob is a folder size calculation running in the background
+type FolderSizeJob struct {
+	ID          string      `json:"id"`
+	Prefix      string      `json:"prefix"`
+	Status      JobStatus   `json:"status"`
+	Result      *FolderSize `json:"result,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	CompletedAt *time.Time  `json:"completedAt,omitempty"`
+}
@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// Lock marks a file as checked out by a user.
+// Locks are advisory: they do not stop reads, only uploads from other users
+type Lock struct {
+	Key string `json:"key"`
+	// Owner is the ID of the user holding the lock
+	Owner     string    `json:"owner"`
+	OwnerName string    `json:"ownerName"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired returns true once the lock is no longer held
+func (l *Lock) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// LockRequest describes a lock a client wants to take
+type LockRequest struct {
+	File string `json:"file"`
+	Note string `json:"note"`
+	// ExpiresIn is the number of seconds the lock is held for, zero means the default
+	ExpiresIn int64 `json:"expiresIn"`
+}
@@ -0,0 +1,25 @@
+package types
+
+import "time"
+
+// NotificationKind tells what a notification is about
+type NotificationKind string
+
+const (
+	// NotificationDroppedFile tells the owner of a drop box that a file arrived in it
+	NotificationDroppedFile NotificationKind = "dropped-file"
+)
+
+// Notification tells a user in the app about something that happened while they were away
+type Notification struct {
+	ID      string           `json:"id"`
+	Kind    NotificationKind `json:"kind"`
+	Message string           `json:"message"`
+	// Key is the bucket key of the file the notification is about
+	Key   string `json:"-"`
+	Space Space  `json:"space,omitempty"`
+	// Path is relative to Space
+	Path      string     `json:"path,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+}
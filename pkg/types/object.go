@@ -0,0 +1,47 @@
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// Object is the metadata of a single object in the bucket
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Name returns the last segment of the object key
+func (o *Object) Name() string {
+	key := strings.TrimSuffix(o.Key, "/")
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+// IsFolderMarker returns true for the empty objects created to represent a folder
+func (o *Object) IsFolderMarker() bool {
+	return strings.HasSuffix(o.Key, "/")
+}
+
+// FolderStats are the pre-aggregated totals of everything under a folder
+type FolderStats struct {
+	// Path is the prefix of the folder including the trailing slash, the root folder is empty
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	Objects      int64     `json:"objects"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Name returns the last segment of the folder path
+func (f *FolderStats) Name() string {
+	path := strings.TrimSuffix(f.Path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// ParentPath returns the path of the folder holding key, including the trailing slash.
+// Keys at the top of the bucket have an empty parent
+func ParentPath(key string) string {
+	key = strings.TrimSuffix(key, "/")
+	return key[:strings.LastIndex(key, "/")+1]
+}
@@ -0,0 +1,99 @@
+package types
+
+import "time"
+
+// Quota limits the storage of a user's space or of the whole household, zero means unlimited
+type Quota struct {
+	MaxBytes   int64 `json:"maxBytes"`
+	MaxObjects int64 `json:"maxObjects"`
+}
+
+// Usage is the storage used under a quota
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+	Quota   Quota `json:"quota"`
+	// RemainingBytes and RemainingObjects are left out when the quota is unlimited
+	RemainingBytes   *int64 `json:"remainingBytes,omitempty"`
+	RemainingObjects *int64 `json:"remainingObjects,omitempty"`
+}
+
+// NewUsage returns the usage of bytes and objects under quota
+func NewUsage(bytes int64, objects int64, quota Quota) Usage {
+	usage := Usage{Bytes: bytes, Objects: objects, Quota: quota}
+	if quota.MaxBytes > 0 {
+		remaining := max(quota.MaxBytes-bytes, 0)
+		usage.RemainingBytes = &remaining
+	}
+	if quota.MaxObjects > 0 {
+		remaining := max(quota.MaxObjects-objects, 0)
+		usage.RemainingObjects = &remaining
+	}
+	return usage
+}
+
+// Allows returns true if adding bytes and objects stays within the quota
+func (u *Usage) Allows(bytes int64, objects int64) bool {
+	if u.Quota.MaxBytes > 0 && u.Bytes+bytes > u.Quota.MaxBytes {
+		return false
+	}
+	return u.Quota.MaxObjects <= 0 || u.Objects+objects <= u.Quota.MaxObjects
+}
+
+// StorageUsage is the usage of a user's space and of the household
+type StorageUsage struct {
+	UserID    string `json:"userId"`
+	Home      Usage  `json:"home"`
+	Household Usage  `json:"household"`
+}
+
+const (
+	// OwnerFamily is the owner of the objects in the family space in a usage report
+	OwnerFamily = "family"
+	// OwnerUnassigned is the owner of the objects outside of every space in a usage report
+	OwnerUnassigned = "unassigned"
+)
+
+// UsagePhotos is the category of the images in a usage report
+const UsagePhotos Category = "photos"
+
+// UsageCategories are the categories a usage report breaks the storage down by, in the order of the report
+var UsageCategories = []Category{UsagePhotos, CategoryVideos, CategoryDocuments, CategoryOther}
+
+// UsageCategoryOf returns the usage report category of a file: images are photos and audio is other
+func UsageCategoryOf(name string) Category {
+	switch category := CategoryOf(name); category {
+	case CategoryImages:
+		return UsagePhotos
+	case CategoryVideos, CategoryDocuments:
+		return category
+	}
+	return CategoryOther
+}
+
+// UsageRow is the storage used by one group of objects of a usage report.
+// Only the fields the group is made of are set
+type UsageRow struct {
+	// Owner is the ID of the user whose home holds the objects, or OwnerFamily or OwnerUnassigned
+	Owner string `json:"owner,omitempty"`
+	// Folder is the top-level folder of the owner's space, empty for the files at its root
+	Folder string `json:"folder,omitempty"`
+	// Category is one of UsageCategories
+	Category Category `json:"category,omitempty"`
+	// Month is when the objects were uploaded, formatted as YYYY-MM
+	Month   string `json:"month,omitempty"`
+	Bytes   int64  `json:"bytes"`
+	Objects int64  `json:"objects"`
+}
+
+// UsageReport breaks the storage used by the whole drive down by owner, top-level folder,
+// content category and upload month
+type UsageReport struct {
+	GeneratedAt time.Time  `json:"generatedAt"`
+	Bytes       int64      `json:"bytes"`
+	Objects     int64      `json:"objects"`
+	ByOwner     []UsageRow `json:"byOwner"`
+	ByFolder    []UsageRow `json:"byFolder"`
+	ByCategory  []UsageRow `json:"byCategory"`
+	ByMonth     []UsageRow `json:"byMonth"`
+}
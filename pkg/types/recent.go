@@ -0,0 +1,60 @@
+package types
+
+import "time"
+
+// Activity is what happened to a file in the recent files feed
+type Activity string
+
+const (
+	// ActivityModified is a file uploaded or changed by anyone
+	ActivityModified Activity = "modified"
+	// ActivityDownloaded is a file the caller downloaded
+	ActivityDownloaded Activity = "downloaded"
+	// ActivityUploaded is a file a user uploaded
+	ActivityUploaded Activity = "uploaded"
+)
+
+// RecentFile is an entry of the recent files feed
+type RecentFile struct {
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Activity     Activity  `json:"activity"`
+	// At is when the activity happened
+	At time.Time `json:"at"`
+}
+
+// RecentDay holds the entries of the recent files feed that happened on the same day
+type RecentDay struct {
+	// Date is the day formatted as YYYY-MM-DD
+	Date  string       `json:"date"`
+	Files []RecentFile `json:"files"`
+}
+
+// RecentFeed is a page of the recent files feed, grouped by day from the latest
+type RecentFeed struct {
+	Days []RecentDay `json:"days"`
+	// Cursor fetches the next page
+	Cursor  string `json:"cursor,omitempty"`
+	HasMore bool   `json:"hasMore"`
+}
+
+// ActivityEntry is something a user did with a file
+type ActivityEntry struct {
+	Space    Space     `json:"space,omitempty"`
+	Path     string    `json:"path"`
+	Activity Activity  `json:"activity"`
+	Size     int64     `json:"size"`
+	At       time.Time `json:"at"`
+}
+
+// ActivitySummary sums up what a user did since a point in time
+type ActivitySummary struct {
+	UserID        string          `json:"userId"`
+	Since         time.Time       `json:"since"`
+	Uploads       int             `json:"uploads"`
+	UploadedBytes int64           `json:"uploadedBytes"`
+	Downloads     int             `json:"downloads"`
+	Entries       []ActivityEntry `json:"entries"`
+}
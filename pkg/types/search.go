@@ -0,0 +1,50 @@
+package types
+
+import "time"
+
+// SearchMatch is how well a name matched a search query, from best to worst
+type SearchMatch string
+
+const (
+	// SearchMatchExact is a name equal to the query
+	SearchMatchExact SearchMatch = "exact"
+	// SearchMatchPrefix is a name starting with the query
+	SearchMatchPrefix SearchMatch = "prefix"
+	// SearchMatchWord is a name with a word starting with the query
+	SearchMatchWord SearchMatch = "word"
+	// SearchMatchSubstring is a name containing the query anywhere
+	SearchMatchSubstring SearchMatch = "substring"
+)
+
+// SearchResult is a file or folder whose name matched a search query
+type SearchResult struct {
+	// Path is the full key of the file, or the folder prefix including the trailing slash
+	Path         string      `json:"path"`
+	Name         string      `json:"name"`
+	Size         int64       `json:"size"`
+	LastModified time.Time   `json:"lastModified"`
+	IsDir        bool        `json:"isDir"`
+	Match        SearchMatch `json:"match"`
+}
+
+// SearchResults are the ranked results of a search, best match first
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
+
+// ContentSearchResult is a document whose text matched a search query
+type ContentSearchResult struct {
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	// Snippet is the HTML escaped text around the match, matched words are wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+// ContentSearchResults are the results of a full-text search, best match first
+type ContentSearchResults struct {
+	Query   string                `json:"query"`
+	Results []ContentSearchResult `json:"results"`
+}
@@ -0,0 +1,68 @@
+package types
+
+import "time"
+
+// ShareLink opens a file or folder to anyone holding its token, without an account
+type ShareLink struct {
+	ID string `json:"id"`
+	// Token is the secret part of the link, it is only returned when the link is created
+	Token string `json:"token,omitempty"`
+	// Key is the bucket key of the file, or the prefix of the folder including the trailing slash
+	Key   string `json:"-"`
+	Space Space  `json:"space,omitempty"`
+	// Path is relative to Space
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+	// Owner is the ID of the user who shared the link, the link never opens more than they can read
+	Owner       string    `json:"owner"`
+	OwnerName   string    `json:"ownerName"`
+	HasPassword bool      `json:"hasPassword"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// MaxDownloads is the number of downloads the link allows, zero is unlimited
+	MaxDownloads int64 `json:"maxDownloads,omitempty"`
+	Downloads    int64 `json:"downloads"`
+}
+
+// Expired returns true once the link can no longer be opened
+func (l *ShareLink) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// UsedUp returns true once the link was downloaded as many times as it allows
+func (l *ShareLink) UsedUp() bool {
+	return l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads
+}
+
+// OwnerUser returns the owner of the link as the user whose permissions it carries. The owner has no
+// groups: the link opens what the grants and the owner's home give them, never what a role gives them
+func (l *ShareLink) OwnerUser() *User {
+	return &User{ID: l.Owner, Username: l.OwnerName}
+}
+
+// ShareRequest describes a link a user wants to share
+type ShareRequest struct {
+	// Path is the file or folder to share, folders end with a slash
+	Path  string `json:"path"`
+	Space Space  `json:"space,omitempty"`
+	// Password has to be given to open the link when set
+	Password string `json:"password,omitempty"`
+	// ExpiresIn is the number of seconds the link works for, zero means the default
+	ExpiresIn    int64 `json:"expiresIn"`
+	MaxDownloads int64 `json:"maxDownloads"`
+}
+
+// SharedItem is what a share link opens: a file with its download url or the listing of a folder
+type SharedItem struct {
+	Name         string    `json:"name"`
+	IsDir        bool      `json:"isDir"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	// URL is the presigned download of a shared file
+	URL string `json:"url,omitempty"`
+	// Folder lists a shared folder, or the folder under it given by path
+	Folder    *Folder   `json:"folder,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// DownloadsLeft is set when the number of downloads is limited
+	DownloadsLeft *int64 `json:"downloadsLeft,omitempty"`
+}
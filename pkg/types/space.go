@@ -0,0 +1,40 @@
+package types
+
+import "strings"
+
+// Space is a part of the drive the paths of a request are relative to
+type Space string
+
+const (
+	// SpaceHome is the private space of the caller, the default
+	SpaceHome Space = "home"
+	// SpaceFamily is shared by the whole household, every member can read and write it
+	SpaceFamily Space = "family"
+	// SpaceAll is the whole bucket, only administrators can work in it
+	SpaceAll Space = "all"
+)
+
+// Spaces are the spaces shown side by side at the root of the drive
+var Spaces = []Space{SpaceHome, SpaceFamily}
+
+const (
+	// HomesPrefix is the bucket prefix holding the private space of every user
+	HomesPrefix = "home/"
+	// FamilyPrefix is the bucket prefix of the family space
+	FamilyPrefix = "family/"
+)
+
+// KidPrefix returns the bucket prefix of the folder of the family space a child account uploads into,
+// Kids/<username>
+func KidPrefix(user *User) string {
+	name := user.Username
+	if name == "" || strings.Contains(name, "/") {
+		name = user.ID
+	}
+	return FamilyPrefix + "Kids/" + name + "/"
+}
+
+// HomePrefix returns the bucket prefix of the private space of a user, keyed by their Cognito sub
+func HomePrefix(userID string) string {
+	return HomesPrefix + userID + "/"
+}
@@ -0,0 +1,23 @@
+package types
+
+// UploadRequest describes an upload a client wants to make
+type UploadRequest struct {
+	File string `json:"file"`
+	// Space is the space File is relative to, the space of the request when empty
+	Space Space `json:"space,omitempty"`
+	// IfMatch is the etag the current version of the file must have for the upload to go ahead
+	IfMatch string `json:"ifMatch,omitempty"`
+	// IfNoneMatch set to "*" means the file must not exist yet
+	IfNoneMatch string `json:"ifNoneMatch,omitempty"`
+	// Size is the length of the file in bytes, child accounts have to give it
+	Size int64 `json:"size,omitempty"`
+	// ContentType is signed into the upload when given
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// PresignedURL is a presigned S3 request
+type PresignedURL struct {
+	URL string `json:"url"`
+	// Headers have to be sent with the request as they are part of the signature
+	Headers map[string]string `json:"headers,omitempty"`
+}
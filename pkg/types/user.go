@@ -1,10 +1,60 @@
 package types
 
+const (
+	// GroupAdmins is the Cognito group of the users allowed to manage the drive
+	GroupAdmins = "admins"
+	// GroupParents is the Cognito group of the adults of the household
+	GroupParents = "parents"
+	// GroupKids is the Cognito group of the children of the household
+	GroupKids = "kids"
+	// GroupGuests is the Cognito group of visitors with read only access
+	GroupGuests = "guests"
+)
+
+// User is the authenticated user making a request
 type User struct {
-	Email         string `json:"email"`
-	EmailVerified bool   `json:"email_verified"`
-	Name          string `json:"name"`
-	Picture       string `json:"picture"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
+	// ID is the Cognito sub of the user
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+	Groups        []string `json:"groups"`
+}
+
+// InGroup returns true if the user belongs to the Cognito group
+func (u *User) InGroup(group string) bool {
+	if u == nil {
+		return false
+	}
+	for _, g := range u.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin returns true if the user is a drive administrator
+func (u *User) IsAdmin() bool {
+	return u.InGroup(GroupAdmins)
+}
+
+// IsKid returns true for a supervised child account
+func (u *User) IsKid() bool {
+	return u.InGroup(GroupKids) && !u.IsAdmin() && !u.InGroup(GroupParents)
+}
+
+// IsParent returns true if the user supervises the child accounts
+func (u *User) IsParent() bool {
+	return u.InGroup(GroupParents) || u.IsAdmin()
+}
+
+// Profile is the authenticated user along with what their groups allow them to do
+type Profile struct {
+	User
+	Permissions []Action `json:"permissions"`
 }